@@ -7,6 +7,7 @@ import (
 
 	"github.com/gmherb/envtab/internal/backends"
 	"github.com/gmherb/envtab/internal/env"
+	"github.com/gmherb/envtab/internal/shell"
 	"github.com/gmherb/envtab/internal/sops"
 	"github.com/gmherb/envtab/internal/tags"
 	"github.com/spf13/cobra"
@@ -29,6 +30,7 @@ Multiple tags can be provided using space or comma as a separator.`,
 	Args:                  cobra.MinimumNArgs(2),
 	Aliases:               []string{"a", "ad"},
 	SuggestFor:            []string{"set"},
+	PostRun:               syncLoginScriptsPostRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		slog.Debug("add command called with args", "args", args)
 
@@ -62,6 +64,11 @@ Multiple tags can be provided using space or comma as a separator.`,
 			newTags = args[3:]
 		}
 
+		if err := shell.ValidateKey(key); err != nil {
+			slog.Error("invalid key", "key", key, "error", err)
+			os.Exit(1)
+		}
+
 		// Process tags
 		newTags = tags.RemoveDuplicateTags(tags.RemoveEmptyTags(tags.SplitTags(newTags)))
 
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gmherb/envtab/internal/agent"
+	"github.com/gmherb/envtab/internal/config"
+	"github.com/gmherb/envtab/internal/process"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Start the decryption cache agent",
+	Long: `Start the envtab agent, a per-user background process caching decrypted
+SOPS values and files in memory, so loadouts are not decrypted again (and KMS
+keys or hardware tokens are not asked again) until the cached values expire.
+
+While the agent runs, envtab looks up values in the agent before decrypting
+them and adds the values it decrypts. Values expire the --ttl duration (or
+the agent.ttl config key, default 15m) after they were added. The agent
+listens on a Unix socket only the user can access, in $XDG_RUNTIME_DIR/envtab
+(or $XDG_CACHE_HOME/envtab), or at ENVTAB_AGENT_SOCK if set.
+
+Use envtab agent lock to wipe the cached values and envtab agent stop to
+stop the agent.`,
+	Example: `  envtab agent
+  envtab agent --ttl 1h
+  envtab agent status
+  envtab agent lock`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("agent called")
+		ttl := agentTTL(cmd)
+		socketPath := config.GetAgentSocketPath()
+
+		if foreground, _ := cmd.Flags().GetBool("foreground"); foreground {
+			l, err := agent.Listen(socketPath)
+			if err != nil {
+				slog.Error("failure starting envtab agent", "socket", socketPath, "error", err)
+				os.Exit(1)
+			}
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+			slog.Info("envtab agent started", "socket", socketPath, "ttl", ttl)
+			if err := agent.NewServer(ttl).Serve(ctx, l); err != nil {
+				slog.Error("failure running envtab agent", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		if status, err := agent.Call(agent.Request{Op: agent.OpStatus}); err == nil {
+			fmt.Printf("envtab agent already running (pid %d) on %s\n", status.PID, socketPath)
+			return
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			slog.Error("failure finding envtab executable", "error", err)
+			os.Exit(1)
+		}
+		child := exec.Command(executable, "agent", "--foreground", "--ttl", ttl.String())
+		process.Detach(child)
+		if err := child.Start(); err != nil {
+			slog.Error("failure starting envtab agent", "error", err)
+			os.Exit(1)
+		}
+		pid := child.Process.Pid
+		child.Process.Release()
+
+		for range 40 {
+			if agent.Running() {
+				fmt.Printf("Started envtab agent (pid %d) on %s, caching values for %s\n", pid, socketPath, ttl)
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		slog.Error("envtab agent did not start, run envtab agent --foreground to see why", "socket", socketPath)
+		os.Exit(1)
+	},
+}
+
+var agentLockCmd = &cobra.Command{
+	Use:   "lock",
+	Short: "Wipe the values cached by the agent",
+	Long: `Wipe the decrypted values cached by the envtab agent. The agent keeps
+running, and values are decrypted and cached again when next used.`,
+	Example: `  envtab agent lock`,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("agent lock called")
+		resp, err := agent.Call(agent.Request{Op: agent.OpLock})
+		if err != nil {
+			slog.Error("envtab agent is not running", "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Wiped %d cached value(s) from envtab agent\n", resp.Entries)
+	},
+}
+
+var agentStatusCmd = &cobra.Command{
+	Use:     "status",
+	Short:   "Show whether the agent is running",
+	Long:    `Show whether the envtab agent is running, with its socket, TTL and number of cached values.`,
+	Example: `  envtab agent status`,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("agent status called")
+		socketPath := config.GetAgentSocketPath()
+		resp, err := agent.Call(agent.Request{Op: agent.OpStatus})
+		if err != nil {
+			slog.Debug("envtab agent not available", "error", err)
+			fmt.Printf("envtab agent is not running on %s\n", socketPath)
+			os.Exit(1)
+		}
+		fmt.Printf("envtab agent running (pid %d) on %s, caching %d value(s) for %s\n", resp.PID, socketPath, resp.Entries, resp.TTL)
+	},
+}
+
+var agentStopCmd = &cobra.Command{
+	Use:     "stop",
+	Short:   "Stop the agent",
+	Long:    `Stop the envtab agent, wiping the values it cached.`,
+	Example: `  envtab agent stop`,
+	Args:    cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("agent stop called")
+		resp, err := agent.Call(agent.Request{Op: agent.OpStop})
+		if err != nil {
+			slog.Error("envtab agent is not running", "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Stopped envtab agent (pid %d)\n", resp.PID)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+	agentCmd.AddCommand(agentLockCmd)
+	agentCmd.AddCommand(agentStatusCmd)
+	agentCmd.AddCommand(agentStopCmd)
+	agentCmd.Flags().Duration("ttl", agent.DefaultTTL, "How long decrypted values are cached (default from agent.ttl)")
+	agentCmd.Flags().Bool("foreground", false, "Run the agent in the foreground instead of in the background")
+}
+
+// agentTTL returns the --ttl flag, or the `agent.ttl` config key if the flag
+// is not set, exiting if it is not a positive duration
+func agentTTL(cmd *cobra.Command) time.Duration {
+	ttl, _ := cmd.Flags().GetDuration("ttl")
+	if !cmd.Flags().Changed("ttl") && viper.IsSet("agent.ttl") {
+		ttl = viper.GetDuration("agent.ttl")
+	}
+	if ttl <= 0 {
+		slog.Error("agent TTL must be a positive duration such as 30m", "ttl", ttl)
+		os.Exit(1)
+	}
+	return ttl
+}
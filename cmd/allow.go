@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/gmherb/envtab/internal/config"
+	"github.com/spf13/cobra"
+)
+
+var allowCmd = &cobra.Command{
+	Use:   "allow [PATH]",
+	Short: "Allow a project config",
+	Long: `Allow the project config (.envtab.yaml) of the current directory or its
+parents, or the one at PATH (a file or the directory containing it).
+
+The hash of its content is recorded in the data directory. Settings of a
+project config (such as sops.path_regex) only override the user config once
+it is allowed, and the shell hook only activates the loadouts of allowed
+project configs. A project config must be allowed again after it changes.`,
+	Example: `  envtab allow
+  envtab allow ~/src/monorepo
+  envtab allow ~/src/monorepo/.envtab.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("allow called", "args", args)
+
+		path := projectConfigArg(args)
+		if err := config.AllowProjectConfig(path); err != nil {
+			slog.Error("failure allowing project config", "path", path, "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Allowed project config [%s]\n", path)
+	},
+}
+
+var denyCmd = &cobra.Command{
+	Use:   "deny [PATH]",
+	Short: "Deny a project config",
+	Long: `Deny the project config (.envtab.yaml) of the current directory or its
+parents, or the one at PATH (a file or the directory containing it).
+
+The settings of denied project configs are ignored and the shell hook does
+not activate their loadouts, whatever their content, without asking to allow
+them.`,
+	Example: `  envtab deny
+  envtab deny ~/src/untrusted-repo`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("deny called", "args", args)
+
+		path := projectConfigArg(args)
+		if err := config.DenyProjectConfig(path); err != nil {
+			slog.Error("failure denying project config", "path", path, "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Denied project config [%s]\n", path)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(allowCmd)
+	rootCmd.AddCommand(denyCmd)
+}
+
+// projectConfigArg returns the absolute path of the project config named by
+// args, or found from the current directory. Exits if there is none.
+func projectConfigArg(args []string) string {
+	var path string
+	if len(args) == 0 {
+		path = config.FindProjectConfig()
+		if path == "" {
+			slog.Error("no project config (.envtab.yaml) found in the current directory or its parents")
+			os.Exit(1)
+		}
+	} else {
+		path = args[0]
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, ".envtab.yaml")
+		}
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		slog.Error("failure getting absolute path", "path", path, "error", err)
+		os.Exit(1)
+	}
+	if _, err := os.Stat(abs); err != nil {
+		slog.Error("project config does not exist", "path", abs, "error", err)
+		os.Exit(1)
+	}
+	return abs
+}
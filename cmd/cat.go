@@ -8,7 +8,6 @@ import (
 	"strings"
 
 	"github.com/gmherb/envtab/internal/backends"
-	"github.com/gmherb/envtab/internal/config"
 	"github.com/gmherb/envtab/internal/loadout"
 	"github.com/spf13/cobra"
 	yaml "gopkg.in/yaml.v2"
@@ -16,17 +15,23 @@ import (
 
 var catOutputPath string
 var catDecrypt bool
+var catResolved bool
 
 var catCmd = &cobra.Command{
 	Use:   "cat LOADOUT_NAME [LOADOUT_NAME ...]",
 	Short: "Concatenate envtab loadouts to stdout",
 	Long: `Concatenate envtab loadouts to stdout.
 By default, shows encrypted values/files. If the --decrypt flag is provided,
-then the values/files will be decrypted and shown in cleartext.`,
+then the values/files will be decrypted and shown in cleartext.
+
+With --resolved, the entries of included loadouts are merged in and the
+flattened loadout is shown. File-encrypted loadouts can only be resolved
+with --decrypt.`,
 	Example: `  envtab cat myloadout
   envtab cat myloadout1 myloadout2 myloadout3
   envtab cat myloadout --decrypt
-  envtab cat myloadout --decrypt --output decrypted.yaml`,
+  envtab cat myloadout --decrypt --output decrypted.yaml
+  envtab cat prod-eu --resolved`,
 	Args:       cobra.MinimumNArgs(1),
 	SuggestFor: []string{"print", "display"},
 	Aliases:    []string{"c", "ca"},
@@ -79,9 +84,8 @@ func getLoadoutDataForFile(loadoutName string) ([]byte, bool, error) {
 	isFileEncrypted := backends.IsLoadoutFileEncrypted(loadoutName)
 
 	// Handle file-level encrypted loadout without decryption
-	if isFileEncrypted && !catDecrypt {
-		filePath := filepath.Join(config.InitEnvtab(""), loadoutName+".yaml")
-		data, err := os.ReadFile(filePath)
+	if isFileEncrypted && !catDecrypt && !catResolved {
+		data, err := backends.ReadRawLoadout(loadoutName)
 		if err != nil {
 			if os.IsNotExist(err) {
 				slog.Error("loadout does not exist", "loadout", loadoutName)
@@ -99,6 +103,12 @@ func getLoadoutDataForFile(loadoutName string) ([]byte, bool, error) {
 		return nil, false, err
 	}
 
+	if catResolved {
+		if loadout, err = resolveCatLoadout(loadout); err != nil {
+			return nil, false, err
+		}
+	}
+
 	// Decrypt value-level encrypted entries if --decrypt is set
 	if catDecrypt {
 		if _, err := loadout.DecryptSOPSValues(); err != nil {
@@ -121,9 +131,8 @@ func printLoadoutToStdout(loadoutName string) {
 	isFileEncrypted := backends.IsLoadoutFileEncrypted(loadoutName)
 
 	// Handle file-level encrypted loadout without decryption
-	if isFileEncrypted && !catDecrypt {
-		filePath := filepath.Join(config.InitEnvtab(""), loadoutName+".yaml")
-		data, err := os.ReadFile(filePath)
+	if isFileEncrypted && !catDecrypt && !catResolved {
+		data, err := backends.ReadRawLoadout(loadoutName)
 		if err != nil {
 			if os.IsNotExist(err) {
 				slog.Error("loadout does not exist", "loadout", loadoutName)
@@ -142,6 +151,12 @@ func printLoadoutToStdout(loadoutName string) {
 		return
 	}
 
+	if catResolved {
+		if loadout, err = resolveCatLoadout(loadout); err != nil {
+			return
+		}
+	}
+
 	// Decrypt value-level encrypted entries if --decrypt is set
 	if catDecrypt {
 		if _, err := loadout.DecryptSOPSValues(); err != nil {
@@ -153,6 +168,25 @@ func printLoadoutToStdout(loadoutName string) {
 	loadout.PrintLoadout()
 }
 
+// resolveCatLoadout returns lo flattened with the loadouts it includes.
+// File-encrypted loadouts are only read when --decrypt is set.
+func resolveCatLoadout(lo *loadout.Loadout) (*loadout.Loadout, error) {
+	flat, err := loadout.Flatten(lo, func(name string) (*loadout.Loadout, error) {
+		if !catDecrypt && backends.IsLoadoutFileEncrypted(name) {
+			return nil, fmt.Errorf("loadout is file-encrypted, use --decrypt to resolve it")
+		}
+		return backends.ReadLoadout(name)
+	})
+	if err == nil && !catDecrypt && backends.IsLoadoutFileEncrypted(lo.Name) {
+		err = fmt.Errorf("loadout is file-encrypted, use --decrypt to resolve it")
+	}
+	if err != nil {
+		slog.Error("failure resolving loadout", "loadout", lo.Name, "error", err)
+		return nil, err
+	}
+	return flat, nil
+}
+
 // readLoadoutWithErrorHandling reads a loadout with consistent error handling.
 // If exitOnError is true, exits on error; otherwise returns error for caller to handle.
 func readLoadoutWithErrorHandling(loadoutName string, exitOnError bool) (*loadout.Loadout, error) {
@@ -187,4 +221,5 @@ func init() {
 	rootCmd.AddCommand(catCmd)
 	catCmd.Flags().StringVarP(&catOutputPath, "output", "o", "", "Write loadout YAML to file instead of stdout (only for single loadout)")
 	catCmd.Flags().BoolVarP(&catDecrypt, "decrypt", "d", false, "Decrypt file-level and value-level encrypted entries (default: show encrypted values)")
+	catCmd.Flags().BoolVarP(&catResolved, "resolved", "r", false, "Show the loadout with the entries of included loadouts merged in")
 }
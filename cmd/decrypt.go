@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/spf13/cobra"
+)
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt LOADOUT",
+	Short: "Remove the SOPS encryption of a loadout",
+	Long: `Decrypt a loadout in place, storing it in plaintext.
+
+The loadout file is decrypted if it is file-encrypted, and every
+value-encrypted entry (SOPS:) is decrypted, which requires access to the keys
+the loadout was encrypted with. Nothing is written if any value cannot be
+decrypted.
+
+The loadout metadata is kept. Earlier revisions in envtab history keep
+their encryption, but the decrypted loadout is recorded as a new revision in
+plaintext. Use envtab encrypt to encrypt the loadout again.`,
+	Example: `  envtab decrypt prod`,
+	Args:    cobra.ExactArgs(1),
+	PostRun: syncLoginScriptsPostRun,
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("decrypt called with args", "args", args)
+		if err := decryptLoadout(args[0]); err != nil {
+			slog.Error("failure decrypting loadout", "loadout", args[0], "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(decryptCmd)
+}
+
+// decryptLoadout removes the file and value encryption of a loadout
+func decryptLoadout(name string) error {
+	lo, fileEncrypted, err := readLoadoutForConversion(name)
+	if err != nil {
+		return err
+	}
+	if !fileEncrypted && !backends.HasValueEncryptedEntries(lo) {
+		fmt.Printf("Loadout [%s] is not encrypted\n", name)
+		return nil
+	}
+
+	decrypted, err := decryptAllValues(lo)
+	if err != nil {
+		return err
+	}
+	if err := backends.WriteLoadoutWithEncryption(name, lo, false); err != nil {
+		return err
+	}
+
+	done := []string{}
+	if fileEncrypted {
+		done = append(done, "file")
+	}
+	if len(decrypted) > 0 {
+		done = append(done, fmt.Sprintf("%d value(s): %s", len(decrypted), strings.Join(decrypted, ", ")))
+	}
+	fmt.Printf("Decrypted loadout [%s] (%s)\n", name, strings.Join(done, "; "))
+	return nil
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/fatih/color"
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/gmherb/envtab/internal/env"
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/spf13/cobra"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// encryptedDisplayValue replaces the values of encrypted entries unless decrypted
+const encryptedDisplayValue = "***encrypted***"
+
+var diffCmd = &cobra.Command{
+	Use:   "diff LOADOUT [LOADOUT | FILE]",
+	Short: "Show the differences between loadouts, files and the environment",
+	Long: `Show the entries added, removed and changed from the first loadout to a
+second loadout, a dotenv (.env) or loadout YAML (.yaml|.yml) file, or, with
+--env, the current environment.
+
+Encrypted values are decrypted to compare them, so the same secret encrypted
+twice is not a difference. Values and defaults of SOPS-encrypted,
+file-encrypted and sensitive entries are masked unless --decrypt is provided.
+
+Loadout and entry metadata are compared too, except for timestamps. A dotenv
+file has no metadata, so only its entries are compared. With --env, an entry
+differs when it is not active (see envtab show), and variables set in the
+environment but not in the loadout are ignored.`,
+	Example: `  envtab diff staging prod
+  envtab diff prod ./prod.env
+  envtab diff prod ./backup/prod.yaml
+  envtab diff prod --env
+  envtab diff staging prod --decrypt`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if againstEnv, _ := cmd.Flags().GetBool("env"); againstEnv {
+			if len(args) != 1 {
+				return fmt.Errorf("when using --env, provide exactly one LOADOUT")
+			}
+			return nil
+		}
+		if len(args) != 2 {
+			return fmt.Errorf("expected 2 arguments: LOADOUT and LOADOUT or FILE")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("diff called with args", "args", args)
+		decrypt, _ := cmd.Flags().GetBool("decrypt")
+		againstEnv, _ := cmd.Flags().GetBool("env")
+
+		old := readDiffLoadout(args[0])
+
+		var new diffSide
+		var changes []loadout.Change
+		if againstEnv {
+			environment := env.NewEnv()
+			environment.Populate()
+			new = diffSide{label: "environment", lo: &loadout.Loadout{Specs: old.lo.Specs}}
+			changes = diffEnv(old.lo, environment)
+		} else {
+			if isDiffFile(args[1]) {
+				new = readDiffFile(args[1], old.lo)
+			} else {
+				new = readDiffLoadout(args[1])
+			}
+			changes = loadout.Diff(*old.lo, *new.lo)
+		}
+
+		printChanges(os.Stdout, old, new, changes, decrypt)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().BoolP("decrypt", "d", false, "Show the values of encrypted and sensitive entries")
+	diffCmd.Flags().BoolP("env", "e", false, "Compare the loadout with the current environment")
+}
+
+// diffSide is a loadout compared by diff, with its encrypted values decrypted
+type diffSide struct {
+	label string
+	lo    *loadout.Loadout
+	// encrypted holds the keys whose values were SOPS-encrypted
+	encrypted map[string]bool
+	// fileEncrypted loadouts have all their values masked
+	fileEncrypted bool
+}
+
+// diffMask returns the value shown instead of the values of key, or an empty
+// string if they are shown. Values encrypted or sensitive on either side are
+// masked.
+func diffMask(old, new diffSide, key string) string {
+	switch {
+	case old.encrypted[key] || new.encrypted[key] || old.fileEncrypted || new.fileEncrypted:
+		return encryptedDisplayValue
+	case old.lo.Spec(key).Sensitive || new.lo.Spec(key).Sensitive:
+		return sensitiveDisplayValue
+	}
+	return ""
+}
+
+// isDiffFile reports whether arg names a dotenv or loadout YAML file rather
+// than a loadout
+func isDiffFile(arg string) bool {
+	switch filepath.Ext(arg) {
+	case ".env", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// readDiffLoadout reads the loadout name and decrypts its values. Exits if it
+// cannot be read.
+func readDiffLoadout(name string) diffSide {
+	lo, _ := readLoadoutWithErrorHandling(name, true)
+	lo.Name = name
+	// DecryptSOPSValues warns about and keeps the values it cannot decrypt
+	encrypted, _ := lo.DecryptSOPSValues()
+	return diffSide{label: name, lo: lo, encrypted: encrypted, fileEncrypted: backends.IsLoadoutFileEncrypted(name)}
+}
+
+// readDiffFile reads a dotenv or loadout YAML file and decrypts its values.
+// A dotenv file takes the metadata of other, so only entries are compared.
+// Exits if it cannot be read.
+func readDiffFile(path string, other *loadout.Loadout) diffSide {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("failure reading file", "file", path, "error", err)
+		os.Exit(1)
+	}
+
+	lo := &loadout.Loadout{}
+	if filepath.Ext(path) == ".env" {
+		entries, err := backends.ParseDotenvContent(data)
+		if err != nil {
+			slog.Error("failure parsing dotenv file", "file", path, "error", err)
+			os.Exit(1)
+		}
+		lo.Metadata = other.Metadata
+		lo.Specs = other.Specs
+		lo.Entries = entries
+	} else {
+		if err := loadout.ValidateLoadoutYAML(data); err != nil {
+			slog.Error("invalid loadout YAML", "file", path, "error", err)
+			os.Exit(1)
+		}
+		if err := yaml.Unmarshal(data, lo); err != nil {
+			slog.Error("failure parsing loadout YAML", "file", path, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	encrypted, _ := lo.DecryptSOPSValues()
+	return diffSide{label: path, lo: lo, encrypted: encrypted}
+}
+
+// diffEnv returns the entries of lo that are not active in the environment:
+// removed if the variable is not set, changed otherwise
+func diffEnv(lo *loadout.Loadout, environment *env.Env) []loadout.Change {
+	keys := []string{}
+	for key := range lo.Entries {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	changes := []loadout.Change{}
+	for _, key := range keys {
+		if environment.IsLoadoutEntryActive(lo, key) {
+			continue
+		}
+		value, ok := environment.Env[key]
+		if !ok {
+			changes = append(changes, loadout.Change{Kind: loadout.ChangeRemoved, Key: key, Entry: key, Old: lo.Entries[key]})
+			continue
+		}
+		changes = append(changes, loadout.Change{Kind: loadout.ChangeChanged, Key: key, Entry: key, Old: lo.Entries[key], New: value})
+	}
+	return changes
+}
+
+// printChanges prints the changes from old to new, one per line, after a
+// header naming both sides. Nothing is printed if there are no changes.
+// Timestamps are skipped and the values and defaults of encrypted and
+// sensitive entries are masked unless decrypt is set.
+func printChanges(w io.Writer, old, new diffSide, changes []loadout.Change, decrypt bool) {
+	removedColor := color.New(color.FgRed).SprintFunc()
+	addedColor := color.New(color.FgGreen).SprintFunc()
+	changedColor := color.New(color.FgYellow).SprintFunc()
+
+	header := false
+	for _, change := range changes {
+		if change.IsTimestamp() {
+			continue
+		}
+		if !header {
+			fmt.Fprintln(w, removedColor("--- "+old.label))
+			fmt.Fprintln(w, addedColor("+++ "+new.label))
+			header = true
+		}
+
+		// Entries read like KEY=value, metadata fields like key: value
+		sep := ": "
+		oldValue, newValue := change.Old, change.New
+		if change.Key == change.Entry {
+			sep = "="
+		}
+		// Defaults are masked like the values they stand in for
+		masked := change.Key == change.Entry || change.Key == change.Entry+".default"
+		if masked && !decrypt {
+			if mask := diffMask(old, new, change.Entry); mask != "" {
+				oldValue, newValue = mask, mask
+			}
+		}
+
+		switch change.Kind {
+		case loadout.ChangeAdded:
+			fmt.Fprintln(w, addedColor(fmt.Sprintf("+ %s%s%s", change.Key, sep, newValue)))
+		case loadout.ChangeRemoved:
+			fmt.Fprintln(w, removedColor(fmt.Sprintf("- %s%s%s", change.Key, sep, oldValue)))
+		default:
+			fmt.Fprintln(w, changedColor(fmt.Sprintf("~ %s: %s -> %s", change.Key, oldValue, newValue)))
+		}
+	}
+}
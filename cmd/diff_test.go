@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/gmherb/envtab/internal/env"
+	"github.com/gmherb/envtab/internal/loadout"
+)
+
+func TestPrintChanges(t *testing.T) {
+	color.NoColor = true
+
+	old := diffSide{
+		label: "staging",
+		lo: &loadout.Loadout{
+			Metadata: loadout.LoadoutMetadata{UpdatedAt: "t1"},
+			Entries:  map[string]string{"HOST": "stg", "TOKEN": "a", "KEY": "k1"},
+			Specs:    map[string]loadout.EntrySpec{"TOKEN": {Sensitive: true, Default: "d1"}},
+		},
+		encrypted: map[string]bool{"KEY": true},
+	}
+	new := diffSide{
+		label: "prod",
+		lo: &loadout.Loadout{
+			Metadata: loadout.LoadoutMetadata{UpdatedAt: "t2", Tags: []string{"prod"}},
+			Entries:  map[string]string{"HOST": "prod", "TOKEN": "b", "KEY": "k2"},
+			Specs:    map[string]loadout.EntrySpec{"HOST": {Default: "localhost"}, "TOKEN": {Default: "d2"}},
+		},
+	}
+	changes := loadout.Diff(*old.lo, *new.lo)
+
+	tests := []struct {
+		name    string
+		decrypt bool
+		want    string
+	}{
+		{"masked", false, "--- staging\n+++ prod\n+ metadata.tags: prod\n~ HOST: stg -> prod\n+ HOST.default: localhost\n" +
+			"~ KEY: ***encrypted*** -> ***encrypted***\n~ TOKEN: ***sensitive*** -> ***sensitive***\n" +
+			"~ TOKEN.default: ***sensitive*** -> ***sensitive***\n- TOKEN.sensitive: true\n"},
+		{"decrypted", true, "--- staging\n+++ prod\n+ metadata.tags: prod\n~ HOST: stg -> prod\n+ HOST.default: localhost\n" +
+			"~ KEY: k1 -> k2\n~ TOKEN: a -> b\n~ TOKEN.default: d1 -> d2\n- TOKEN.sensitive: true\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			printChanges(&buf, old, new, changes, tt.decrypt)
+			if buf.String() != tt.want {
+				t.Errorf("printChanges() =\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+
+	// Loadouts differing only in timestamps print nothing
+	var buf bytes.Buffer
+	printChanges(&buf, old, new, []loadout.Change{{Kind: loadout.ChangeChanged, Key: "metadata.updatedAt", Old: "t1", New: "t2"}}, false)
+	if buf.Len() != 0 {
+		t.Errorf("printChanges() = %q, want nothing", buf.String())
+	}
+}
+
+func TestDiffEnv(t *testing.T) {
+	lo := &loadout.Loadout{Entries: map[string]string{"A": "1", "B": "2", "C": "3"}}
+	environment := env.NewEnv()
+	environment.Env = map[string]string{"A": "1", "B": "20", "OTHER": "x"}
+
+	want := []loadout.Change{
+		{Kind: loadout.ChangeChanged, Key: "B", Entry: "B", Old: "2", New: "20"},
+		{Kind: loadout.ChangeRemoved, Key: "C", Entry: "C", Old: "3"},
+	}
+	if got := diffEnv(lo, environment); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffEnv() = %+v, want %+v", got, want)
+	}
+}
+
+func TestIsDiffFile(t *testing.T) {
+	for arg, want := range map[string]bool{"prod": false, "./prod.env": true, "prod.yaml": true, "a/b.yml": true, "prod-eu": false} {
+		if got := isDiffFile(arg); got != want {
+			t.Errorf("isDiffFile(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/gmherb/envtab/internal/backends"
 	"github.com/gmherb/envtab/internal/config"
 	"github.com/gmherb/envtab/internal/loadout"
-	"github.com/gmherb/envtab/internal/sops"
 	"github.com/gmherb/envtab/internal/tags"
 	"github.com/gmherb/envtab/internal/utils"
 	"github.com/spf13/cobra"
@@ -20,7 +19,8 @@ import (
 var editCmd = &cobra.Command{
 	Use:   "edit LOADOUT_NAME",
 	Short: "Edit envtab loadout",
-	Long: `Edit envtab loadout name, description, tags, and login status.
+	Long: `Edit envtab loadout name, description, tags, includes, ordering, and login
+status.
 
 If no options are provided, enter editor to manually edit a envtab loadout.`,
 	Example: `  envtab edit myloadout                                  # edit loadout in editor
@@ -29,11 +29,17 @@ If no options are provided, enter editor to manually edit a envtab loadout.`,
   envtab edit myloadout --add-tags "tag1,tag2,tag3"      # add tags
   envtab edit myloadout --remove-tags "tag1,tag2,tag3"   # remove tags
   envtab edit myloadout --remove-entry KEY               # remove entry
+  envtab edit prod-eu --add-includes prod-base           # extend another loadout
+  envtab edit prod-eu --remove-includes prod-base        # stop extending a loadout
+  envtab edit myloadout --priority 10                    # export after lower priorities
+  envtab edit myloadout --add-after base                 # export after another loadout
+  envtab edit myloadout --remove-after base              # drop an after hint
   envtab edit myloadout --login                          # enable login
   envtab edit myloadout --no-login                       # disable login
   envtab edit myloadout -n newloadout -d "blah bla" -l   # update multiple fields`,
 	Args:    cobra.ExactArgs(1),
 	Aliases: []string{"ed", "edi"},
+	PostRun: syncLoginScriptsPostRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		slog.Debug("edit called with args", "args", args)
 
@@ -54,10 +60,8 @@ If no options are provided, enter editor to manually edit a envtab loadout.`,
 			loadoutModified = true
 		}
 
-		// Check if file is SOPS-encrypted to preserve encryption on save
-		envtabPath := config.InitEnvtab("")
-		loadoutPath := filepath.Join(envtabPath, loadoutName+".yaml")
-		isSOPSEncrypted := sops.IsSOPSEncrypted(loadoutPath)
+		// Check if loadout is SOPS-encrypted to preserve encryption on save
+		isSOPSEncrypted := backends.IsLoadoutFileEncrypted(loadoutName)
 
 		// load the loadout
 		lo, err := backends.ReadLoadout(loadoutName)
@@ -115,6 +119,58 @@ If no options are provided, enter editor to manually edit a envtab loadout.`,
 			loadoutModified = true
 		}
 
+		// If --add-includes is set, extend the given loadouts
+		if includesStr, _ := cmd.Flags().GetString("add-includes"); includesStr != "" {
+			includes := tags.RemoveDuplicateTags(tags.RemoveEmptyTags(tags.SplitTags([]string{includesStr})))
+
+			slog.Debug("adding loadout includes", "loadout", loadoutName, "includes", includes)
+
+			lo.UpdateIncludes(includes)
+			if _, err := loadout.ExpandIncludes(lo, backends.ReadLoadout); err != nil {
+				slog.Error("invalid includes", "loadout", loadoutName, "error", err)
+				os.Exit(1)
+			}
+			loadoutModified = true
+		}
+
+		// If --remove-includes is set, stop extending the given loadouts
+		if includesStr, _ := cmd.Flags().GetString("remove-includes"); includesStr != "" {
+			includes := tags.RemoveDuplicateTags(tags.RemoveEmptyTags(tags.SplitTags([]string{includesStr})))
+
+			slog.Debug("removing loadout includes", "loadout", loadoutName, "includes", includes)
+
+			lo.RemoveIncludes(includes)
+			loadoutModified = true
+		}
+
+		// If --priority is set, update the loadout priority
+		if cmd.Flags().Changed("priority") {
+			priority, _ := cmd.Flags().GetInt("priority")
+			slog.Debug("updating loadout priority", "loadout", loadoutName, "priority", priority)
+			lo.UpdatePriority(priority)
+			loadoutModified = true
+		}
+
+		// If --add-after is set, export the loadout after the given loadouts
+		if afterStr, _ := cmd.Flags().GetString("add-after"); afterStr != "" {
+			after := tags.RemoveDuplicateTags(tags.RemoveEmptyTags(tags.SplitTags([]string{afterStr})))
+
+			slog.Debug("adding loadout after hints", "loadout", loadoutName, "after", after)
+
+			lo.UpdateAfter(after)
+			loadoutModified = true
+		}
+
+		// If --remove-after is set, remove the given after hints
+		if afterStr, _ := cmd.Flags().GetString("remove-after"); afterStr != "" {
+			after := tags.RemoveDuplicateTags(tags.RemoveEmptyTags(tags.SplitTags([]string{afterStr})))
+
+			slog.Debug("removing loadout after hints", "loadout", loadoutName, "after", after)
+
+			lo.RemoveAfter(after)
+			loadoutModified = true
+		}
+
 		// If --remove-entry is set, remove entry from the loadout
 		if entryKey, _ := cmd.Flags().GetString("remove-entry"); entryKey != "" {
 			slog.Debug("removing loadout entry", "loadout", loadoutName, "key", entryKey)
@@ -160,6 +216,11 @@ func init() {
 	editCmd.Flags().String("add-tags", "", "add tags to loadout (separated by comma or space)")
 	editCmd.Flags().String("remove-tags", "", "remove tags from loadout (separated by comma or space)")
 	editCmd.Flags().String("remove-entry", "", "remove entry from loadout")
+	editCmd.Flags().String("add-includes", "", "add loadouts to extend (separated by comma or space)")
+	editCmd.Flags().String("remove-includes", "", "remove extended loadouts (separated by comma or space)")
+	editCmd.Flags().Int("priority", 0, "set loadout priority (lower priorities are exported first)")
+	editCmd.Flags().String("add-after", "", "add loadouts to export before this one (separated by comma or space)")
+	editCmd.Flags().String("remove-after", "", "remove loadouts to export before this one (separated by comma or space)")
 
 	editCmd.Flags().BoolP("login", "l", false, "enable loadout on login (mutually exclusive with --no-login)")
 	editCmd.Flags().BoolP("no-login", "L", false, "disable loadout on login (mutually exclusive with --login)")
@@ -168,17 +229,14 @@ func init() {
 
 func editLoadout(loadoutName string) error {
 
-	envtabPath := config.InitEnvtab("")
-	loadoutPath := filepath.Join(envtabPath, loadoutName+".yaml")
-
 	// Check if the loadout exists
-	if _, err := os.Stat(loadoutPath); os.IsNotExist(err) {
+	if !backends.LoadoutExists(loadoutName) {
 		slog.Error("loadout does not exist", "loadout", loadoutName)
 		os.Exit(1)
 	}
 
-	// Check if file is SOPS-encrypted to preserve encryption on save
-	isSOPSEncrypted := sops.IsSOPSEncrypted(loadoutPath)
+	// Check if loadout is SOPS-encrypted to preserve encryption on save
+	isSOPSEncrypted := backends.IsLoadoutFileEncrypted(loadoutName)
 
 	// Read the loadout (handles SOPS decryption automatically)
 	lo, err := backends.ReadLoadout(loadoutName)
@@ -260,6 +318,17 @@ func editLoadout(loadoutName string) error {
 			if !usersChoice {
 				return nil
 			}
+			continue
+		}
+
+		// Check entry metadata such as export modes
+		err = loadout.ValidateLoadout(editedLoadout)
+		if err != nil {
+			slog.Error("invalid loadout", "error", err)
+			usersChoice := utils.PromptForAnswer("The file contains invalid entry metadata. Do you want to continue editing to fix the errors? Enter 'yes' to continue to edit or 'no' to abort and discard changes?")
+			if !usersChoice {
+				return nil
+			}
 		}
 
 		// If the contents of the file could be parsed
@@ -296,6 +296,128 @@ func TestEditCmd_AddTags(t *testing.T) {
 	}
 }
 
+func TestEditCmd_Includes(t *testing.T) {
+	resetEditCmdFlags()
+	// Set up temporary directory
+	tmpDir, err := os.MkdirTemp("", "envtab-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Save original HOME
+	originalHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", originalHome)
+
+	// Set HOME to temp directory
+	os.Setenv("HOME", tmpDir)
+
+	// Initialize envtab directory
+	envtabPath := config.InitEnvtab("")
+	testLoadoutName := "test_edit_includes"
+	baseLoadoutName := "test_edit_includes_base"
+
+	// Cleanup
+	defer os.Remove(filepath.Join(envtabPath, testLoadoutName+".yaml"))
+	defer os.Remove(filepath.Join(envtabPath, baseLoadoutName+".yaml"))
+
+	for _, name := range []string{testLoadoutName, baseLoadoutName} {
+		lo := loadout.InitLoadout()
+		lo.Entries["KEY1"] = name
+		if err := backends.WriteLoadout(name, lo); err != nil {
+			t.Fatalf("WriteLoadout() error = %v", err)
+		}
+	}
+
+	// Test adding includes
+	editCmd.SetArgs([]string{testLoadoutName})
+	editCmd.Flags().Set("add-includes", baseLoadoutName)
+	editCmd.Run(editCmd, []string{testLoadoutName})
+
+	readLo, err := backends.ReadLoadout(testLoadoutName)
+	if err != nil {
+		t.Fatalf("ReadLoadout() error = %v", err)
+	}
+	if len(readLo.Metadata.Includes) != 1 || readLo.Metadata.Includes[0] != baseLoadoutName {
+		t.Errorf("Includes = %v, want [%s]", readLo.Metadata.Includes, baseLoadoutName)
+	}
+
+	// Test removing includes
+	resetEditCmdFlags()
+	editCmd.Flags().Set("remove-includes", baseLoadoutName)
+	editCmd.Run(editCmd, []string{testLoadoutName})
+
+	readLo, err = backends.ReadLoadout(testLoadoutName)
+	if err != nil {
+		t.Fatalf("ReadLoadout() error = %v", err)
+	}
+	if len(readLo.Metadata.Includes) != 0 {
+		t.Errorf("Includes = %v, want none", readLo.Metadata.Includes)
+	}
+}
+
+func TestEditCmd_Ordering(t *testing.T) {
+	resetEditCmdFlags()
+	// Set up temporary directory
+	tmpDir, err := os.MkdirTemp("", "envtab-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Save original HOME
+	originalHome := os.Getenv("HOME")
+	defer os.Setenv("HOME", originalHome)
+
+	// Set HOME to temp directory
+	os.Setenv("HOME", tmpDir)
+
+	// Initialize envtab directory
+	envtabPath := config.InitEnvtab("")
+	testLoadoutName := "test_edit_ordering"
+
+	// Cleanup
+	defer os.Remove(filepath.Join(envtabPath, testLoadoutName+".yaml"))
+
+	lo := loadout.InitLoadout()
+	lo.Entries["KEY1"] = "value1"
+	if err := backends.WriteLoadout(testLoadoutName, lo); err != nil {
+		t.Fatalf("WriteLoadout() error = %v", err)
+	}
+
+	// Test setting priority and after hints
+	editCmd.Flags().Set("priority", "-5")
+	editCmd.Flags().Set("add-after", "base,aws")
+	editCmd.Run(editCmd, []string{testLoadoutName})
+
+	readLo, err := backends.ReadLoadout(testLoadoutName)
+	if err != nil {
+		t.Fatalf("ReadLoadout() error = %v", err)
+	}
+	if readLo.Metadata.Priority != -5 {
+		t.Errorf("Priority = %d, want -5", readLo.Metadata.Priority)
+	}
+	if len(readLo.Metadata.After) != 2 || readLo.Metadata.After[0] != "base" || readLo.Metadata.After[1] != "aws" {
+		t.Errorf("After = %v, want [base aws]", readLo.Metadata.After)
+	}
+
+	// Test removing after hints keeps the priority
+	resetEditCmdFlags()
+	editCmd.Flags().Set("remove-after", "base")
+	editCmd.Run(editCmd, []string{testLoadoutName})
+
+	readLo, err = backends.ReadLoadout(testLoadoutName)
+	if err != nil {
+		t.Fatalf("ReadLoadout() error = %v", err)
+	}
+	if readLo.Metadata.Priority != -5 {
+		t.Errorf("Priority = %d, want -5", readLo.Metadata.Priority)
+	}
+	if len(readLo.Metadata.After) != 1 || readLo.Metadata.After[0] != "aws" {
+		t.Errorf("After = %v, want [aws]", readLo.Metadata.After)
+	}
+}
+
 func TestEditCmd_RemoveTags(t *testing.T) {
 	resetEditCmdFlags()
 	// Set up temporary directory
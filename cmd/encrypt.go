@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/spf13/cobra"
+)
+
+var encryptCmd = &cobra.Command{
+	Use:   "encrypt LOADOUT",
+	Short: "Encrypt an existing loadout with SOPS",
+	Long: `Encrypt the entries of an existing loadout with SOPS, in place.
+
+With --file, the whole loadout file is encrypted, and value-encrypted entries
+are decrypted first so each value is only encrypted once. With --values,
+the given entries are value-encrypted (SOPS:), and --all-values encrypts
+every entry. A file-encrypted loadout can be converted to value encryption
+with --all-values.
+
+The loadout metadata is kept, and the previous state stays available in
+envtab history. Use envtab decrypt to remove the encryption again.`,
+	Example: `  envtab encrypt prod --file
+  envtab encrypt prod --values API_KEY,DB_PASSWORD
+  envtab encrypt prod --all-values`,
+	Args:    cobra.ExactArgs(1),
+	PostRun: syncLoginScriptsPostRun,
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("encrypt called with args", "args", args)
+		name := args[0]
+		file, _ := cmd.Flags().GetBool("file")
+		allValues, _ := cmd.Flags().GetBool("all-values")
+		keys, _ := cmd.Flags().GetStringSlice("values")
+
+		var err error
+		if file {
+			err = encryptLoadoutFile(name)
+		} else {
+			err = encryptLoadoutValues(name, keys, allValues)
+		}
+		if err != nil {
+			slog.Error("failure encrypting loadout", "loadout", name, "error", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(encryptCmd)
+	encryptCmd.Flags().BoolP("file", "f", false, "Encrypt the entire loadout file")
+	encryptCmd.Flags().StringSliceP("values", "v", nil, "Encrypt the values of these keys")
+	encryptCmd.Flags().BoolP("all-values", "a", false, "Encrypt every value")
+	encryptCmd.MarkFlagsMutuallyExclusive("file", "values", "all-values")
+	encryptCmd.MarkFlagsOneRequired("file", "values", "all-values")
+}
+
+// readLoadoutForConversion reads an existing loadout and whether it is
+// file-encrypted
+func readLoadoutForConversion(name string) (*loadout.Loadout, bool, error) {
+	if !backends.LoadoutExists(name) {
+		return nil, false, fmt.Errorf("loadout does not exist")
+	}
+	fileEncrypted := backends.IsLoadoutFileEncrypted(name)
+	lo, err := backends.ReadLoadout(name)
+	if err != nil {
+		return nil, false, err
+	}
+	return lo, fileEncrypted, nil
+}
+
+// decryptAllValues decrypts the value-encrypted entries of lo in place,
+// failing if any of them cannot be decrypted. Returns the decrypted keys.
+func decryptAllValues(lo *loadout.Loadout) ([]string, error) {
+	encryptedKeys, err := lo.DecryptSOPSValues()
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := []string{}
+	failed := []string{}
+	for key := range encryptedKeys {
+		if strings.HasPrefix(lo.Entries[key], "SOPS:") {
+			failed = append(failed, key)
+		} else {
+			decrypted = append(decrypted, key)
+		}
+	}
+	slices.Sort(decrypted)
+	slices.Sort(failed)
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("cannot decrypt %s", strings.Join(failed, ", "))
+	}
+	return decrypted, nil
+}
+
+// encryptLoadoutFile converts a loadout to file-level encryption
+func encryptLoadoutFile(name string) error {
+	lo, fileEncrypted, err := readLoadoutForConversion(name)
+	if err != nil {
+		return err
+	}
+	if fileEncrypted && !backends.HasValueEncryptedEntries(lo) {
+		fmt.Printf("Loadout [%s] is already file-encrypted\n", name)
+		return nil
+	}
+
+	// Values are protected by the file encryption, not encrypted twice
+	decrypted, err := decryptAllValues(lo)
+	if err != nil {
+		return err
+	}
+	if err := backends.WriteLoadoutWithEncryption(name, lo, true); err != nil {
+		return err
+	}
+
+	if len(decrypted) > 0 {
+		fmt.Printf("Encrypted loadout [%s] file (converted %d value-encrypted entries: %s)\n", name, len(decrypted), strings.Join(decrypted, ", "))
+	} else {
+		fmt.Printf("Encrypted loadout [%s] file\n", name)
+	}
+	return nil
+}
+
+// encryptLoadoutValues value-encrypts the entries of keys, or every entry
+// if all is set. A file-encrypted loadout is only converted to value
+// encryption with all, so no entry is left in plaintext.
+func encryptLoadoutValues(name string, keys []string, all bool) error {
+	lo, fileEncrypted, err := readLoadoutForConversion(name)
+	if err != nil {
+		return err
+	}
+	if fileEncrypted && !all {
+		return fmt.Errorf("loadout is file-encrypted, use --all-values to convert it to value encryption or envtab decrypt it first")
+	}
+
+	if all {
+		keys = []string{}
+		for key := range lo.Entries {
+			keys = append(keys, key)
+		}
+	}
+	toEncrypt := map[string]bool{}
+	for _, key := range keys {
+		value, ok := lo.Entries[key]
+		if !ok {
+			return fmt.Errorf("key %s not found in loadout", key)
+		}
+		if !strings.HasPrefix(value, "SOPS:") {
+			toEncrypt[key] = true
+		}
+	}
+
+	if len(toEncrypt) == 0 && !fileEncrypted {
+		fmt.Printf("Loadout [%s] values are already encrypted\n", name)
+		return nil
+	}
+
+	if err := lo.ReencryptSOPSValues(toEncrypt); err != nil {
+		return err
+	}
+	if err := backends.WriteLoadoutWithEncryption(name, lo, false); err != nil {
+		return err
+	}
+
+	encrypted := []string{}
+	for key := range toEncrypt {
+		encrypted = append(encrypted, key)
+	}
+	slices.Sort(encrypted)
+	fmt.Printf("Encrypted %d value(s) of loadout [%s]: %s\n", len(encrypted), name, strings.Join(encrypted, ", "))
+	return nil
+}
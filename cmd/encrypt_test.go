@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/gmherb/envtab/internal/loadout"
+)
+
+// identity is shared by the tests, as age identities are only loaded once per process
+var identity = sync.OnceValue(func() *age.X25519Identity {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		panic(err)
+	}
+	return identity
+})
+
+// setupEncryption points envtab at a temporary data directory and encrypts
+// values in process with a generated age key
+func setupEncryption(t *testing.T) {
+	t.Helper()
+	t.Setenv("ENVTAB_DIR", t.TempDir())
+	t.Setenv("ENVTAB_AGENT_SOCK", filepath.Join(t.TempDir(), "agent.sock"))
+	t.Setenv("ENVTAB_SOPS_ENCRYPTOR", "native")
+	t.Setenv("SOPS_AGE_KEY", identity().String())
+	t.Setenv("SOPS_AGE_RECIPIENTS", identity().Recipient().String())
+}
+
+func TestEncryptLoadoutValues(t *testing.T) {
+	setupEncryption(t)
+
+	lo := loadout.InitLoadout()
+	lo.Entries["API_KEY"] = "key"
+	lo.Entries["DB_PASSWORD"] = "password"
+	lo.Entries["REGION"] = "eu-west-1"
+	lo.Metadata.Tags = []string{"prod"}
+	if err := backends.WriteLoadout("prod", lo); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func() *loadout.Loadout {
+		t.Helper()
+		lo, err := backends.ReadLoadout("prod")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lo
+	}
+
+	if err := encryptLoadoutValues("prod", []string{"MISSING"}, false); err == nil {
+		t.Error("encrypting a missing key should fail")
+	}
+	if err := encryptLoadoutValues("missing", nil, true); err == nil {
+		t.Error("encrypting a missing loadout should fail")
+	}
+
+	if err := encryptLoadoutValues("prod", []string{"API_KEY", "DB_PASSWORD"}, false); err != nil {
+		t.Fatalf("encryptLoadoutValues() error = %v", err)
+	}
+	got := read()
+	for key, encrypted := range map[string]bool{"API_KEY": true, "DB_PASSWORD": true, "REGION": false} {
+		if strings.HasPrefix(got.Entries[key], "SOPS:") != encrypted {
+			t.Errorf("%s = %q, want encrypted %v", key, got.Entries[key], encrypted)
+		}
+	}
+	if len(got.Metadata.Tags) != 1 || got.Metadata.Tags[0] != "prod" {
+		t.Errorf("tags = %v, want the metadata kept", got.Metadata.Tags)
+	}
+
+	if err := encryptLoadoutValues("prod", nil, true); err != nil {
+		t.Fatalf("encryptLoadoutValues() with all error = %v", err)
+	}
+	if !strings.HasPrefix(read().Entries["REGION"], "SOPS:") {
+		t.Error("REGION should be encrypted with all values")
+	}
+
+	if err := decryptLoadout("prod"); err != nil {
+		t.Fatalf("decryptLoadout() error = %v", err)
+	}
+	got = read()
+	for key, want := range map[string]string{"API_KEY": "key", "DB_PASSWORD": "password", "REGION": "eu-west-1"} {
+		if got.Entries[key] != want {
+			t.Errorf("%s = %q after decrypt, want %q", key, got.Entries[key], want)
+		}
+	}
+
+	revisions, err := backends.LoadoutRevisions("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 4 {
+		t.Errorf("got %d revisions, want every conversion recorded in history", len(revisions))
+	}
+}
+
+// fakeSOPS puts a sops script on PATH that "encrypts" files by base64
+// encoding them, so file-level encryption can be tested without sops keys
+func fakeSOPS(t *testing.T) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping test: the fake sops script needs a POSIX shell")
+	}
+	dir := t.TempDir()
+	script := `#!/bin/sh
+case "$1" in
+encrypt) printf 'data: %s\nsops:\n  fake: true\n' "$(base64 | tr -d '\n')" ;;
+-d) sed -n 's/^data: //p' "$2" | base64 -d ;;
+*) exit 1 ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "sops"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestEncryptLoadoutFile(t *testing.T) {
+	fakeSOPS(t)
+	setupEncryption(t)
+
+	lo := loadout.InitLoadout()
+	lo.Entries["API_KEY"] = "key"
+	lo.Entries["REGION"] = "eu-west-1"
+	lo.Metadata.Description = "production"
+	if err := backends.WriteLoadout("prod", lo); err != nil {
+		t.Fatal(err)
+	}
+	if err := encryptLoadoutValues("prod", []string{"API_KEY"}, false); err != nil {
+		t.Fatalf("encryptLoadoutValues() error = %v", err)
+	}
+
+	if err := encryptLoadoutFile("prod"); err != nil {
+		t.Fatalf("encryptLoadoutFile() error = %v", err)
+	}
+	if !backends.IsLoadoutFileEncrypted("prod") {
+		t.Fatal("loadout should be file-encrypted")
+	}
+	content, err := os.ReadFile(backends.GetLoadoutFilePath("prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "eu-west-1") {
+		t.Errorf("file-encrypted loadout contains plaintext:\n%s", content)
+	}
+
+	// Value-encrypted entries are stored decrypted inside the encrypted file
+	got, err := backends.ReadLoadout("prod")
+	if err != nil {
+		t.Fatalf("ReadLoadout() error = %v", err)
+	}
+	for key, want := range map[string]string{"API_KEY": "key", "REGION": "eu-west-1"} {
+		if got.Entries[key] != want {
+			t.Errorf("%s = %q after encrypting the file, want %q", key, got.Entries[key], want)
+		}
+	}
+	if got.Metadata.Description != "production" {
+		t.Errorf("description = %q, want the metadata kept", got.Metadata.Description)
+	}
+
+	if err := decryptLoadout("prod"); err != nil {
+		t.Fatalf("decryptLoadout() error = %v", err)
+	}
+	if backends.IsLoadoutFileEncrypted("prod") {
+		t.Error("loadout should no longer be file-encrypted")
+	}
+	if got, err := backends.ReadLoadout("prod"); err != nil || got.Entries["API_KEY"] != "key" {
+		t.Errorf("ReadLoadout() after decrypt = %v, %v", got, err)
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+
+	"github.com/gmherb/envtab/internal/env"
+	"github.com/gmherb/envtab/internal/process"
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec LOADOUT_NAME [LOADOUT_NAME ...] -- COMMAND [ARG ...]",
+	Short: "Execute a command with envtab loadout(s) applied",
+	Long: `Execute a command with the entries of the provided loadouts added to its
+environment, without modifying the current shell.
+
+Entries are resolved exactly like export: SOPS values are decrypted,
+variables are expanded and PATH entries are merged into PATH. The command
+then replaces envtab, so its exit code and signals are passed through.`,
+	Example: `  envtab exec prod-aws -- terraform apply
+  envtab exec aws github -- make release
+  envtab exec mydb -- sh -c 'psql "$DATABASE_URL"'`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		dash := cmd.ArgsLenAtDash()
+		if dash < 1 || dash == len(args) {
+			return errors.New("requires at least one loadout and a command separated by --")
+		}
+		return nil
+	},
+	DisableFlagsInUseLine: true,
+	SuggestFor:            []string{"exec-env"},
+	Aliases:               []string{"x", "run"},
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("exec called")
+
+		dash := cmd.ArgsLenAtDash()
+		loadoutNames, command := args[:dash], args[dash:]
+
+		applyLoadouts(cmd.Context(), loadoutNames)
+
+		// Look up the command using the PATH from the loadouts
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			slog.Error("command not found", "command", command[0], "error", err)
+			os.Exit(127)
+		}
+
+		slog.Debug("executing command", "path", path, "args", command[1:])
+		if err := process.Exec(path, command, os.Environ()); err != nil {
+			slog.Error("failure executing command", "command", command[0], "error", err)
+			os.Exit(126)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+}
+
+// applyLoadouts resolves the loadouts and sets their entries in the process
+// environment. Returns the names of the loadouts applied.
+func applyLoadouts(ctx context.Context, loadoutNames []string) []string {
+	environment := env.NewEnv()
+	environment.Populate()
+
+	loadouts := readLoadouts(loadoutNames)
+	resolved := resolveLoadoutsIn(ctx, loadouts, environment.Env)
+
+	for _, v := range resolved.Vars {
+		os.Setenv(v.Key, v.Value)
+	}
+	if value := env.RecordAddedSegments(environment.Env, resolved.Vars); value != "" {
+		os.Setenv(env.AddedSegmentsVar, value)
+	}
+	markLoaded(loadouts)
+
+	applied := []string{}
+	for _, lo := range loadouts {
+		applied = append(applied, lo.Name)
+	}
+	return applied
+}
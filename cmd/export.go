@@ -1,12 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
 
 	"github.com/gmherb/envtab/internal/backends"
-	"github.com/gmherb/envtab/internal/config"
+	"github.com/gmherb/envtab/internal/env"
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/gmherb/envtab/internal/shell"
 	"github.com/spf13/cobra"
 )
 
@@ -14,9 +18,30 @@ var exportCmd = &cobra.Command{
 	Use:   "export LOADOUT_NAME [LOADOUT_NAME ...]",
 	Short: "Export envtab loadout(s)",
 	Long: `Print export statements for provided loadouts to be sourced into
-	your environment.`,
-	Example: `  $(envtab export myloadout)
-  $(envtab export myloadout1 myloadout2 myloadout3)`,
+	your environment.
+
+The statements are printed in the dialect of your shell, detected from $SHELL.
+Use --shell to select a dialect: bash, zsh, fish, tcsh, nu, powershell or cmd.
+
+Values are quoted for the selected dialect, so the output must be evaluated
+by the shell (e.g. with eval) rather than word split from $(...). cmd output
+escapes % as %%, which only works in batch files, so save it to a .bat or
+.cmd file and run it with call.
+
+Loadouts are exported in the order given, except that loadouts with a lower
+metadata.priority are exported first and a loadout listing others in
+metadata.after is exported after them.
+
+Use --format json or --format dotenv to print the resolved entries instead
+of shell statements.`,
+	Example: `  eval "$(envtab export myloadout)"
+  eval "$(envtab export myloadout1 myloadout2 myloadout3)"
+  envtab export myloadout --shell fish | source
+  envtab export myloadout --shell tcsh > ~/.envtab.csh && source ~/.envtab.csh
+  envtab export myloadout --shell powershell | Out-String | Invoke-Expression
+  envtab export myloadout --shell cmd > envtab.bat && call envtab.bat
+  envtab export myloadout --format json
+  envtab export myloadout --format dotenv > .env`,
 	Args:                  cobra.MinimumNArgs(1),
 	DisableFlagsInUseLine: true,
 	SuggestFor:            []string{"load", "source", "."},
@@ -24,37 +49,164 @@ var exportCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		slog.Debug("export called")
 
-		envtabPath := config.InitEnvtab("")
-
-		for _, arg := range args {
-
-			loadoutName := arg
-			loadoutPath := envtabPath + `/` + loadoutName + `.yaml`
+		format, _ := cmd.Flags().GetString("format")
+		renderer, err := loadout.NewRenderer(format, getShell(cmd))
+		if err != nil {
+			slog.Error("invalid --format", "error", err)
+			os.Exit(1)
+		}
 
-			slog.Debug("exporting loadout", "loadout", loadoutName, "path", loadoutPath)
+		environment := env.NewEnv()
+		environment.Populate()
 
-			if _, err := os.Stat(loadoutPath); os.IsNotExist(err) {
-				slog.Error("loadout does not exist", "loadout", loadoutName)
-				os.Exit(1)
-			}
+		loadouts := readLoadouts(args)
+		resolved := resolveLoadoutsIn(cmd.Context(), loadouts, environment.Env)
 
-			loadout, err := backends.ReadLoadout(loadoutName)
-			if err != nil {
-				// Skip loadout if SOPS is not installed (for encrypted loadouts)
-				errStr := err.Error()
-				if strings.Contains(errStr, "SOPS_NOT_INSTALLED") {
-					slog.Warn("skipping loadout - SOPS not installed", "loadout", loadoutName)
-					continue
-				}
-				slog.Error("failure reading loadout", "loadout", loadoutName, "error", err)
-				os.Exit(1)
-			}
-
-			loadout.Export()
+		if err := renderer.Render(os.Stdout, resolved); err != nil {
+			slog.Error("skipping entries that cannot be exported", "error", err)
+		}
+		if format == loadout.FormatShell {
+			printAddedSegments(getShell(cmd), environment.Env, resolved)
 		}
+
+		markLoaded(loadouts)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(exportCmd)
+	addShellFlag(exportCmd)
+	exportCmd.Flags().StringP("format", "o", loadout.FormatShell, "Output format: "+strings.Join(loadout.Formats, "|"))
+}
+
+// readLoadouts reads the named loadouts from the current backend, exiting if
+// a loadout does not exist. Encrypted loadouts are skipped if SOPS is not installed.
+func readLoadouts(names []string) []*loadout.Loadout {
+	loadouts := []*loadout.Loadout{}
+
+	for _, loadoutName := range names {
+
+		slog.Debug("reading loadout", "loadout", loadoutName)
+
+		if !backends.LoadoutExists(loadoutName) {
+			slog.Error("loadout does not exist", "loadout", loadoutName)
+			os.Exit(1)
+		}
+
+		lo, err := backends.ReadLoadout(loadoutName)
+		if err != nil {
+			// Skip loadout if SOPS is not installed (for encrypted loadouts)
+			if strings.Contains(err.Error(), "SOPS_NOT_INSTALLED") {
+				slog.Warn("skipping loadout - SOPS not installed", "loadout", loadoutName)
+				continue
+			}
+			slog.Error("failure reading loadout", "loadout", loadoutName, "error", err)
+			os.Exit(1)
+		}
+		lo.Name = loadoutName
+
+		loadouts = append(loadouts, lo)
+	}
+
+	return loadouts
+}
+
+// expandIncludes returns the loadouts each preceded by the loadouts it
+// includes, with every loadout appearing once. Exits if an include is
+// missing or includes form a cycle.
+func expandIncludes(loadouts []*loadout.Loadout) []*loadout.Loadout {
+	expanded, err := loadout.ExpandAllIncludes(loadouts, backends.ReadLoadout)
+	if err != nil {
+		slog.Error("failure reading included loadouts", "error", err)
+		os.Exit(1)
+	}
+	return expanded
+}
+
+// orderLoadouts returns the loadouts in export order by priority and after
+// hints. Exits if the after hints form a cycle.
+func orderLoadouts(loadouts []*loadout.Loadout) []*loadout.Loadout {
+	ordered, err := loadout.OrderLoadouts(loadouts)
+	if err != nil {
+		slog.Error("failure ordering loadouts", "error", err)
+		os.Exit(1)
+	}
+	return ordered
+}
+
+// resolveLoadouts orders the loadouts and resolves them and the loadouts they
+// include against the current environment, logging entries that were skipped
+func resolveLoadouts(ctx context.Context, loadouts []*loadout.Loadout) loadout.ResolvedEnv {
+	environment := env.NewEnv()
+	environment.Populate()
+
+	return resolveLoadoutsIn(ctx, loadouts, environment.Env)
+}
+
+// resolveLoadoutsIn is resolveLoadouts against the environment base
+func resolveLoadoutsIn(ctx context.Context, loadouts []*loadout.Loadout, base map[string]string) loadout.ResolvedEnv {
+	resolved, warnings, err := loadout.ResolveAll(ctx, expandIncludes(orderLoadouts(loadouts)), base)
+	for _, w := range warnings {
+		slog.Warn("skipping entry", "loadout", w.Source, "key", w.Key, "reason", w.Message, "error", w.Err)
+	}
+	if err != nil {
+		slog.Error("failure resolving loadouts", "error", err)
+		os.Exit(1)
+	}
+	return resolved
+}
+
+// printAddedSegments prints the statement recording the list segments the
+// resolved variables add to base in env.AddedSegmentsVar, so unload only
+// removes those
+func printAddedSegments(sh shell.Shell, base map[string]string, resolved loadout.ResolvedEnv) {
+	if value := env.RecordAddedSegments(base, resolved.Vars); value != base[env.AddedSegmentsVar] {
+		printStateVar(sh, env.AddedSegmentsVar, value)
+	}
+}
+
+// printStateVar prints the statement setting the envtab state variable key
+// to value, or unsetting it if value is empty
+func printStateVar(sh shell.Shell, key, value string) {
+	var statement string
+	var err error
+	if value == "" {
+		statement, err = sh.Unset(key)
+	} else {
+		statement, err = sh.Export(key, value)
+	}
+	if err != nil {
+		slog.Error("failure setting envtab state", "key", key, "error", err)
+		return
+	}
+	fmt.Println(statement)
+}
+
+// markLoaded records the loadedAt time of the loadouts and the loadouts they
+// include, which are exported along with them
+func markLoaded(loadouts []*loadout.Loadout) {
+	if err := backends.MarkLoadoutsLoaded(expandIncludes(loadouts)); err != nil {
+		slog.Warn("failure recording loadedAt", "error", err)
+	}
+}
+
+// addShellFlag adds the --shell flag selecting the output dialect
+func addShellFlag(c *cobra.Command) {
+	c.Flags().String("shell", "", "Shell dialect for output: "+strings.Join(shell.Names(), "|")+" (default: detected from $SHELL)")
+}
+
+// getShell returns the dialect selected by --shell, detecting it from $SHELL if unset
+func getShell(c *cobra.Command) shell.Shell {
+	name, _ := c.Flags().GetString("shell")
+	if name == "" {
+		sh := shell.Detect()
+		slog.Debug("detected shell", "shell", sh)
+		return sh
+	}
+	sh, err := shell.Parse(name)
+	if err != nil {
+		slog.Error("invalid --shell", "error", err)
+		os.Exit(1)
+	}
+	return sh
 }
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/gmherb/envtab/internal/loadout"
+)
+
+func TestMarkLoadedIncludes(t *testing.T) {
+	t.Setenv("ENVTAB_DIR", t.TempDir())
+
+	for _, name := range []string{"base", "child"} {
+		lo := loadout.InitLoadout()
+		lo.Metadata.LoadedAt = "2000-01-01T00:00:00Z"
+		if name == "child" {
+			lo.Metadata.Includes = []string{"base"}
+		}
+		if err := backends.WriteLoadout(name, lo); err != nil {
+			t.Fatalf("WriteLoadout() error = %v", err)
+		}
+	}
+
+	child, err := backends.ReadLoadout("child")
+	if err != nil {
+		t.Fatalf("ReadLoadout() error = %v", err)
+	}
+	child.Name = "child"
+	markLoaded([]*loadout.Loadout{child})
+
+	for _, name := range []string{"base", "child"} {
+		lo, err := backends.ReadLoadout(name)
+		if err != nil {
+			t.Fatalf("ReadLoadout() error = %v", err)
+		}
+		if got := backends.LoadoutLoadedAt(name, lo); got == "2000-01-01T00:00:00Z" {
+			t.Errorf("LoadoutLoadedAt(%q) = %q, want the time recorded by markLoaded", name, got)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history LOADOUT",
+	Short: "List the revisions of a loadout",
+	Long: `List the revisions of a loadout, oldest first, with the time they were
+written and the envtab command that wrote them (values of KEY=VALUE arguments
+are not recorded).
+
+Every change to a loadout is kept as a revision in the .history directory of
+the data directory, including the loadout as it was before it was first
+changed with history and changes made outside envtab. Exporting a loadout
+only updates its loadedAt and is not recorded. Encrypted loadouts are kept
+encrypted. Revisions are kept when a loadout is removed, and the oldest are
+dropped beyond the history.limit config key (default 50, 0 keeps all).
+
+Use envtab history show to print a revision and envtab rollback to restore it.`,
+	Example: `  envtab history prod
+  envtab history show prod 3
+  envtab rollback prod 3`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("history called with args", "args", args)
+		name := args[0]
+
+		revisions, err := backends.LoadoutRevisions(name)
+		if err != nil {
+			slog.Error("failure reading loadout history", "loadout", name, "error", err)
+			os.Exit(1)
+		}
+		if len(revisions) == 0 {
+			slog.Error("loadout has no history", "loadout", name)
+			os.Exit(1)
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "REV\tTIME\tENCRYPTED\tCOMMAND")
+		for _, revision := range revisions {
+			command := revision.Command
+			if command == "" {
+				command = "(changed outside envtab)"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%t\t%s\n", revision.Number, revision.Time, revision.FileEncrypted, command)
+		}
+		tw.Flush()
+	},
+}
+
+var historyShowCmd = &cobra.Command{
+	Use:   "show LOADOUT REV",
+	Short: "Print a revision of a loadout",
+	Long: `Print a revision of a loadout exactly as it was stored. Encrypted values
+and file-encrypted revisions stay encrypted.`,
+	Example: `  envtab history show prod 3
+  envtab history show prod 3 > prod-3.yaml`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("history show called with args", "args", args)
+		name := args[0]
+		number := parseRevision(args[1])
+
+		data, err := backends.ReadLoadoutRevision(name, number)
+		if err != nil {
+			slog.Error("failure reading loadout revision", "loadout", name, "revision", number, "error", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(data)
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback LOADOUT REV",
+	Short: "Restore a revision of a loadout",
+	Long: `Restore a revision of a loadout (see envtab history) as the current
+loadout. The loadout is replaced by the revision as it was stored, so
+encrypted revisions stay encrypted. A removed loadout is restored. The
+rollback is recorded as a new revision, so it can be undone by rolling back
+to the revision before it.`,
+	Example: `  envtab history prod
+  envtab rollback prod 3`,
+	Args:    cobra.ExactArgs(2),
+	PostRun: syncLoginScriptsPostRun,
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("rollback called with args", "args", args)
+		name := args[0]
+		number := parseRevision(args[1])
+
+		if err := backends.RollbackLoadout(name, number); err != nil {
+			slog.Error("failure rolling back loadout", "loadout", name, "revision", number, "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Rolled back loadout [%s] to revision %d\n", name, number)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyShowCmd)
+	rootCmd.AddCommand(rollbackCmd)
+}
+
+// parseRevision returns the revision number rev, exiting if it is not a number
+func parseRevision(rev string) int {
+	number, err := strconv.Atoi(rev)
+	if err != nil || number < 1 {
+		slog.Error("invalid revision, expected a revision number from envtab history", "revision", rev)
+		os.Exit(1)
+	}
+	return number
+}
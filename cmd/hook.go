@@ -0,0 +1,283 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/gmherb/envtab/internal/config"
+	"github.com/gmherb/envtab/internal/env"
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/gmherb/envtab/internal/shell"
+	"github.com/spf13/cobra"
+)
+
+// Variables recording what the shell hook activated
+const (
+	// hookStateVar records the hookState of the project the hook last acted on
+	hookStateVar = "ENVTAB_HOOK_STATE"
+	// hookLoadoutsVar lists the loadouts activated by the hook, for prompts
+	hookLoadoutsVar = "ENVTAB_HOOK_LOADOUTS"
+)
+
+// hookState is what the hook records in hookStateVar when it enters a project
+type hookState struct {
+	// Project identifies the project config, its trust state and loadouts,
+	// so prompts without changes print nothing
+	Project string `json:"project"`
+	// Previous maps the variables the hook set to their values before it
+	// entered the project, or nil for variables that were unset, so leaving
+	// the project restores them
+	Previous map[string]*string `json:"previous,omitempty"`
+}
+
+// readHookState returns the state recorded in hookStateVar
+func readHookState() hookState {
+	var state hookState
+	if value := os.Getenv(hookStateVar); value != "" {
+		if err := json.Unmarshal([]byte(value), &state); err != nil {
+			slog.Warn("ignoring invalid "+hookStateVar, "error", err)
+			return hookState{}
+		}
+	}
+	return state
+}
+
+// hookScripts are the hook definitions per dialect. %[1]s is the quoted path
+// to envtab and %[2]s the dialect.
+var hookScripts = map[shell.Shell]string{
+	shell.Bash: `_envtab_hook() {
+  local previous_exit_status=$?
+  eval "$(%[1]s hook %[2]s --apply)"
+  return $previous_exit_status
+}
+if [[ ";${PROMPT_COMMAND:-};" != *";_envtab_hook;"* ]]; then
+  PROMPT_COMMAND="_envtab_hook${PROMPT_COMMAND:+;$PROMPT_COMMAND}"
+fi
+`,
+	shell.Zsh: `_envtab_hook() {
+  eval "$(%[1]s hook %[2]s --apply)"
+}
+typeset -ag precmd_functions chpwd_functions
+if (( ! ${precmd_functions[(I)_envtab_hook]} )); then
+  precmd_functions=(_envtab_hook $precmd_functions)
+fi
+if (( ! ${chpwd_functions[(I)_envtab_hook]} )); then
+  chpwd_functions=(_envtab_hook $chpwd_functions)
+fi
+`,
+	shell.Fish: `function __envtab_hook --on-event fish_prompt --on-variable PWD
+    %[1]s hook %[2]s --apply | source
+end
+`,
+}
+
+var hookCmd = &cobra.Command{
+	Use:   "hook SHELL",
+	Short: "Print the shell hook activating project loadouts",
+	Long: `Print a hook for bash, zsh or fish that activates the loadouts declared
+by the project config (.envtab.yaml) of the current directory or its parents.
+
+List the loadouts under the loadouts key of .envtab.yaml:
+
+  loadouts:
+    - monorepo
+    - aws-dev
+
+When you enter the project, the hook exports the loadouts and records the
+previous values of the variables they set in ENVTAB_HOOK_STATE. When you leave
+it, or enter another project, those variables get their previous values back,
+and the ones that were unset are unset again. The loadouts
+are only activated once the project config is allowed with envtab allow, and
+again whenever it changes, so an untrusted repository cannot set variables.`,
+	Example: `  # ~/.bashrc
+  eval "$(envtab hook bash)"
+
+  # ~/.zshrc
+  eval "$(envtab hook zsh)"
+
+  # ~/.config/fish/config.fish
+  envtab hook fish | source`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{string(shell.Bash), string(shell.Zsh), string(shell.Fish)},
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("hook called", "args", args)
+
+		sh, err := shell.Parse(args[0])
+		if err != nil {
+			slog.Error("invalid shell", "error", err)
+			os.Exit(1)
+		}
+		script, ok := hookScripts[sh]
+		if !ok {
+			slog.Error("shell hook is not supported", "shell", sh, "supported", "bash, zsh, fish")
+			os.Exit(1)
+		}
+
+		if apply, _ := cmd.Flags().GetBool("apply"); apply {
+			applyHook(cmd.Context(), sh)
+			return
+		}
+
+		execPath, err := os.Executable()
+		if err != nil {
+			slog.Error("failure getting executable path", "error", err)
+			os.Exit(1)
+		}
+		if execPath, err = filepath.Abs(execPath); err != nil {
+			slog.Error("failure getting absolute path", "error", err)
+			os.Exit(1)
+		}
+		quoted, err := sh.Quote(execPath)
+		if err != nil {
+			slog.Error("failure quoting executable path", "error", err)
+			os.Exit(1)
+		}
+		fmt.Printf(script, quoted, sh)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(hookCmd)
+	hookCmd.Flags().Bool("apply", false, "Print the statements activating the current project (used by the hook)")
+	hookCmd.Flags().MarkHidden("apply")
+}
+
+// hookProject is the project containing the current directory as seen by the hook
+type hookProject struct {
+	// state identifies the project config, its trust state and loadouts
+	state string
+	// loadouts are the loadouts to activate, empty unless the config is allowed
+	loadouts []string
+	// notice explains why the loadouts of the project are not activated
+	notice string
+}
+
+// currentProject returns the project containing the current directory.
+// Loadouts of project configs that are not allowed are not activated.
+func currentProject() hookProject {
+	projectConfig := config.FindProjectConfig()
+	if projectConfig == "" {
+		return hookProject{}
+	}
+
+	names, err := config.ProjectLoadouts(projectConfig)
+	if err != nil {
+		slog.Debug("failure reading project config", "path", projectConfig, "error", err)
+		return hookProject{
+			state:  projectConfig + "|invalid",
+			notice: fmt.Sprintf("%s is not a valid project config", projectConfig),
+		}
+	}
+	if len(names) == 0 {
+		return hookProject{}
+	}
+
+	trust, err := config.CheckProjectConfig(projectConfig)
+	if err != nil {
+		slog.Debug("failure checking project config", "path", projectConfig, "error", err)
+	}
+	project := hookProject{state: strings.Join([]string{projectConfig, trust.String(), strings.Join(names, ",")}, "|")}
+	switch trust {
+	case config.Allowed:
+		project.loadouts = names
+	case config.Denied:
+	default:
+		project.notice = fmt.Sprintf("%s is %s, run `envtab allow` to activate its loadouts", projectConfig, trust)
+	}
+	return project
+}
+
+// applyHook prints the statements restoring the variables the hook set for
+// the previous project and activating the loadouts of the current project.
+// Nothing is printed while the project and its config are unchanged.
+func applyHook(ctx context.Context, sh shell.Shell) {
+	project := currentProject()
+	state := readHookState()
+	if project.state == state.Project {
+		return
+	}
+	slog.Debug("project changed", "from", state.Project, "to", project.state)
+
+	if project.notice != "" {
+		fmt.Fprintf(os.Stderr, "envtab: %s\n", project.notice)
+	}
+
+	environment := env.NewEnv()
+	environment.Populate()
+	restorePrevious(os.Stdout, sh, environment, state.Previous)
+
+	activated := []string{}
+	for _, name := range project.loadouts {
+		if !backends.LoadoutExists(name) {
+			fmt.Fprintf(os.Stderr, "envtab: loadout %s declared by the project config does not exist\n", name)
+			continue
+		}
+		activated = append(activated, name)
+	}
+
+	next := hookState{Project: project.state, Previous: map[string]*string{}}
+	if len(activated) > 0 {
+		loadouts := readLoadouts(activated)
+		resolved := resolveLoadoutsIn(ctx, loadouts, environment.Env)
+		for _, v := range resolved.Vars {
+			if previous, ok := environment.Env[v.Key]; ok {
+				next.Previous[v.Key] = &previous
+			} else {
+				next.Previous[v.Key] = nil
+			}
+		}
+		if err := (loadout.ShellRenderer{Shell: sh}).Render(os.Stdout, resolved); err != nil {
+			slog.Error("skipping entries that cannot be exported", "error", err)
+		}
+		markLoaded(loadouts)
+	}
+
+	value := ""
+	if next.Project != "" || len(next.Previous) > 0 {
+		data, err := json.Marshal(next)
+		if err != nil {
+			slog.Error("failure encoding hook state", "error", err)
+			return
+		}
+		value = string(data)
+	}
+	printStateVar(sh, hookStateVar, value)
+	printStateVar(sh, hookLoadoutsVar, strings.Join(activated, ","))
+}
+
+// restorePrevious writes the statements giving the variables in previous back
+// the values they had before the hook entered a project, unsetting those that
+// were unset, and updates environment accordingly
+func restorePrevious(w io.Writer, sh shell.Shell, environment *env.Env, previous map[string]*string) {
+	separators := loadout.ListSeparators()
+
+	keys := make([]string, 0, len(previous))
+	for key := range previous {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var statement string
+		var err error
+		if value := previous[key]; value == nil {
+			statement, err = sh.Unset(key)
+			delete(environment.Env, key)
+		} else {
+			statement, err = sh.ExportWithSeparator(key, separators[key], *value)
+			environment.Env[key] = *value
+		}
+		if err != nil {
+			slog.Error("failure restoring variable", "key", key, "error", err)
+			continue
+		}
+		fmt.Fprintln(w, statement)
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/gmherb/envtab/internal/config"
+	"github.com/gmherb/envtab/internal/env"
+	"github.com/gmherb/envtab/internal/shell"
+)
+
+func TestCurrentProject(t *testing.T) {
+	t.Setenv("ENVTAB_DIR", t.TempDir())
+	dir := t.TempDir()
+	projectConfig := filepath.Join(dir, ".envtab.yaml")
+	if err := os.WriteFile(projectConfig, []byte("loadouts:\n  - mono\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(sub)
+
+	untrusted := currentProject()
+	if untrusted.loadouts != nil || untrusted.notice == "" {
+		t.Errorf("currentProject() = %+v, want no loadouts and a notice", untrusted)
+	}
+
+	if err := config.AllowProjectConfig(projectConfig); err != nil {
+		t.Fatal(err)
+	}
+	allowed := currentProject()
+	if !slices.Equal(allowed.loadouts, []string{"mono"}) || allowed.notice != "" {
+		t.Errorf("currentProject() = %+v, want loadouts [mono]", allowed)
+	}
+	if allowed.state == untrusted.state {
+		t.Error("allowing the project config should change the hook state")
+	}
+
+	if err := config.DenyProjectConfig(projectConfig); err != nil {
+		t.Fatal(err)
+	}
+	if denied := currentProject(); denied.loadouts != nil || denied.notice != "" {
+		t.Errorf("currentProject() = %+v, want no loadouts and no notice", denied)
+	}
+
+	t.Chdir(t.TempDir())
+	if outside := currentProject(); outside.state != "" {
+		t.Errorf("currentProject() = %+v, want no project", outside)
+	}
+}
+
+func TestRestorePrevious(t *testing.T) {
+	environment := env.NewEnv()
+	environment.Env["EDITOR"] = "code"
+	environment.Env["PROJECT_TOKEN"] = "secret"
+
+	vi := "vi"
+	var buf bytes.Buffer
+	restorePrevious(&buf, shell.Bash, environment, map[string]*string{
+		"EDITOR":        &vi,
+		"PROJECT_TOKEN": nil,
+	})
+
+	want := "export EDITOR=vi\nunset PROJECT_TOKEN\n"
+	if buf.String() != want {
+		t.Errorf("restorePrevious() wrote %q, want %q", buf.String(), want)
+	}
+	if environment.Env["EDITOR"] != "vi" {
+		t.Errorf("EDITOR = %q, want vi", environment.Env["EDITOR"])
+	}
+	if _, ok := environment.Env["PROJECT_TOKEN"]; ok {
+		t.Error("PROJECT_TOKEN should be removed from the environment")
+	}
+}
+
+func TestReadHookState(t *testing.T) {
+	t.Setenv(hookStateVar, `{"project":"p","previous":{"EDITOR":"vi","TOKEN":null}}`)
+	state := readHookState()
+	if state.Project != "p" || len(state.Previous) != 2 {
+		t.Fatalf("readHookState() = %+v", state)
+	}
+	if v := state.Previous["EDITOR"]; v == nil || *v != "vi" {
+		t.Errorf("EDITOR previous = %v, want vi", v)
+	}
+	if v, ok := state.Previous["TOKEN"]; !ok || v != nil {
+		t.Errorf("TOKEN previous = %v, %v, want recorded as unset", v, ok)
+	}
+
+	t.Setenv(hookStateVar, "not json")
+	if state := readHookState(); state.Project != "" || state.Previous != nil {
+		t.Errorf("readHookState() = %+v, want empty state for invalid JSON", state)
+	}
+}
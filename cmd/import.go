@@ -47,6 +47,7 @@ full loadout from YAML (.yaml|.yml). Supports local files and HTTP(S) URLs.`,
 		return nil
 	},
 	Aliases: []string{"i", "im", "imp", "import"},
+	PostRun: syncLoginScriptsPostRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		slog.Debug("import called")
 		loadoutName := args[0]
@@ -21,7 +21,8 @@ var listCmd = &cobra.Command{
 	Long: `List all envtab loadouts. Optional glob patterns can be provided to
 narrow results. If multiple patterns are provided, loadouts matching any
 pattern will be shown. If the --long flag is provided, then print the long
-listing format which includes the loadout name, tags, and other metadata.`,
+listing format which includes the loadout name, tags, and other metadata
+such as the priority and after hints that order login and export.`,
 	Example: `  envtab list
   envtab list -l
   envtab list --long
@@ -122,7 +123,7 @@ func ListEnvtabLoadouts(patterns []string) {
 
 		// Print header only when we have at least one matching loadout to display
 		if !headerPrinted {
-			fmt.Fprintf(tw, "UpdatedAt\tLoadedAt\tLogin\tTotal\tActive\tName\tTags\n")
+			fmt.Fprintf(tw, "UpdatedAt\tLoadedAt\tLogin\tPriority\tTotal\tActive\tName\tTags\tAfter\n")
 			headerPrinted = true
 		}
 
@@ -142,9 +143,9 @@ func ListEnvtabLoadouts(patterns []string) {
 			updatedAt = time.Now()
 		}
 
-		if lo.Metadata.LoadedAt != "" {
+		if lastLoaded := backends.LoadoutLoadedAt(loadout, lo); lastLoaded != "" {
 			var err error
-			loadedAt, err = time.Parse(time.RFC3339, lo.Metadata.LoadedAt)
+			loadedAt, err = time.Parse(time.RFC3339, lastLoaded)
 			if err != nil {
 				slog.Warn("invalid loadedAt time, using current time", "loadout", loadout, "error", err)
 				loadedAt = time.Now()
@@ -172,14 +173,16 @@ func ListEnvtabLoadouts(patterns []string) {
 			updatedAtTime = updatedAt.Format(time.TimeOnly)
 		}
 
-		fmt.Fprintf(tw, "%s\t%s\t%t\t%d\t%d\t%s\t%s\n",
+		fmt.Fprintf(tw, "%s\t%s\t%t\t%d\t%d\t%d\t%s\t%s\t%s\n",
 			updatedAtTime,
 			loadedAtTime,
 			lo.Metadata.Login,
+			lo.Metadata.Priority,
 			len(lo.Entries),
 			len(activeEntries),
 			loadout,
-			lo.Metadata.Tags)
+			lo.Metadata.Tags,
+			lo.Metadata.After)
 	}
 	fmt.Fprintln(tw)
 	tw.Flush()
@@ -1,12 +1,18 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
 
 	"github.com/gmherb/envtab/internal/backends"
+	"github.com/gmherb/envtab/internal/env"
+	"github.com/gmherb/envtab/internal/loadout"
 	"github.com/gmherb/envtab/internal/login"
+	"github.com/gmherb/envtab/internal/shell"
 	"github.com/spf13/cobra"
 )
 
@@ -21,16 +27,38 @@ This is typically sourced from a login script such as ~/.profile.
 To setup login automatically, run:
   envtab login --enable
 
+This adds a block fenced by "# >>> envtab >>>" and "# <<< envtab <<<" to the
+login script of your shell (~/.bash_profile, ~/.bash_login or ~/.profile for
+bash, ~/.zprofile for zsh, config.fish for fish and ~/.login for tcsh), or
+updates it in place. Use --shell to select the shell. The login script is
+backed up to <script>.envtab.bak before it is changed.
+
 To disable login, run:
   envtab login --disable
 
+This removes the envtab block from all login scripts.
+
 To show the status of login, run:
-  envtab login --status`,
+  envtab login --status
+
+Login loadouts are exported by metadata.priority, lowest first, then by name.
+A loadout listing others in metadata.after is exported after them.
+
+With --raw, --enable generates a script in the data directory holding the
+export statements of all login loadouts and sources it from your login
+script instead of running envtab on every login. The script is regenerated
+after add, edit, import, make and remove. It holds decrypted values and merges
+list variables such as PATH with their value at login; segments removed from
+list variables are not removed at login. --status shows the mode and whether
+the script is stale.`,
 	Args:    cobra.NoArgs,
 	Aliases: []string{"lo", "log", "logi"},
 	Example: `  envtab login
+  envtab login --shell fish
   envtab login --status
   envtab login --enable
+  envtab login --enable --raw
+  envtab login --enable --shell fish
   envtab login --disable`,
 	Run: func(cmd *cobra.Command, args []string) {
 		slog.Debug("login called")
@@ -38,24 +66,45 @@ To show the status of login, run:
 		enable, _ := cmd.Flags().GetBool("enable")
 		disable, _ := cmd.Flags().GetBool("disable")
 		status, _ := cmd.Flags().GetBool("status")
+		raw, _ := cmd.Flags().GetBool("raw")
 
+		if enable && raw {
+			sh := getShell(cmd)
+			slog.Debug("enabling raw login", "shell", sh)
+			if err := writeRawLoginScript(cmd.Context(), sh); err != nil {
+				slog.Error("failure generating raw login script", "error", err)
+				os.Exit(1)
+			}
+			if err := login.EnableRaw(sh); err != nil {
+				slog.Error("failure enabling login", "error", err)
+				os.Exit(1)
+			}
+			return
+		}
 		if enable {
-			slog.Debug("enabling login")
-			login.EnableLogin()
+			sh := getShell(cmd)
+			slog.Debug("enabling login", "shell", sh)
+			if err := login.Enable(sh); err != nil {
+				slog.Error("failure enabling login", "error", err)
+				os.Exit(1)
+			}
 			return
 		}
 		if disable {
 			slog.Debug("disabling login")
-			login.DisableLogin()
+			if err := login.Disable(); err != nil {
+				slog.Error("failure disabling login", "error", err)
+				os.Exit(1)
+			}
 			return
 		}
 		if status {
 			slog.Debug("showing status")
-			login.ShowLoginStatus()
+			showLoginStatus()
 			return
 		}
 
-		exportLoginLoadouts()
+		exportLoginLoadouts(cmd.Context(), getShell(cmd))
 	},
 }
 
@@ -64,34 +113,162 @@ func init() {
 	loginCmd.Flags().BoolP("enable", "e", false, "Setup envtab to load on shell login")
 	loginCmd.Flags().BoolP("disable", "d", false, "Remove envtab from your login scripts")
 	loginCmd.Flags().BoolP("status", "s", false, "Show the status of envtab in your login scripts")
+	loginCmd.Flags().Bool("raw", false, "With --enable, source a generated script instead of running envtab on login")
 	loginCmd.MarkFlagsMutuallyExclusive("enable", "disable", "status")
+	addShellFlag(loginCmd)
 }
 
-func exportLoginLoadouts() {
-	loadouts, err := backends.ListLoadouts()
+func exportLoginLoadouts(ctx context.Context, sh shell.Shell) {
+	loginLoadouts, err := readLoginLoadouts()
 	if err != nil {
-		slog.Error("failure listing loadouts", "error", err)
+		slog.Error("failure reading login loadouts", "error", err)
 		os.Exit(1)
 	}
 
-	for _, loadout := range loadouts {
-		lo, err := backends.ReadLoadout(loadout)
+	environment := env.NewEnv()
+	environment.Populate()
+
+	resolved := resolveLoadoutsIn(ctx, loginLoadouts, environment.Env)
+	if err := (loadout.ShellRenderer{Shell: sh}).Render(os.Stdout, resolved); err != nil {
+		slog.Error("skipping entries that cannot be exported", "error", err)
+	}
+	printAddedSegments(sh, environment.Env, resolved)
+
+	markLoaded(loginLoadouts)
+}
+
+// readLoginLoadouts reads the loadouts enabled on login. Encrypted loadouts
+// are skipped if SOPS is not installed.
+func readLoginLoadouts() ([]*loadout.Loadout, error) {
+	names, err := backends.ListLoadouts()
+	if err != nil {
+		return nil, err
+	}
+
+	loginLoadouts := []*loadout.Loadout{}
+	for _, name := range names {
+		lo, err := backends.ReadLoadout(name)
 		if err != nil {
-			// Skip loadout if SOPS is not installed (for encrypted loadouts)
-			errStr := err.Error()
-			if strings.Contains(errStr, "SOPS_NOT_INSTALLED") {
-				slog.Warn("skipping loadout - SOPS not installed", "loadout", loadout)
+			if strings.Contains(err.Error(), "SOPS_NOT_INSTALLED") {
+				slog.Warn("skipping loadout - SOPS not installed", "loadout", name)
 				continue
 			}
-			slog.Error("failure reading loadout", "loadout", loadout, "error", err)
-			os.Exit(1)
+			return nil, fmt.Errorf("failed to read loadout %s: %w", name, err)
 		}
+		lo.Name = name
 
 		if lo.Metadata.Login {
-			slog.Debug("loadout has login enabled", "loadout", loadout)
-			lo.Export()
+			slog.Debug("loadout has login enabled", "loadout", name)
+			loginLoadouts = append(loginLoadouts, lo)
 		} else {
-			slog.Debug("loadout has login disabled", "loadout", loadout)
+			slog.Debug("loadout has login disabled", "loadout", name)
 		}
 	}
+	return loginLoadouts, nil
+}
+
+// expandLoginLoadouts returns the login loadouts in export order with the
+// loadouts they include
+func expandLoginLoadouts() ([]*loadout.Loadout, error) {
+	loginLoadouts, err := readLoginLoadouts()
+	if err != nil {
+		return nil, err
+	}
+	ordered, err := loadout.OrderLoadouts(loginLoadouts)
+	if err != nil {
+		return nil, err
+	}
+	return loadout.ExpandAllIncludes(ordered, backends.ReadLoadout)
+}
+
+// loginFingerprint returns the fingerprint of the login loadouts and the
+// loadouts they include
+func loginFingerprint() (string, error) {
+	expanded, err := expandLoginLoadouts()
+	if err != nil {
+		return "", err
+	}
+	return loadout.Fingerprint(expanded), nil
+}
+
+// showLoginStatus prints whether login is enabled, where and in which mode.
+// In raw mode it also prints whether the raw login script is stale.
+func showLoginStatus() {
+	status, err := login.GetStatus()
+	if err != nil {
+		slog.Error("failure reading login status", "error", err)
+		os.Exit(1)
+	}
+	if !status.Enabled {
+		fmt.Println("disabled")
+		return
+	}
+
+	fmt.Println("enabled")
+	fmt.Printf("mode: %s\n", status.Mode)
+	fmt.Printf("login script: %s\n", status.LoginScript)
+	if status.Mode != login.ModeRaw {
+		return
+	}
+
+	fmt.Printf("raw script: %s\n", login.RawScriptPath(status.Shell))
+	generated, err := login.RawScriptFingerprint(status.Shell)
+	if os.IsNotExist(err) {
+		fmt.Println("stale: true (raw script is missing)")
+		return
+	} else if err != nil {
+		slog.Warn("failure reading raw login script", "script", login.RawScriptPath(status.Shell), "error", err)
+		fmt.Println("stale: true")
+		return
+	}
+	current, err := loginFingerprint()
+	if err != nil {
+		slog.Error("failure reading login loadouts", "error", err)
+		os.Exit(1)
+	}
+	fmt.Printf("stale: %t\n", generated != current)
+}
+
+// writeRawLoginScript generates the raw login script for sh from the login
+// loadouts. List variables are merged with their value when the script is
+// sourced rather than the current value.
+func writeRawLoginScript(ctx context.Context, sh shell.Shell) error {
+	expanded, err := expandLoginLoadouts()
+	if err != nil {
+		return err
+	}
+
+	environment := env.NewEnv()
+	environment.Populate()
+
+	resolved, warnings, err := loadout.ResolveAll(ctx, expanded, loadout.ScriptBase(environment.Env))
+	for _, w := range warnings {
+		slog.Warn("skipping entry", "loadout", w.Source, "key", w.Key, "reason", w.Message, "error", w.Err)
+	}
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := (loadout.ScriptRenderer{Shell: sh}).Render(&buf, resolved); err != nil {
+		slog.Warn("skipping entries that cannot be exported", "error", err)
+	}
+	return login.WriteRawScript(sh, loadout.Fingerprint(expanded), buf.Bytes())
+}
+
+// syncLoginScripts regenerates the raw login scripts after loadouts change.
+// Failures are logged without failing the command that changed the loadouts.
+func syncLoginScripts(ctx context.Context) {
+	for _, sh := range login.RawScripts() {
+		slog.Debug("regenerating raw login script", "shell", sh)
+		if err := writeRawLoginScript(ctx, sh); err != nil {
+			slog.Warn("failure regenerating raw login script, run envtab login --enable --raw", "script", login.RawScriptPath(sh), "error", err)
+		}
+	}
+}
+
+// syncLoginScriptsPostRun regenerates the raw login scripts after commands
+// that change loadouts
+func syncLoginScriptsPostRun(cmd *cobra.Command, args []string) {
+	syncLoginScripts(cmd.Context())
 }
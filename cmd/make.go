@@ -35,6 +35,7 @@ You can also create custom templates in ENVTAB_DIR/templates/ (defaults to $XDG_
 	Args:       cobra.ExactArgs(2),
 	SuggestFor: []string{"create", "new"},
 	Aliases:    []string{"m", "mk", "ma", "mak"},
+	PostRun:    syncLoginScriptsPostRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		slog.Debug("make called")
 
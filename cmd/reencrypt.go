@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/gmherb/envtab/internal/sops"
+	"github.com/spf13/cobra"
+)
+
+var reencryptCmd = &cobra.Command{
+	Use:   "reencrypt [LOADOUT...]",
+	Short: "Re-encrypt loadouts with current keys",
+	Long: `Re-encrypt loadouts after rotating encryption keys.
+
+The data key of file-encrypted loadouts is rotated (sops rotate), and every
+value-encrypted entry (SOPS:) is decrypted and encrypted again against the
+current .sops.yaml creation rules, including entries inside file-encrypted
+loadouts. Decrypting requires access to the keys the loadouts were encrypted
+with, and bypasses the envtab agent so every key is checked.
+
+Loadouts or entries that cannot be decrypted are left unchanged and reported,
+and envtab exits with an error. With --dry-run, loadouts are only decrypted
+to report what would be re-encrypted.`,
+	Example: `  envtab reencrypt prod
+  envtab reencrypt --all --dry-run
+  envtab reencrypt --all`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		all, _ := cmd.Flags().GetBool("all")
+		if all && len(args) > 0 {
+			return fmt.Errorf("provide LOADOUT names or --all, not both")
+		}
+		if !all && len(args) == 0 {
+			return fmt.Errorf("provide at least one LOADOUT or --all")
+		}
+		return nil
+	},
+	PostRun: syncLoginScriptsPostRun,
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("reencrypt called with args", "args", args)
+		all, _ := cmd.Flags().GetBool("all")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		names := args
+		if all {
+			var err error
+			if names, err = backends.ListLoadouts(); err != nil {
+				slog.Error("failure listing loadouts", "error", err)
+				os.Exit(1)
+			}
+			slices.Sort(names)
+		}
+
+		// Cached values would hide keys that are no longer available
+		sops.DisableCache()
+
+		failures := []string{}
+		for _, name := range names {
+			if failure := reencryptLoadout(name, dryRun, !all); failure != "" {
+				failures = append(failures, failure)
+			}
+		}
+
+		if len(failures) > 0 {
+			fmt.Fprintln(os.Stderr, "Could not re-encrypt:")
+			for _, failure := range failures {
+				fmt.Fprintf(os.Stderr, "  %s\n", failure)
+			}
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(reencryptCmd)
+	reencryptCmd.Flags().BoolP("all", "a", false, "Re-encrypt all loadouts")
+	reencryptCmd.Flags().BoolP("dry-run", "n", false, "Report what would be re-encrypted without changing loadouts")
+}
+
+// reencryptLoadout rotates the data key of a file-encrypted loadout and
+// re-encrypts its value-encrypted entries, printing what was done. Loadouts
+// without encryption are only reported if verbose is set. Returns a
+// description of what could not be re-encrypted, or an empty string.
+func reencryptLoadout(name string, dryRun bool, verbose bool) string {
+	if !backends.LoadoutExists(name) {
+		return fmt.Sprintf("%s: loadout does not exist", name)
+	}
+	fileEncrypted := backends.IsLoadoutFileEncrypted(name)
+
+	lo, err := backends.ReadLoadout(name)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", name, err)
+	}
+
+	rotated, failed := lo.RotateSOPSValues(dryRun)
+
+	if !fileEncrypted && len(rotated) == 0 && len(failed) == 0 {
+		if verbose {
+			fmt.Printf("Loadout [%s] has no encrypted values\n", name)
+		}
+		return ""
+	}
+
+	done := []string{}
+	if fileEncrypted {
+		done = append(done, "data key")
+	}
+	if len(rotated) > 0 {
+		done = append(done, fmt.Sprintf("%d value(s): %s", len(rotated), strings.Join(rotated, ", ")))
+	}
+
+	if !dryRun {
+		var err error
+		switch {
+		case len(rotated) > 0:
+			// Encrypting the file again also gives it a new data key
+			err = backends.WriteLoadoutWithEncryption(name, lo, fileEncrypted)
+		case fileEncrypted:
+			err = backends.RotateLoadoutDataKey(name)
+		}
+		if err != nil {
+			return fmt.Sprintf("%s: %v", name, err)
+		}
+	}
+
+	if len(done) > 0 {
+		verb := "Re-encrypted"
+		if dryRun {
+			verb = "Would re-encrypt"
+		}
+		fmt.Printf("%s loadout [%s] (%s)\n", verb, name, strings.Join(done, "; "))
+	}
+
+	if len(failed) > 0 {
+		keys := []string{}
+		for key := range failed {
+			keys = append(keys, key)
+			slog.Debug("failure re-encrypting value", "loadout", name, "key", key, "error", failed[key])
+		}
+		slices.Sort(keys)
+		return fmt.Sprintf("%s: cannot decrypt or encrypt %s: %v", name, strings.Join(keys, ", "), failed[keys[0]])
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/gmherb/envtab/internal/sops"
+)
+
+func TestReencryptFileEncryptedValues(t *testing.T) {
+	fakeSOPS(t)
+	setupEncryption(t)
+
+	encrypted, err := sops.SOPSEncryptValue("key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lo := loadout.InitLoadout()
+	lo.Entries["API_KEY"] = encrypted
+	lo.Entries["REGION"] = "eu-west-1"
+	if err := backends.WriteLoadoutWithEncryption("prod", lo, true); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(backends.GetLoadoutFilePath("prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failure := reencryptLoadout("prod", true, true); failure != "" {
+		t.Fatalf("reencryptLoadout() with dry run = %s", failure)
+	}
+	if after, _ := os.ReadFile(backends.GetLoadoutFilePath("prod")); string(after) != string(before) {
+		t.Error("dry run should not change the loadout")
+	}
+
+	if failure := reencryptLoadout("prod", false, true); failure != "" {
+		t.Fatalf("reencryptLoadout() = %s", failure)
+	}
+	if !backends.IsLoadoutFileEncrypted("prod") {
+		t.Error("loadout should stay file-encrypted")
+	}
+	got, err := backends.ReadLoadout("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := got.Entries["API_KEY"]
+	if !strings.HasPrefix(value, "SOPS:") || value == encrypted {
+		t.Errorf("API_KEY = %q, want it re-encrypted", value)
+	}
+	if decrypted, err := sops.SOPSDecryptValue(value); err != nil || decrypted != "key" {
+		t.Errorf("SOPSDecryptValue(API_KEY) = %q, %v, want key", decrypted, err)
+	}
+	if got.Entries["REGION"] != "eu-west-1" {
+		t.Errorf("REGION = %q, want it kept", got.Entries["REGION"])
+	}
+}
@@ -16,6 +16,7 @@ var removeCmd = &cobra.Command{
 	Args:       cobra.MinimumNArgs(1),
 	SuggestFor: []string{"delete", "del"},
 	Aliases:    []string{"r", "rm"},
+	PostRun:    syncLoginScriptsPostRun,
 	Run: func(cmd *cobra.Command, args []string) {
 		slog.Debug("remove called")
 		for _, loadout := range args {
@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/gmherb/envtab/internal/config"
@@ -20,6 +22,10 @@ const (
 	ENVTAB_CONFIG_TYPE = "yaml"
 )
 
+// projectConfigNotice explains why the project config's settings are ignored.
+// It is printed before running a command.
+var projectConfigNotice string
+
 // Version information set at build time via ldflags
 var (
 	Version   string
@@ -61,7 +67,7 @@ func init() {
 // Priority order for config file:
 // 1. Command-line flag (--config)
 // 2. Environment variable (ENVTAB_CONFIG)
-// 3. Project config: CWD/.envtab.yaml and walk up the directory tree
+// 3. Project config: CWD/.envtab.yaml and walk up the directory tree, if allowed
 // 4. User config: $XDG_CONFIG_HOME/envtab/envtab.yaml (if XDG env vars set) or ~/.envtab.yaml (POSIX fallback)
 // 5. System config: /etc/envtab.yaml
 func initConfig() {
@@ -72,8 +78,9 @@ func initConfig() {
 		// 2. Environment variable (ENVTAB_CONFIG)
 		viper.SetConfigFile(envConfig)
 	} else {
-		// 3. Project config: walk up from CWD to find .envtab.yaml
-		projectConfig := config.FindProjectConfig()
+		// 3. Project config: walk up from CWD to find an allowed .envtab.yaml
+		var projectConfig string
+		projectConfig, projectConfigNotice = projectConfigFile()
 		if projectConfig != "" {
 			// Project config uses .envtab.yaml (with dot), so set it explicitly
 			viper.SetConfigFile(projectConfig)
@@ -111,6 +118,36 @@ func initConfig() {
 	})))
 }
 
+// projectConfigFile returns the project config to read settings from, or an
+// empty string if there is none or it has not been allowed with its current
+// content. A project config comes with whatever repository was cloned, so it
+// must not change settings such as sops.path_regex until it is approved. The
+// notice explains why an existing project config is ignored.
+func projectConfigFile() (string, string) {
+	projectConfig := config.FindProjectConfig()
+	if projectConfig == "" {
+		return "", ""
+	}
+
+	trust, err := config.CheckProjectConfig(projectConfig)
+	if err != nil {
+		return "", fmt.Sprintf("ignoring settings of %s: %v", projectConfig, err)
+	}
+	switch trust {
+	case config.Allowed:
+		return projectConfig, ""
+	case config.Denied:
+		slog.Debug("ignoring denied project config", "path", projectConfig)
+		return "", ""
+	default:
+		return "", fmt.Sprintf("ignoring settings of %s, it is %s; run `envtab allow` to apply them", projectConfig, trust)
+	}
+}
+
+// quietCommands do not print the project config notice: the hook prints its
+// own, and allow and deny act on it
+var quietCommands = []string{"hook", "allow", "deny", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd}
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:     "envtab",
@@ -128,6 +165,10 @@ var rootCmd = &cobra.Command{
 			})))
 		}
 		// Otherwise, keep the level set in initConfig() (from config file or env var)
+
+		if projectConfigNotice != "" && !slices.Contains(quietCommands, cmd.Name()) {
+			fmt.Fprintf(os.Stderr, "envtab: %s\n", projectConfigNotice)
+		}
 	},
 }
 
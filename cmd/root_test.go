@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gmherb/envtab/internal/config"
+)
+
+func TestProjectConfigFile(t *testing.T) {
+	t.Setenv("ENVTAB_DIR", t.TempDir())
+	dir := t.TempDir()
+	projectConfig := filepath.Join(dir, ".envtab.yaml")
+	if err := os.WriteFile(projectConfig, []byte("sops:\n  path_regex: .*\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	if path, notice := projectConfigFile(); path != "" || !strings.Contains(notice, "untrusted") {
+		t.Errorf("projectConfigFile() = %q, %q, want an untrusted notice", path, notice)
+	}
+
+	if err := config.AllowProjectConfig(projectConfig); err != nil {
+		t.Fatal(err)
+	}
+	if path, notice := projectConfigFile(); path != projectConfig || notice != "" {
+		t.Errorf("projectConfigFile() = %q, %q, want %q", path, notice, projectConfig)
+	}
+
+	// Changing an allowed project config revokes its settings
+	if err := os.WriteFile(projectConfig, []byte("sops:\n  path_regex: nothing\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if path, notice := projectConfigFile(); path != "" || !strings.Contains(notice, "changed") {
+		t.Errorf("projectConfigFile() = %q, %q, want a changed notice", path, notice)
+	}
+
+	if err := config.DenyProjectConfig(projectConfig); err != nil {
+		t.Fatal(err)
+	}
+	if path, notice := projectConfigFile(); path != "" || notice != "" {
+		t.Errorf("projectConfigFile() = %q, %q, want it ignored without notice", path, notice)
+	}
+}
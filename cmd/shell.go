@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/process"
+	"github.com/spf13/cobra"
+)
+
+// activeVar lists the loadouts applied in an envtab subshell
+const activeVar = "ENVTAB_ACTIVE"
+
+var shellCmd = &cobra.Command{
+	Use:   "shell LOADOUT_NAME [LOADOUT_NAME ...]",
+	Short: "Start a subshell with envtab loadout(s) applied",
+	Long: `Start a new $SHELL with the entries of the provided loadouts applied.
+
+Entries are resolved exactly like export. ENVTAB_ACTIVE is set to a comma
+separated list of the loaded loadouts so your prompt can display them.
+Starting a subshell from within a subshell appends to ENVTAB_ACTIVE.
+
+Exiting the subshell discards everything; the parent shell is unchanged.`,
+	Example: `  envtab shell prod-aws
+  envtab shell aws github`,
+	Args:                  cobra.MinimumNArgs(1),
+	DisableFlagsInUseLine: true,
+	SuggestFor:            []string{"subshell", "sh"},
+	Aliases:               []string{"sub"},
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("shell called")
+
+		program := userShell()
+
+		applied := applyLoadouts(cmd.Context(), args)
+		os.Setenv(activeVar, activeLoadouts(os.Getenv(activeVar), applied))
+
+		path, err := exec.LookPath(program)
+		if err != nil {
+			slog.Error("shell not found", "shell", program, "error", err)
+			os.Exit(127)
+		}
+
+		slog.Debug("starting subshell", "shell", path, "active", os.Getenv(activeVar))
+		if err := process.Exec(path, []string{path}, os.Environ()); err != nil {
+			slog.Error("failure starting shell", "shell", path, "error", err)
+			os.Exit(126)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(shellCmd)
+}
+
+// userShell returns the user's shell program from $SHELL, falling back to
+// %COMSPEC% on Windows and /bin/sh everywhere else
+func userShell() string {
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh
+	}
+	if runtime.GOOS == "windows" {
+		if comspec := os.Getenv("COMSPEC"); comspec != "" {
+			return comspec
+		}
+		return "cmd.exe"
+	}
+	return "/bin/sh"
+}
+
+// activeLoadouts appends the applied loadouts to the current ENVTAB_ACTIVE
+// value, skipping loadouts that are already listed
+func activeLoadouts(current string, applied []string) string {
+	active := []string{}
+	seen := map[string]bool{}
+	for _, name := range append(strings.Split(current, ","), applied...) {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		active = append(active, name)
+	}
+	return strings.Join(active, ",")
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import "testing"
+
+func TestActiveLoadouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		applied []string
+		want    string
+	}{
+		{"first subshell", "", []string{"prod", "github"}, "prod,github"},
+		{"nested subshell", "prod", []string{"github"}, "prod,github"},
+		{"already active", "prod,github", []string{"prod"}, "prod,github"},
+		{"nothing applied", "prod", []string{}, "prod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := activeLoadouts(tt.current, tt.applied); got != tt.want {
+				t.Errorf("activeLoadouts() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
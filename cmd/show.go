@@ -18,12 +18,20 @@ import (
 	"golang.org/x/term"
 )
 
+// sensitiveDisplayValue replaces the values of sensitive entries unless decrypted
+const sensitiveDisplayValue = "***sensitive***"
+
+var descriptionColor = color.New(color.FgHiBlack).SprintFunc()
+
 var showCmd = &cobra.Command{
 	Use:   "show [LOADOUT_PATTERN...]",
 	Short: "Show active loadouts",
 	Long: `Show each loadout with active entries (environment variables).
 Optional glob patterns can be provided to filter results.
-If multiple patterns are provided, loadouts matching any pattern will be shown.`,
+If multiple patterns are provided, loadouts matching any pattern will be shown.
+
+Entry descriptions are shown after their values, and values of entries marked
+sensitive are masked unless --decrypt is provided.`,
 	Args:                  cobra.ArbitraryArgs,
 	SuggestFor:            []string{"status"},
 	Aliases:               []string{"s", "sh", "sho"},
@@ -112,10 +120,21 @@ func ShowLoadout(lo string, environment *env.Env, decrypt bool, keyFilter string
 	keyMap := make(map[string]bool)
 	valueMap := make(map[string]bool)
 
+	// Decrypt the SOPS values in one batch, values that cannot be decrypted
+	// are shown encrypted
+	decrypted, failed := sops.SOPSDecryptValues(loStruct.Entries)
+	for key, err := range failed {
+		slog.Error("failed to decrypt value", "loadout", lo, "key", key, "error", err)
+	}
+
 	for entryKey, entryValue := range loStruct.Entries {
 
+		plaintext := entryValue
+		if value, ok := decrypted[entryKey]; ok {
+			plaintext = value
+		}
 		// Get decrypted value for filtering/comparison
-		decryptedValue := sops.SOPSDisplayValue(entryValue, true)
+		decryptedValue := plaintext
 		// Expand variables for filtering/comparison (if not encrypted)
 		if !strings.HasPrefix(decryptedValue, "SOPS:") {
 			decryptedValue = loadout.ExpandVariables(decryptedValue)
@@ -129,15 +148,34 @@ func ShowLoadout(lo string, environment *env.Env, decrypt bool, keyFilter string
 			if decryptedValue == valueFilter {
 				valueMap[entryKey] = true
 			}
-		} else if environment.IsEntryActive(entryKey, entryValue) {
+		} else if environment.IsLoadoutEntryActive(loStruct, entryKey) {
 			activeMap[entryKey] = true
 		}
 
 		if keyMap[entryKey] || valueMap[entryKey] || activeMap[entryKey] || all {
 			// Display the original value with variable references (e.g., $HOME, $PATH)
 			// Don't expand variables in the display - show them as stored
-			displayValue := sops.SOPSDisplayValue(entryValue, decrypt)
-			entries = append(entries, entryKey+"="+displayValue)
+			displayValue := entryValue
+			if decrypt {
+				displayValue = plaintext
+			}
+			spec := loStruct.Spec(entryKey)
+			notes := []string{}
+			if spec.Description != "" {
+				notes = append(notes, spec.Description)
+			}
+			if entryValue == "" && spec.Default != "" {
+				displayValue = spec.Default
+				notes = append(notes, "(default)")
+			}
+			if spec.Sensitive && !decrypt && !strings.HasPrefix(displayValue, "SOPS:") {
+				displayValue = sensitiveDisplayValue
+			}
+			entry := entryKey + "=" + displayValue
+			if len(notes) > 0 {
+				entry += descriptionColor("  # " + strings.Join(notes, " "))
+			}
+			entries = append(entries, entry)
 		}
 
 	}
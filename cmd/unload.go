@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/backends"
+	"github.com/gmherb/envtab/internal/env"
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/gmherb/envtab/internal/shell"
+	"github.com/spf13/cobra"
+)
+
+var unloadCmd = &cobra.Command{
+	Use:   "unload LOADOUT_NAME [LOADOUT_NAME ...]",
+	Short: "Unload envtab loadout(s)",
+	Long: `Print unset statements for the active entries of the provided loadouts
+to be sourced into your environment.
+
+Entries of included loadouts are unloaded too. Only entries that are
+currently active are unset. For list variables such as
+PATH, only the segments contributed by the loadout are removed and the rest of
+the list is kept. Segments that were in the list before the loadout was
+exported are kept too, as recorded by export in ENVTAB_ADDED_SEGMENTS.`,
+	Example: `  eval "$(envtab unload myloadout)"
+  eval "$(envtab unload myloadout1 myloadout2 myloadout3)"
+  envtab unload myloadout --shell fish | source`,
+	Args:                  cobra.MinimumNArgs(1),
+	DisableFlagsInUseLine: true,
+	SuggestFor:            []string{"unset", "unexport"},
+	Aliases:               []string{"u", "un", "unl"},
+	Run: func(cmd *cobra.Command, args []string) {
+		slog.Debug("unload called")
+
+		sh := getShell(cmd)
+
+		environment := env.NewEnv()
+		environment.Populate()
+
+		for _, loadoutName := range args {
+
+			slog.Debug("unloading loadout", "loadout", loadoutName)
+
+			if !backends.LoadoutExists(loadoutName) {
+				slog.Error("loadout does not exist", "loadout", loadoutName)
+				os.Exit(1)
+			}
+
+			lo, err := backends.ReadLoadout(loadoutName)
+			if err != nil {
+				// Skip loadout if SOPS is not installed (for encrypted loadouts)
+				if strings.Contains(err.Error(), "SOPS_NOT_INSTALLED") {
+					slog.Warn("skipping loadout - SOPS not installed", "loadout", loadoutName)
+					continue
+				}
+				slog.Error("failure reading loadout", "loadout", loadoutName, "error", err)
+				os.Exit(1)
+			}
+
+			lo.Name = loadoutName
+
+			unloadLoadout(os.Stdout, sh, environment, lo)
+		}
+
+		if value := environment.Get(env.AddedSegmentsVar); value != os.Getenv(env.AddedSegmentsVar) {
+			printStateVar(sh, env.AddedSegmentsVar, value)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(unloadCmd)
+	addShellFlag(unloadCmd)
+}
+
+// unloadLoadout writes the statements undoing lo and the loadouts it includes
+// in environment, updating environment to match
+func unloadLoadout(w io.Writer, sh shell.Shell, environment *env.Env, lo *loadout.Loadout) {
+	// Entries of included loadouts are unloaded too
+	for _, l := range expandIncludes([]*loadout.Loadout{lo}) {
+		result := environment.Unload(l)
+		updated := make([]string, 0, len(result.Updated))
+		for key := range result.Updated {
+			updated = append(updated, key)
+		}
+		sort.Strings(updated)
+		separators := loadout.ListSeparators()
+		for _, key := range updated {
+			statement, err := sh.ExportWithSeparator(key, separators[key], result.Updated[key])
+			if err != nil {
+				slog.Error("failure restoring list variable", "loadout", l.Name, "key", key, "error", err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(w, statement)
+		}
+		for _, key := range result.Unset {
+			statement, err := sh.Unset(key)
+			if err != nil {
+				slog.Error("skipping entry that cannot be unset", "loadout", l.Name, "key", key, "error", err)
+				continue
+			}
+			fmt.Fprintln(w, statement)
+		}
+	}
+}
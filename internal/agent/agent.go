@@ -0,0 +1,118 @@
+// Package agent implements the envtab agent, a per-user background process
+// caching decrypted SOPS values and files in memory for a limited time, and
+// the client used to query it over its Unix socket.
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/gmherb/envtab/internal/config"
+)
+
+// DefaultTTL is how long decrypted values are cached when the `agent.ttl`
+// config key is not set
+const DefaultTTL = 15 * time.Minute
+
+// Operations of agent requests
+const (
+	OpGet    = "get"
+	OpPut    = "put"
+	OpLock   = "lock"
+	OpStatus = "status"
+	OpStop   = "stop"
+)
+
+// clientTimeout bounds a request to the agent, so a stuck agent never
+// blocks a command for long
+const clientTimeout = 2 * time.Second
+
+// Request is sent by clients, one per connection
+type Request struct {
+	Op string `json:"op"`
+	// Keys are looked up by get
+	Keys []string `json:"keys,omitempty"`
+	// Values are cached by put, by key
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// Response is the agent's answer to a request
+type Response struct {
+	// Values are the cached values found by get, by key
+	Values map[string]string `json:"values,omitempty"`
+	// Entries is the number of cached values, or the number wiped by lock
+	Entries int    `json:"entries"`
+	TTL     string `json:"ttl,omitempty"`
+	PID     int    `json:"pid,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CacheKey returns the key a decrypted value is cached under, the hash of
+// its encrypted form, so the agent never sees encrypted values or names
+func CacheKey(encrypted []byte) string {
+	sum := sha256.Sum256(encrypted)
+	return hex.EncodeToString(sum[:])
+}
+
+// Call sends a request to the agent listening on the socket of
+// config.GetAgentSocketPath and returns its response
+func Call(req Request) (Response, error) {
+	return call(config.GetAgentSocketPath(), req)
+}
+
+func call(socketPath string, req Request) (Response, error) {
+	var resp Response
+	conn, err := net.DialTimeout("unix", socketPath, clientTimeout)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clientTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return resp, err
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return resp, err
+	}
+	if resp.Error != "" {
+		return resp, fmt.Errorf("agent: %s", resp.Error)
+	}
+	return resp, nil
+}
+
+// Running reports whether an agent is listening on the socket
+func Running() bool {
+	_, err := Call(Request{Op: OpStatus})
+	return err == nil
+}
+
+// Get returns the values cached by the agent for keys. It returns nothing
+// when no agent is running.
+func Get(keys []string) map[string]string {
+	if len(keys) == 0 {
+		return nil
+	}
+	resp, err := Call(Request{Op: OpGet, Keys: keys})
+	if err != nil {
+		slog.Debug("envtab agent not available", "error", err)
+		return nil
+	}
+	slog.Debug("envtab agent lookup", "requested", len(keys), "found", len(resp.Values))
+	return resp.Values
+}
+
+// Put caches values by key in the agent, if one is running
+func Put(values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+	if _, err := Call(Request{Op: OpPut, Values: values}); err != nil {
+		slog.Debug("envtab agent not available", "error", err)
+	}
+}
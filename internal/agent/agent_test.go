@@ -0,0 +1,82 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServer(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "envtab", "agent.sock")
+	t.Setenv("ENVTAB_AGENT_SOCK", socketPath)
+
+	if Running() || Get([]string{"key"}) != nil {
+		t.Fatal("agent should not be running yet")
+	}
+	// Without an agent, putting values does nothing
+	Put(map[string]string{"key": "value"})
+
+	l, err := Listen(socketPath)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("socket permissions = %o, want 600", perm)
+	}
+
+	done := make(chan error)
+	go func() { done <- NewServer(time.Hour).Serve(context.Background(), l) }()
+
+	if _, err := Listen(socketPath); err == nil {
+		t.Error("Listen() should fail while an agent is running")
+	}
+
+	key := CacheKey([]byte("SOPS:encrypted"))
+	Put(map[string]string{key: "secret"})
+	if got := Get([]string{key, "missing"}); len(got) != 1 || got[key] != "secret" {
+		t.Errorf("Get() = %v, want %s=secret", got, key)
+	}
+
+	if resp, err := Call(Request{Op: OpStatus}); err != nil || resp.Entries != 1 || resp.TTL != "1h0m0s" || resp.PID != os.Getpid() {
+		t.Errorf("status = %+v, %v", resp, err)
+	}
+	if resp, err := Call(Request{Op: OpLock}); err != nil || resp.Entries != 1 {
+		t.Errorf("lock = %+v, %v, want 1 entry wiped", resp, err)
+	}
+	if got := Get([]string{key}); len(got) != 0 {
+		t.Errorf("Get() after lock = %v, want nothing", got)
+	}
+	if _, err := Call(Request{Op: "unknown"}); err == nil {
+		t.Error("an unknown operation should fail")
+	}
+
+	if _, err := Call(Request{Op: OpStop}); err != nil {
+		t.Fatalf("stop error = %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve() did not return after stop")
+	}
+	if Running() {
+		t.Error("agent still running after stop")
+	}
+}
+
+func TestServerExpiry(t *testing.T) {
+	s := NewServer(time.Millisecond)
+	s.Handle(Request{Op: OpPut, Values: map[string]string{"key": "value"}})
+	time.Sleep(5 * time.Millisecond)
+	if resp := s.Handle(Request{Op: OpGet, Keys: []string{"key"}}); len(resp.Values) != 0 {
+		t.Errorf("get = %v, want the value expired", resp.Values)
+	}
+}
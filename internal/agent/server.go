@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// entry is a cached value and the time it expires
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+// Server caches decrypted values in memory, each for ttl after it was put
+type Server struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]entry
+	stop    context.CancelFunc
+}
+
+// NewServer returns a server caching values for ttl
+func NewServer(ttl time.Duration) *Server {
+	return &Server{ttl: ttl, entries: map[string]entry{}}
+}
+
+// Listen creates the agent socket, readable and writable by the user only.
+// A socket left behind by an agent that is no longer running is replaced.
+func Listen(socketPath string) (net.Listener, error) {
+	if _, err := call(socketPath, Request{Op: OpStatus}); err == nil {
+		return nil, fmt.Errorf("an envtab agent is already running on %s", socketPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// Create the socket without group or other permissions from the start
+	mask := umask(0077)
+	l, err := net.Listen("unix", socketPath)
+	umask(mask)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve answers requests on l until ctx is done or a stop request is
+// received, then wipes the cache and closes l
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	ctx, s.stop = context.WithCancel(ctx)
+	defer s.stop()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	go s.expire(ctx)
+
+	// Requests in flight are answered before the cache is wiped
+	var wg sync.WaitGroup
+	defer s.lock()
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle answers the request of a connection
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clientTimeout))
+
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		slog.Debug("invalid agent request", "error", err)
+		return
+	}
+	resp := s.Handle(req)
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		slog.Debug("failure answering agent request", "error", err)
+	}
+	if req.Op == OpStop && s.stop != nil {
+		s.stop()
+	}
+}
+
+// Handle returns the response to a request
+func (s *Server) Handle(req Request) Response {
+	slog.Debug("agent request", "op", req.Op, "keys", len(req.Keys), "values", len(req.Values))
+	switch req.Op {
+	case OpGet:
+		return Response{Values: s.get(req.Keys)}
+	case OpPut:
+		s.put(req.Values)
+		return Response{}
+	case OpLock:
+		return Response{Entries: s.lock()}
+	case OpStatus, OpStop:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return Response{Entries: len(s.entries), TTL: s.ttl.String(), PID: os.Getpid()}
+	}
+	return Response{Error: fmt.Sprintf("unknown operation %q", req.Op)}
+}
+
+func (s *Server) get(keys []string) map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := map[string]string{}
+	now := time.Now()
+	for _, key := range keys {
+		if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+			values[key] = e.value
+		}
+	}
+	return values
+}
+
+func (s *Server) put(values map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires := time.Now().Add(s.ttl)
+	for key, value := range values {
+		s.entries[key] = entry{value: value, expires: expires}
+	}
+}
+
+// lock wipes the cache, returning the number of values wiped
+func (s *Server) lock() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.entries)
+	s.entries = map[string]entry{}
+	return n
+}
+
+// expire removes expired values until ctx is done
+func (s *Server) expire(ctx context.Context) {
+	interval := min(s.ttl, time.Minute)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			for key, e := range s.entries {
+				if !now.Before(e.expires) {
+					delete(s.entries, key)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+
+package agent
+
+import "syscall"
+
+// umask sets the file mode creation mask, returning the previous mask
+func umask(mask int) int {
+	return syscall.Umask(mask)
+}
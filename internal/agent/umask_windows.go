@@ -0,0 +1,8 @@
+//go:build windows
+
+package agent
+
+// umask is a no-op on Windows, where socket files have no mode bits
+func umask(mask int) int {
+	return 0
+}
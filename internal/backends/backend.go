@@ -0,0 +1,253 @@
+package backends
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/spf13/viper"
+)
+
+// DefaultBackend is the backend used when the `backend` config key is not set
+const DefaultBackend = "file"
+
+// Backend stores and retrieves loadouts.
+// Implementations must return an error satisfying os.IsNotExist when a
+// loadout does not exist so callers can distinguish missing loadouts.
+type Backend interface {
+	// Name returns the name the backend is registered under
+	Name() string
+	// List returns the names of all stored loadouts
+	List() ([]string, error)
+	// Read returns a loadout, decrypting file-level encryption if needed
+	Read(name string) (*loadout.Loadout, error)
+	// ReadRaw returns the loadout exactly as stored (encrypted files stay encrypted)
+	ReadRaw(name string) ([]byte, error)
+	// Write stores a loadout, optionally encrypting the entire loadout with SOPS
+	Write(name string, lo *loadout.Loadout, fileEncrypted bool) error
+	// Rename moves a loadout to a new name
+	Rename(oldName, newName string) error
+	// Remove deletes a loadout
+	Remove(name string) error
+	// Exists reports whether a loadout is stored under name
+	Exists(name string) bool
+	// IsFileEncrypted reports whether the stored loadout is encrypted as a whole
+	IsFileEncrypted(name string) bool
+}
+
+// KeyRotator is implemented by backends storing file-encrypted loadouts
+type KeyRotator interface {
+	// RotateDataKey re-encrypts a file-encrypted loadout with a new data key
+	RotateDataKey(name string) error
+}
+
+// Factory creates a backend from the current configuration
+type Factory func() (Backend, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes a backend available under name.
+// Registering the same name twice replaces the previous factory.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = factory
+}
+
+// Registered returns the sorted names of all registered backends
+func Registered() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get creates the backend registered under name
+func Get(name string) (Backend, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %s)", name, strings.Join(Registered(), ", "))
+	}
+	return factory()
+}
+
+// Current returns the backend selected by the `backend` config key
+// (ENVTAB_BACKEND env var or config file), defaulting to the file backend
+func Current() (Backend, error) {
+	name := viper.GetString("backend")
+	if name == "" {
+		name = DefaultBackend
+	}
+	slog.Debug("using backend", "backend", name)
+	return Get(name)
+}
+
+// ListLoadouts returns a list of all loadout names in the current backend
+func ListLoadouts() ([]string, error) {
+	b, err := Current()
+	if err != nil {
+		return nil, err
+	}
+	return b.List()
+}
+
+// Read a loadout from the current backend and return a Loadout struct
+// Automatically handles SOPS-encrypted files
+func ReadLoadout(name string) (*loadout.Loadout, error) {
+	b, err := Current()
+	if err != nil {
+		return nil, err
+	}
+	return b.Read(name)
+}
+
+// ReadRawLoadout returns the loadout as stored in the current backend
+// File-level encrypted loadouts are returned encrypted
+func ReadRawLoadout(name string) ([]byte, error) {
+	b, err := Current()
+	if err != nil {
+		return nil, err
+	}
+	return b.ReadRaw(name)
+}
+
+// Write a Loadout struct to the current backend
+func WriteLoadout(name string, lo *loadout.Loadout) error {
+	return WriteLoadoutWithEncryption(name, lo, false)
+}
+
+// WriteLoadoutWithEncryption writes a Loadout struct to the current backend
+// If fileEncrypted is true, encrypts the entire loadout with SOPS
+func WriteLoadoutWithEncryption(name string, lo *loadout.Loadout, fileEncrypted bool) error {
+	b, err := Current()
+	if err != nil {
+		return err
+	}
+	return b.Write(name, lo, fileEncrypted)
+}
+
+// RotateLoadoutDataKey rotates the data key of a file-encrypted loadout in the current backend
+func RotateLoadoutDataKey(name string) error {
+	b, err := Current()
+	if err != nil {
+		return err
+	}
+	r, ok := b.(KeyRotator)
+	if !ok {
+		return fmt.Errorf("the %s backend does not store file-encrypted loadouts", b.Name())
+	}
+	return r.RotateDataKey(name)
+}
+
+// Rename a loadout in the current backend
+func RenameLoadout(oldName, newName string) error {
+	b, err := Current()
+	if err != nil {
+		return err
+	}
+	if err := b.Rename(oldName, newName); err != nil {
+		return err
+	}
+	if err := forgetLoaded(oldName, newName); err != nil {
+		slog.Warn("failure moving loadout load time", "loadout", oldName, "error", err)
+	}
+	return nil
+}
+
+// Remove a loadout from the current backend
+func RemoveLoadout(name string) error {
+	b, err := Current()
+	if err != nil {
+		return err
+	}
+	if err := b.Remove(name); err != nil {
+		return err
+	}
+	if err := forgetLoaded(name, ""); err != nil {
+		slog.Warn("failure removing loadout load time", "loadout", name, "error", err)
+	}
+	return nil
+}
+
+// LoadoutExists checks if a loadout exists in the current backend
+func LoadoutExists(name string) bool {
+	b, err := Current()
+	if err != nil {
+		slog.Debug("failure getting backend", "error", err)
+		return false
+	}
+	return b.Exists(name)
+}
+
+// IsLoadoutFileEncrypted checks if a loadout is encrypted at the file level
+func IsLoadoutFileEncrypted(name string) bool {
+	b, err := Current()
+	if err != nil {
+		slog.Debug("failure getting backend", "error", err)
+		return false
+	}
+	return b.IsFileEncrypted(name)
+}
+
+// Write a key-value pair to a loadout (and optionally any tags)
+func AddEntryToLoadout(name string, key string, value string, tags []string) error {
+
+	// Read the existing entries if loadout exists
+	lo, err := ReadLoadout(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+
+	} else if os.IsNotExist(err) {
+		lo = loadout.InitLoadout()
+	}
+
+	lo.UpdateEntry(key, value)
+	lo.UpdateTags(tags)
+
+	// Preserve SOPS encryption if the loadout was originally encrypted
+	return WriteLoadoutWithEncryption(name, lo, IsLoadoutFileEncrypted(name))
+}
+
+// AddEntryToLoadoutWithSOPS writes a key-value pair to a loadout
+// If fileEncrypted is true, encrypts the entire file with SOPS
+func AddEntryToLoadoutWithSOPS(name string, key string, value string, tags []string, fileEncrypted bool) error {
+
+	// Read the existing entries if loadout exists
+	lo, err := ReadLoadout(name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if os.IsNotExist(err) {
+		lo = loadout.InitLoadout()
+	}
+
+	lo.UpdateEntry(key, value)
+	lo.UpdateTags(tags)
+
+	return WriteLoadoutWithEncryption(name, lo, fileEncrypted)
+}
+
+// HasValueEncryptedEntries checks if a loadout has any value-encrypted entries (SOPS: prefix)
+func HasValueEncryptedEntries(lo *loadout.Loadout) bool {
+	if lo == nil {
+		return false
+	}
+	for _, value := range lo.Entries {
+		if strings.HasPrefix(value, "SOPS:") {
+			return true
+		}
+	}
+	return false
+}
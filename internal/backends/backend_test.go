@@ -0,0 +1,171 @@
+package backends
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/spf13/viper"
+)
+
+// TestMain points the data directory at a temporary directory, so tests
+// writing loadouts and their history do not touch the user's loadouts
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "envtab-backends-test-")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("ENVTAB_DIR", dir)
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestRegistry(t *testing.T) {
+	Register("test-registry", func() (Backend, error) {
+		return NewFileBackend(t.TempDir()), nil
+	})
+
+	found := false
+	for _, name := range Registered() {
+		if name == "test-registry" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Registered() = %v, want it to contain test-registry", Registered())
+	}
+
+	b, err := Get("test-registry")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if b == nil {
+		t.Fatal("Get() returned nil backend")
+	}
+
+	if _, err := Get("does-not-exist"); err == nil {
+		t.Error("Get() should return error for unknown backend")
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	defer viper.Set("backend", "")
+
+	viper.Set("backend", "")
+	b, err := Current()
+	if err != nil {
+		t.Fatalf("Current() error = %v", err)
+	}
+	if b.Name() != DefaultBackend {
+		t.Errorf("Current().Name() = %q, want %q", b.Name(), DefaultBackend)
+	}
+
+	viper.Set("backend", "does-not-exist")
+	if _, err := Current(); err == nil {
+		t.Error("Current() should return error for unknown backend")
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	b := NewFileBackend(t.TempDir())
+
+	lo := loadout.InitLoadout()
+	lo.Entries["TEST_KEY"] = "test_value"
+
+	if b.Exists("test_file_backend") {
+		t.Error("Exists() should return false before write")
+	}
+	if err := b.Write("test_file_backend", lo, false); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !b.Exists("test_file_backend") {
+		t.Error("Exists() should return true after write")
+	}
+
+	names, err := b.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(names) != 1 || names[0] != "test_file_backend" {
+		t.Errorf("List() = %v, want [test_file_backend]", names)
+	}
+
+	if err := b.Rename("test_file_backend", "test_file_backend_renamed"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	readLo, err := b.Read("test_file_backend_renamed")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if readLo.Entries["TEST_KEY"] != "test_value" {
+		t.Errorf("Read() entry = %q, want test_value", readLo.Entries["TEST_KEY"])
+	}
+
+	if _, err := b.Read("test_file_backend"); !os.IsNotExist(err) {
+		t.Errorf("Read() of renamed loadout error = %v, want not exist", err)
+	}
+
+	if err := b.Remove("test_file_backend_renamed"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if b.Exists("test_file_backend_renamed") {
+		t.Error("Exists() should return false after remove")
+	}
+}
+
+func TestMarkLoadoutsLoaded(t *testing.T) {
+	t.Setenv("ENVTAB_DIR", t.TempDir())
+	viper.Set("backend", "")
+
+	lo := loadout.InitLoadout()
+	lo.Metadata.LoadedAt = "2000-01-01T00:00:00Z"
+	lo.Metadata.UpdatedAt = "2000-01-01T00:00:00Z"
+	if err := WriteLoadout("test_mark_loaded", lo); err != nil {
+		t.Fatalf("WriteLoadout() error = %v", err)
+	}
+	before, err := os.ReadFile(GetLoadoutFilePath("test_mark_loaded"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := LoadoutLoadedAt("test_mark_loaded", lo); got != "2000-01-01T00:00:00Z" {
+		t.Errorf("LoadoutLoadedAt() = %q before loading, want the stored loadedAt", got)
+	}
+
+	readLo, err := ReadLoadout("test_mark_loaded")
+	if err != nil {
+		t.Fatalf("ReadLoadout() error = %v", err)
+	}
+	if readLo.Name != "test_mark_loaded" {
+		t.Errorf("ReadLoadout() name = %q, want test_mark_loaded", readLo.Name)
+	}
+	if err := MarkLoadoutsLoaded([]*loadout.Loadout{readLo}); err != nil {
+		t.Fatalf("MarkLoadoutsLoaded() error = %v", err)
+	}
+
+	// The loadout is not rewritten, its load time is recorded separately
+	after, err := os.ReadFile(GetLoadoutFilePath("test_mark_loaded"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("MarkLoadoutsLoaded() rewrote the loadout:\n%s", after)
+	}
+	loadedAt := LoadoutLoadedAt("test_mark_loaded", lo)
+	if loadedAt == "2000-01-01T00:00:00Z" || loadedAt != readLo.Metadata.LoadedAt {
+		t.Errorf("LoadoutLoadedAt() = %q, want the time recorded by MarkLoadoutsLoaded", loadedAt)
+	}
+
+	if err := RenameLoadout("test_mark_loaded", "test_mark_renamed"); err != nil {
+		t.Fatalf("RenameLoadout() error = %v", err)
+	}
+	if got := LoadoutLoadedAt("test_mark_renamed", lo); got != loadedAt {
+		t.Errorf("LoadoutLoadedAt() after rename = %q, want %q", got, loadedAt)
+	}
+	if err := RemoveLoadout("test_mark_renamed"); err != nil {
+		t.Fatalf("RemoveLoadout() error = %v", err)
+	}
+	if loaded, err := readLoaded(); err != nil || len(loaded) != 0 {
+		t.Errorf("load times after remove = %v, %v, want none", loaded, err)
+	}
+}
@@ -3,9 +3,9 @@ package backends
 import (
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
@@ -16,64 +16,46 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
-func GetLoadoutFilePath(name string) string {
-	return filepath.Join(config.InitEnvtab(""), name+".yaml")
+func init() {
+	Register(DefaultBackend, func() (Backend, error) {
+		return NewFileBackend(""), nil
+	})
 }
 
-// Write a key-value pair to a loadout (and optionally any tags)
-func AddEntryToLoadout(name string, key string, value string, tags []string) error {
-
-	// Read the existing entries if file exists
-	lo, err := ReadLoadout(name)
-	if err != nil && !os.IsNotExist(err) {
-		return err
-
-	} else if os.IsNotExist(err) {
-		lo = loadout.InitLoadout()
-	}
-
-	lo.UpdateEntry(key, value)
-	lo.UpdateTags(tags)
-
-	filePath := filepath.Join(config.InitEnvtab(""), name+".yaml")
-
-	// Check if file is SOPS-encrypted to preserve encryption
-	isSOPSEncrypted := false
-	if _, err := os.Stat(filePath); err == nil {
-		isSOPSEncrypted = sops.IsSOPSEncrypted(filePath)
-	}
+// FileBackend stores each loadout as a YAML file in the envtab data directory
+type FileBackend struct {
+	dir string
+}
 
-	// Preserve SOPS encryption if the file was originally encrypted
-	if isSOPSEncrypted {
-		return WriteLoadoutWithEncryption(name, lo, true)
-	}
-	return WriteLoadout(name, lo)
+// NewFileBackend returns a file backend rooted at dir
+// If dir is empty, the envtab data directory from config.InitEnvtab is used
+func NewFileBackend(dir string) *FileBackend {
+	return &FileBackend{dir: dir}
 }
 
-// AddEntryToLoadoutWithSOPS writes a key-value pair to a loadout
-// If fileEncrypted is true, encrypts the entire file with SOPS
-func AddEntryToLoadoutWithSOPS(name string, key string, value string, tags []string, fileEncrypted bool) error {
+// Name returns the name the file backend is registered under
+func (f *FileBackend) Name() string {
+	return DefaultBackend
+}
 
-	// Read the existing entries if file exists
-	lo, err := ReadLoadout(name)
-	if err != nil && !os.IsNotExist(err) {
-		return err
-	} else if os.IsNotExist(err) {
-		lo = loadout.InitLoadout()
-	}
+// Dir returns the directory holding the loadout files, creating it if needed
+func (f *FileBackend) Dir() string {
+	return config.InitEnvtab(f.dir)
+}
 
-	lo.UpdateEntry(key, value)
-	lo.UpdateTags(tags)
+func (f *FileBackend) path(name string) string {
+	return filepath.Join(f.Dir(), name+".yaml")
+}
 
-	return WriteLoadoutWithEncryption(name, lo, fileEncrypted)
+// GetLoadoutFilePath returns the path of a loadout file in the envtab data directory
+func GetLoadoutFilePath(name string) string {
+	return NewFileBackend("").path(name)
 }
 
 // Remove a loadout file
-func RemoveLoadout(name string) error {
-
-	filePath := filepath.Join(config.InitEnvtab(""), name+".yaml")
+func (f *FileBackend) Remove(name string) error {
 
-	err := os.Remove(filePath)
+	err := os.Remove(f.path(name))
 	if err != nil {
 		return err
 	}
@@ -83,9 +65,9 @@ func RemoveLoadout(name string) error {
 
 // Read a loadout from file and return a Loadout struct
 // Automatically handles SOPS-encrypted files
-func ReadLoadout(name string) (*loadout.Loadout, error) {
+func (f *FileBackend) Read(name string) (*loadout.Loadout, error) {
 
-	filePath := filepath.Join(config.InitEnvtab(""), name+".yaml")
+	filePath := f.path(name)
 
 	var content []byte
 	var err error
@@ -171,35 +153,43 @@ func ReadLoadout(name string) (*loadout.Loadout, error) {
 			return nil, fmt.Errorf("failed to parse loadout (tried YAML and JSON): %w", err)
 		}
 	}
+	lo.Name = name
 
 	return &lo, nil
 }
 
-// Rename a loadout file
-func RenameLoadout(oldName, newName string) error {
+// ReadRaw returns the loadout file content without decrypting it
+func (f *FileBackend) ReadRaw(name string) ([]byte, error) {
+	return os.ReadFile(f.path(name))
+}
 
-	oldFilePath := GetLoadoutFilePath(oldName)
-	newFilePath := GetLoadoutFilePath(newName)
+// Rename a loadout file, along with its history
+func (f *FileBackend) Rename(oldName, newName string) error {
 
-	err := os.Rename(oldFilePath, newFilePath)
+	err := os.Rename(f.path(oldName), f.path(newName))
 	if err != nil {
 		return err
 	}
 
+	if _, err := os.Stat(f.historyPath(oldName)); err == nil {
+		if err := os.RemoveAll(f.historyPath(newName)); err != nil {
+			return err
+		}
+		if err := os.Rename(f.historyPath(oldName), f.historyPath(newName)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 // Write a Loadout struct to file
 // If fileEncrypted is true, encrypts the entire file with SOPS
-func WriteLoadout(name string, lo *loadout.Loadout) error {
-	return WriteLoadoutWithEncryption(name, lo, false)
-}
+// The file is replaced atomically, so it is left unchanged if encryption fails
+// The written loadout is recorded as a revision (see Revisions)
+func (f *FileBackend) Write(name string, lo *loadout.Loadout, fileEncrypted bool) error {
 
-// WriteLoadoutWithEncryption writes a Loadout struct to file
-// If fileEncrypted is true, encrypts the entire file with SOPS
-func WriteLoadoutWithEncryption(name string, lo *loadout.Loadout, fileEncrypted bool) error {
-
-	filePath := GetLoadoutFilePath(name)
+	filePath := f.path(name)
 
 	data, err := yaml.Marshal(lo)
 	if err != nil {
@@ -207,151 +197,60 @@ func WriteLoadoutWithEncryption(name string, lo *loadout.Loadout, fileEncrypted
 	}
 
 	if fileEncrypted {
-		encrypted, err := sops.SOPSEncryptFile(filePath)
-		if err != nil {
-			return err
-		}
-
-		err = os.WriteFile(filePath, encrypted, 0600)
-		if err != nil {
-			return err
-		}
-	} else {
-		err = os.WriteFile(filePath, data, 0600)
+		// The new content is encrypted, not the file on disk, which may be
+		// outdated or not exist yet
+		data, err = sops.SOPSEncryptContent(data, filePath)
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
-}
-
-// Enter an interactive session to edit a loadout file
-// Automatically handles SOPS-encrypted files and preserves encryption on save
-func EditLoadout(name string) error {
-
-	filePath := GetLoadoutFilePath(name)
-	tmpDir := config.GetTmpPath()
-	tempFilePath := filepath.Join(tmpDir, name+".tmp")
-
-	isSOPSEncrypted := sops.IsSOPSEncrypted(filePath)
-
-	lo, err := ReadLoadout(name)
-	if err != nil {
+	f.keepCurrent(name)
+	if err := utils.WriteFileAtomic(filePath, data, 0600); err != nil {
 		return err
 	}
 
-	encryptedKeys, err := lo.DecryptSOPSValues()
-	if err != nil {
-		slog.Warn("some SOPS values could not be decrypted", "error", err)
+	if err := f.recordRevision(name, data, historyCommand()); err != nil {
+		slog.Warn("failure recording loadout revision", "loadout", name, "error", err)
 	}
 
-	data, err := yaml.Marshal(lo)
-	if err != nil {
-		return err
-	}
+	return nil
+}
 
-	// Save the original timestamps
-	createdAt := lo.Metadata.CreatedAt
-	loadedAt := lo.Metadata.LoadedAt
+// RotateDataKey re-encrypts a file-encrypted loadout file with a new data key
+// using sops, recording the result as a revision
+func (f *FileBackend) RotateDataKey(name string) error {
+	filePath := f.path(name)
 
-	err = os.WriteFile(tempFilePath, data, 0600)
-	if err != nil {
+	f.keepCurrent(name)
+	if err := sops.SOPSReencryptFile(filePath); err != nil {
 		return err
 	}
 
-	editor := os.Getenv("EDITOR")
-	if editor == "" {
-		editor = "vim"
-	}
-
-	var editedLoadout *loadout.Loadout
-
-	// Loop until valid answer is given or user aborts
-	for {
-
-		// Open the temp file in the editor
-		cmd := exec.Command(editor, tempFilePath)
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		cmd.Run()
-
-		// Read the temp file back into a Loadout struct
-		data, err = os.ReadFile(tempFilePath)
-		if err != nil {
-			return err
-		}
-		defer os.Remove(tempFilePath)
-
-		// Validate YAML for duplicate keys before unmarshaling
-		err = loadout.ValidateLoadoutYAML(data)
-		if err != nil {
-			slog.Error("invalid loadout YAML", "error", err)
-			usersChoice := utils.PromptForAnswer("The file contains duplicate keys. Do you want to continue editing to fix the errors? Enter 'yes' to continue to edit or 'no' to abort and discard changes?")
-			if !usersChoice {
-				return nil
-			}
-			continue // Continue editing
-		}
-
-		// Load yaml file into a Loadout struct
-		editedLoadout = &loadout.Loadout{}
-		err = yaml.Unmarshal(data, editedLoadout)
-
-		// If the contents of the file could not be parsed
-		// Ask the user to continue editing the file or abort
-		if err != nil {
-
-			usersChoice := utils.PromptForAnswer("The file could not be parsed. Do you want to continue editing to try to fix the errors? Enter 'yes' to continue to edit or 'no' to abort and discard changes?")
-			if !usersChoice {
-				return nil
-			}
-		}
-
-		// If the contents of the file could be parsed
-		// Break the loop
-		if err == nil {
-			break
-		}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
 	}
-
-	// Restore the original timestamps
-	editedLoadout.Metadata.CreatedAt = createdAt
-	editedLoadout.Metadata.LoadedAt = loadedAt
-
-	// Only overwrite the loadout when modified
-	if loadout.CompareLoadouts(*lo, *editedLoadout) {
-		editedLoadout.UpdateUpdatedAt()
-
-		// Re-encrypt values that were originally SOPS-encrypted
-		if len(encryptedKeys) > 0 {
-			err := editedLoadout.ReencryptSOPSValues(encryptedKeys)
-			if err != nil {
-				return fmt.Errorf("failed to re-encrypt SOPS values: %w", err)
-			}
-		}
-
-		// Preserve SOPS encryption if the file was originally encrypted
-		if isSOPSEncrypted {
-			return WriteLoadoutWithEncryption(name, editedLoadout, true)
-		}
-		return WriteLoadout(name, editedLoadout)
+	if err := f.recordRevision(name, data, historyCommand()); err != nil {
+		slog.Warn("failure recording loadout revision", "loadout", name, "error", err)
 	}
 	return nil
 }
 
-// ListLoadouts returns a list of all loadout names
-// For file backend, this scans the envtab directory for YAML files
-func ListLoadouts() ([]string, error) {
-	envtabPath := config.InitEnvtab("")
+// List returns a list of all loadout names
+// For file backend, this scans the envtab directory for YAML files, skipping
+// hidden directories such as the loadout history
+func (f *FileBackend) List() ([]string, error) {
+	envtabPath := f.Dir()
 
 	var loadouts []string
-	err := filepath.Walk(envtabPath, func(path string, info os.FileInfo, err error) error {
+	err := filepath.WalkDir(envtabPath, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
+		if d.IsDir() && path != envtabPath && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
 		if filepath.Ext(path) == ".yaml" {
 			loadouts = append(loadouts, filepath.Base(path[:len(path)-5]))
 		}
@@ -364,20 +263,13 @@ func ListLoadouts() ([]string, error) {
 	return loadouts, nil
 }
 
-// IsLoadoutFileEncrypted checks if a loadout file is encrypted at the file level
-func IsLoadoutFileEncrypted(name string) bool {
-	return sops.IsSOPSEncrypted(GetLoadoutFilePath(name))
+// Exists checks if a loadout file exists
+func (f *FileBackend) Exists(name string) bool {
+	_, err := os.Stat(f.path(name))
+	return err == nil
 }
 
-// HasValueEncryptedEntries checks if a loadout has any value-encrypted entries (SOPS: prefix)
-func HasValueEncryptedEntries(lo *loadout.Loadout) bool {
-	if lo == nil {
-		return false
-	}
-	for _, value := range lo.Entries {
-		if strings.HasPrefix(value, "SOPS:") {
-			return true
-		}
-	}
-	return false
+// IsFileEncrypted checks if a loadout file is encrypted at the file level
+func (f *FileBackend) IsFileEncrypted(name string) bool {
+	return sops.IsSOPSEncrypted(f.path(name))
 }
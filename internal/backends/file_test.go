@@ -2,9 +2,12 @@ package backends
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"filippo.io/age"
 	"github.com/gmherb/envtab/internal/config"
 	"github.com/gmherb/envtab/internal/loadout"
 	yaml "gopkg.in/yaml.v2"
@@ -260,6 +263,95 @@ func TestWriteLoadoutWithEncryption(t *testing.T) {
 	}
 }
 
+func TestWriteLoadoutWithEncryptionFailure(t *testing.T) {
+	testLoadoutName := "test_write_encryption_failure"
+
+	defer os.Remove(GetLoadoutFilePath(testLoadoutName))
+
+	lo := loadout.InitLoadout()
+	lo.Entries["TEST_KEY"] = "test_value"
+	if err := WriteLoadout(testLoadoutName, lo); err != nil {
+		t.Fatalf("WriteLoadout() error = %v", err)
+	}
+	before, err := os.ReadFile(GetLoadoutFilePath(testLoadoutName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the sops binary, encryption fails and the loadout is left unchanged
+	t.Setenv("PATH", t.TempDir())
+	lo.Entries["TEST_KEY"] = "new_value"
+	if err := WriteLoadoutWithEncryption(testLoadoutName, lo, true); err == nil {
+		t.Fatal("WriteLoadoutWithEncryption() should fail without sops")
+	}
+	after, err := os.ReadFile(GetLoadoutFilePath(testLoadoutName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("loadout changed after a failed encryption:\n%s", after)
+	}
+	entries, err := os.ReadDir(filepath.Dir(GetLoadoutFilePath(testLoadoutName)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "."+testLoadoutName) {
+			t.Errorf("temporary file %s left behind", entry.Name())
+		}
+	}
+}
+
+func TestWriteLoadoutFileEncrypted(t *testing.T) {
+	if _, err := exec.LookPath("sops"); err != nil {
+		t.Skipf("Skipping test: sops not available: %v", err)
+	}
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+	t.Setenv("ENVTAB_AGENT_SOCK", filepath.Join(t.TempDir(), "agent.sock"))
+	dir := t.TempDir()
+	rules := "creation_rules:\n  - age: " + identity.Recipient().String() + "\n"
+	if err := os.WriteFile(filepath.Join(dir, ".sops.yaml"), []byte(rules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	testLoadoutName := "test_write_file_encrypted"
+	defer os.Remove(GetLoadoutFilePath(testLoadoutName))
+
+	// A new loadout can be created file-encrypted, and later writes keep the new entries
+	lo := loadout.InitLoadout()
+	lo.Entries["KEY1"] = "value1"
+	if err := WriteLoadoutWithEncryption(testLoadoutName, lo, true); err != nil {
+		t.Fatalf("WriteLoadoutWithEncryption() error = %v", err)
+	}
+	if err := AddEntryToLoadoutWithSOPS(testLoadoutName, "KEY2", "value2", nil, true); err != nil {
+		t.Fatalf("AddEntryToLoadoutWithSOPS() error = %v", err)
+	}
+
+	if !IsLoadoutFileEncrypted(testLoadoutName) {
+		t.Fatal("loadout should be file-encrypted")
+	}
+	content, err := os.ReadFile(GetLoadoutFilePath(testLoadoutName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "value1") || strings.Contains(string(content), "value2") {
+		t.Errorf("file-encrypted loadout contains plaintext values:\n%s", content)
+	}
+
+	got, err := ReadLoadout(testLoadoutName)
+	if err != nil {
+		t.Fatalf("ReadLoadout() error = %v", err)
+	}
+	if got.Entries["KEY1"] != "value1" || got.Entries["KEY2"] != "value2" {
+		t.Errorf("entries = %v, want KEY1 and KEY2", got.Entries)
+	}
+}
+
 func TestAddEntryToLoadoutWithSOPS(t *testing.T) {
 	testLoadoutName := "test_add_entry_sops"
 
@@ -0,0 +1,243 @@
+package backends
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/gmherb/envtab/internal/sops"
+	"github.com/gmherb/envtab/internal/utils"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// DefaultHistoryLimit is the number of revisions kept per loadout when the
+// `history.limit` config key is not set
+const DefaultHistoryLimit = 50
+
+// historyDir is the directory of the data directory holding loadout revisions
+const historyDir = ".history"
+
+// Revision is a stored state of a loadout
+type Revision struct {
+	Number int    `json:"number"`
+	Time   string `json:"time"`
+	// Command is the envtab command that wrote the revision, empty if the
+	// loadout was changed outside envtab
+	Command string `json:"command"`
+	// FileEncrypted revisions are stored encrypted as a whole with SOPS
+	FileEncrypted bool `json:"fileEncrypted"`
+}
+
+// History is implemented by backends that keep the revisions of loadouts
+type History interface {
+	// Revisions returns the revisions of a loadout, oldest first
+	Revisions(name string) ([]Revision, error)
+	// ReadRevision returns a revision exactly as stored (encrypted revisions stay encrypted)
+	ReadRevision(name string, number int) ([]byte, error)
+	// Rollback restores a revision as the current loadout, recording it as a new revision
+	Rollback(name string, number int) error
+}
+
+// currentHistory returns the current backend if it keeps history
+func currentHistory() (History, error) {
+	b, err := Current()
+	if err != nil {
+		return nil, err
+	}
+	h, ok := b.(History)
+	if !ok {
+		return nil, fmt.Errorf("the %s backend does not keep loadout history", b.Name())
+	}
+	return h, nil
+}
+
+// LoadoutRevisions returns the revisions of a loadout in the current backend, oldest first
+func LoadoutRevisions(name string) ([]Revision, error) {
+	h, err := currentHistory()
+	if err != nil {
+		return nil, err
+	}
+	return h.Revisions(name)
+}
+
+// ReadLoadoutRevision returns a revision of a loadout in the current backend as stored
+func ReadLoadoutRevision(name string, number int) ([]byte, error) {
+	h, err := currentHistory()
+	if err != nil {
+		return nil, err
+	}
+	return h.ReadRevision(name, number)
+}
+
+// RollbackLoadout restores a revision of a loadout in the current backend
+func RollbackLoadout(name string, number int) error {
+	h, err := currentHistory()
+	if err != nil {
+		return err
+	}
+	return h.Rollback(name, number)
+}
+
+// historyCommand returns the envtab command being run, with the values of
+// KEY=VALUE arguments redacted so revisions do not record secrets
+func historyCommand() string {
+	args := []string{"envtab"}
+	for _, arg := range os.Args[1:] {
+		if key, _, ok := strings.Cut(arg, "="); ok {
+			arg = key + "=***"
+		}
+		args = append(args, arg)
+	}
+	return strings.Join(args, " ")
+}
+
+func (f *FileBackend) historyPath(name string) string {
+	return filepath.Join(f.Dir(), historyDir, name)
+}
+
+func (f *FileBackend) revisionPath(name string, number int) string {
+	return filepath.Join(f.historyPath(name), strconv.Itoa(number)+".yaml")
+}
+
+// Revisions returns the revisions of a loadout, oldest first. Revisions are
+// kept after the loadout is removed.
+func (f *FileBackend) Revisions(name string) ([]Revision, error) {
+	revisions := []Revision{}
+	data, err := os.ReadFile(filepath.Join(f.historyPath(name), "revisions.json"))
+	if os.IsNotExist(err) {
+		return revisions, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read history of loadout %s: %w", name, err)
+	}
+	if err := json.Unmarshal(data, &revisions); err != nil {
+		return nil, fmt.Errorf("failed to parse history of loadout %s: %w", name, err)
+	}
+	return revisions, nil
+}
+
+// ReadRevision returns a revision of a loadout exactly as stored
+func (f *FileBackend) ReadRevision(name string, number int) ([]byte, error) {
+	revisions, err := f.Revisions(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, revision := range revisions {
+		if revision.Number == number {
+			return os.ReadFile(f.revisionPath(name, number))
+		}
+	}
+	return nil, fmt.Errorf("loadout %s has no revision %d", name, number)
+}
+
+// Rollback writes a revision back as the loadout, recording it as a new revision
+func (f *FileBackend) Rollback(name string, number int) error {
+	data, err := f.ReadRevision(name, number)
+	if err != nil {
+		return err
+	}
+
+	f.keepCurrent(name)
+	if err := utils.WriteFileAtomic(f.path(name), data, 0600); err != nil {
+		return err
+	}
+	if err := f.recordRevision(name, data, historyCommand()); err != nil {
+		slog.Warn("failure recording loadout revision", "loadout", name, "error", err)
+	}
+	return nil
+}
+
+// keepCurrent records the stored loadout as a revision before it is
+// overwritten if it differs from the latest revision, such as when it was
+// written before history was kept or edited outside envtab
+func (f *FileBackend) keepCurrent(name string) {
+	current, err := os.ReadFile(f.path(name))
+	if err != nil {
+		return
+	}
+	if err := f.recordRevision(name, current, ""); err != nil {
+		slog.Warn("failure recording loadout revision", "loadout", name, "error", err)
+	}
+}
+
+// recordRevision stores data as the latest revision of a loadout, unless it
+// only differs from the latest revision in loadedAt. The oldest revisions
+// are removed beyond the `history.limit` config key; a limit of 0 or less
+// keeps every revision.
+func (f *FileBackend) recordRevision(name string, data []byte, command string) error {
+	revisions, err := f.Revisions(name)
+	if err != nil {
+		return err
+	}
+
+	number := 1
+	if len(revisions) > 0 {
+		latest := revisions[len(revisions)-1]
+		previous, err := os.ReadFile(f.revisionPath(name, latest.Number))
+		if err == nil && sameRevision(previous, data) {
+			slog.Debug("loadout unchanged since the latest revision", "loadout", name, "revision", latest.Number)
+			return nil
+		}
+		number = latest.Number + 1
+	}
+
+	if err := os.MkdirAll(f.historyPath(name), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(f.revisionPath(name, number), data, 0600); err != nil {
+		return err
+	}
+	slog.Debug("recorded loadout revision", "loadout", name, "revision", number)
+	revisions = append(revisions, Revision{
+		Number:        number,
+		Time:          utils.GetCurrentTime(),
+		Command:       command,
+		FileEncrypted: sops.IsSOPSEncryptedContent(data),
+	})
+
+	limit := DefaultHistoryLimit
+	if viper.IsSet("history.limit") {
+		limit = viper.GetInt("history.limit")
+	}
+	for limit > 0 && len(revisions) > limit {
+		if err := os.Remove(f.revisionPath(name, revisions[0].Number)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		revisions = revisions[1:]
+	}
+
+	index, err := json.MarshalIndent(revisions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(f.historyPath(name), "revisions.json"), index, 0600)
+}
+
+// sameRevision reports whether two stored loadouts are identical or only
+// differ in loadedAt, which changes whenever a loadout is exported.
+// File-encrypted loadouts are only compared byte for byte.
+func sameRevision(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	if sops.IsSOPSEncryptedContent(a) || sops.IsSOPSEncryptedContent(b) {
+		return false
+	}
+
+	var la, lb loadout.Loadout
+	if yaml.Unmarshal(a, &la) != nil || yaml.Unmarshal(b, &lb) != nil {
+		return false
+	}
+	for _, change := range loadout.Diff(la, lb) {
+		if change.Key != "metadata.loadedAt" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package backends
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/spf13/viper"
+)
+
+func TestFileBackendHistory(t *testing.T) {
+	f := NewFileBackend(t.TempDir())
+
+	lo := loadout.InitLoadout()
+	lo.UpdateEntry("A", "1")
+	if err := f.Write("prod", lo, false); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	lo.UpdateEntry("B", "2")
+	if err := f.Write("prod", lo, false); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// Recording loadedAt is not a revision
+	lo.Metadata.LoadedAt = "2000-01-01T00:00:00Z"
+	if err := f.Write("prod", lo, false); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	revisions, err := f.Revisions("prod")
+	if err != nil {
+		t.Fatalf("Revisions() error = %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Number != 1 || revisions[1].Number != 2 {
+		t.Fatalf("Revisions() = %+v, want revisions 1 and 2", revisions)
+	}
+
+	// Changes made outside envtab are kept before the loadout is overwritten
+	external := []byte("metadata:\n  tags: []\nentries:\n  EXTERNAL: \"1\"\n")
+	if err := os.WriteFile(f.path("prod"), external, 0600); err != nil {
+		t.Fatal(err)
+	}
+	lo.UpdateEntry("C", "3")
+	if err := f.Write("prod", lo, false); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	revisions, _ = f.Revisions("prod")
+	if len(revisions) != 4 || revisions[2].Command != "" {
+		t.Fatalf("Revisions() = %+v, want the external change as revision 3", revisions)
+	}
+	if data, err := f.ReadRevision("prod", 3); err != nil || string(data) != string(external) {
+		t.Errorf("ReadRevision(3) = %q, %v, want %q", data, err, external)
+	}
+
+	if err := f.Rollback("prod", 1); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	rolledBack, err := f.Read("prod")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(rolledBack.Entries) != 1 || rolledBack.Entries["A"] != "1" {
+		t.Errorf("Rollback() restored entries %v, want A=1", rolledBack.Entries)
+	}
+	if revisions, _ = f.Revisions("prod"); len(revisions) != 5 {
+		t.Errorf("Revisions() = %+v, want the rollback recorded as revision 5", revisions)
+	}
+
+	if _, err := f.ReadRevision("prod", 42); err == nil {
+		t.Error("ReadRevision() of a missing revision should fail")
+	}
+
+	// History is not listed as loadouts and follows renames
+	if names, _ := f.List(); !slices.Equal(names, []string{"prod"}) {
+		t.Errorf("List() = %v, want [prod]", names)
+	}
+	if err := f.Rename("prod", "prod2"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if revisions, _ = f.Revisions("prod2"); len(revisions) != 5 {
+		t.Errorf("Revisions() after rename = %+v, want 5 revisions", revisions)
+	}
+}
+
+func TestFileBackendHistoryLimit(t *testing.T) {
+	viper.Set("history.limit", 2)
+	defer viper.Set("history.limit", nil)
+
+	f := NewFileBackend(t.TempDir())
+	lo := loadout.InitLoadout()
+	for _, value := range []string{"1", "2", "3"} {
+		lo.UpdateEntry("A", value)
+		if err := f.Write("prod", lo, false); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	revisions, _ := f.Revisions("prod")
+	if len(revisions) != 2 || revisions[0].Number != 2 {
+		t.Fatalf("Revisions() = %+v, want revisions 2 and 3", revisions)
+	}
+	if _, err := os.Stat(f.revisionPath("prod", 1)); !os.IsNotExist(err) {
+		t.Errorf("revision 1 was not removed: %v", err)
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = []string{"/usr/local/bin/envtab", "add", "prod", "TOKEN=secret", "-s"}
+	got := historyCommand()
+	if got != "envtab add prod TOKEN=*** -s" || strings.Contains(got, "secret") {
+		t.Errorf("historyCommand() = %q", got)
+	}
+}
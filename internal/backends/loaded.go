@@ -0,0 +1,94 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/gmherb/envtab/internal/config"
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/gmherb/envtab/internal/utils"
+)
+
+// getLoadedPath returns the path of the file recording when loadouts were
+// last loaded, in the data directory. It maps loadout names to RFC3339 times.
+// Load times are kept out of the loadouts, so loading one never rewrites it
+// (losing its formatting, or adding a Vault secret version).
+func getLoadedPath() string {
+	return filepath.Join(config.GetEnvtabPath(), "loaded.json")
+}
+
+func readLoaded() (map[string]string, error) {
+	loaded := map[string]string{}
+	data, err := os.ReadFile(getLoadedPath())
+	if os.IsNotExist(err) {
+		return loaded, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", getLoadedPath(), err)
+	}
+	return loaded, nil
+}
+
+// updateLoaded applies update to the recorded load times and writes them back
+func updateLoaded(update func(loaded map[string]string)) error {
+	loaded, err := readLoaded()
+	if err != nil {
+		return err
+	}
+	update(loaded)
+	data, err := json.MarshalIndent(loaded, "", "  ")
+	if err != nil {
+		return err
+	}
+	config.InitEnvtab("")
+	if err := utils.WriteFileAtomic(getLoadedPath(), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to record loadout load time: %w", err)
+	}
+	return nil
+}
+
+// MarkLoadoutsLoaded records the current time as the time the loadouts were
+// last loaded and sets it as their loadedAt. The loadouts themselves are not
+// written.
+func MarkLoadoutsLoaded(loadouts []*loadout.Loadout) error {
+	if len(loadouts) == 0 {
+		return nil
+	}
+	return updateLoaded(func(loaded map[string]string) {
+		for _, lo := range loadouts {
+			lo.UpdateLoadedAt()
+			loaded[lo.Name] = lo.Metadata.LoadedAt
+		}
+	})
+}
+
+// LoadoutLoadedAt returns when the loadout was last loaded, falling back to
+// the loadedAt stored in loadouts loaded before load times were recorded
+// separately
+func LoadoutLoadedAt(name string, lo *loadout.Loadout) string {
+	loaded, err := readLoaded()
+	if err == nil && loaded[name] != "" {
+		return loaded[name]
+	}
+	return lo.Metadata.LoadedAt
+}
+
+// forgetLoaded moves or removes the load time of a renamed or removed
+// loadout. newName is empty for removed loadouts.
+func forgetLoaded(name string, newName string) error {
+	loaded, err := readLoaded()
+	if err != nil || loaded[name] == "" {
+		return err
+	}
+	return updateLoaded(func(loaded map[string]string) {
+		if newName != "" {
+			loaded[newName] = loaded[name]
+		}
+		delete(loaded, name)
+	})
+}
@@ -0,0 +1,488 @@
+package backends
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gmherb/envtab/internal/loadout"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	vaultBackendName   = "vault"
+	vaultDefaultAddr   = "http://127.0.0.1:8200"
+	vaultDefaultMount  = "secret"
+	vaultDefaultPrefix = "envtab"
+)
+
+func init() {
+	Register(vaultBackendName, func() (Backend, error) {
+		return NewVaultBackend(VaultConfigFromViper())
+	})
+}
+
+// VaultConfig holds the settings for the Vault KV v2 backend
+type VaultConfig struct {
+	Address   string
+	Token     string
+	Namespace string
+	Mount     string
+	Prefix    string
+}
+
+// VaultConfigFromViper builds the Vault backend configuration.
+// Priority: vault.* config keys, then the standard VAULT_ADDR, VAULT_TOKEN and
+// VAULT_NAMESPACE environment variables, then ~/.vault-token and defaults.
+func VaultConfigFromViper() VaultConfig {
+	cfg := VaultConfig{
+		Address:   viper.GetString("vault.address"),
+		Token:     viper.GetString("vault.token"),
+		Namespace: viper.GetString("vault.namespace"),
+		Mount:     viper.GetString("vault.mount"),
+		Prefix:    viper.GetString("vault.prefix"),
+	}
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Address == "" {
+		cfg.Address = vaultDefaultAddr
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if cfg.Token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if token, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				cfg.Token = strings.TrimSpace(string(token))
+			}
+		}
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = vaultDefaultMount
+	}
+	if cfg.Prefix == "" && !viper.IsSet("vault.prefix") {
+		cfg.Prefix = vaultDefaultPrefix
+	}
+	return cfg
+}
+
+// VaultBackend stores each loadout as a KV v2 secret.
+// Entries are stored as the secret data and loadout metadata (tags, includes,
+// ordering, description, login and timestamps) as the secret's custom metadata.
+type VaultBackend struct {
+	cfg    VaultConfig
+	client *http.Client
+}
+
+// NewVaultBackend returns a Vault backend for the given configuration
+func NewVaultBackend(cfg VaultConfig) (*VaultBackend, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("vault backend requires an address (vault.address or VAULT_ADDR)")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = vaultDefaultMount
+	}
+	cfg.Address = strings.TrimRight(cfg.Address, "/")
+	cfg.Mount = strings.Trim(cfg.Mount, "/")
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+	return &VaultBackend{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// Name returns the name the Vault backend is registered under
+func (v *VaultBackend) Name() string {
+	return vaultBackendName
+}
+
+// secretPath returns the path of a loadout relative to the mount
+func (v *VaultBackend) secretPath(name string) string {
+	return path.Join(v.cfg.Prefix, name)
+}
+
+func (v *VaultBackend) url(kind string, name string) string {
+	return v.cfg.Address + "/v1/" + path.Join(v.cfg.Mount, kind, v.secretPath(name))
+}
+
+// vaultError is returned for unexpected responses from Vault
+type vaultError struct {
+	Status int
+	Errors []string
+}
+
+func (e *vaultError) Error() string {
+	if len(e.Errors) > 0 {
+		return fmt.Sprintf("vault returned status %d: %s", e.Status, strings.Join(e.Errors, "; "))
+	}
+	return fmt.Sprintf("vault returned status %d", e.Status)
+}
+
+// do sends a request to Vault and decodes the JSON response into out (if not nil)
+// A 404 response is returned as an error satisfying os.IsNotExist
+func (v *VaultBackend) do(method, url string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return err
+	}
+	if v.cfg.Token != "" {
+		req.Header.Set("X-Vault-Token", v.cfg.Token)
+	}
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	slog.Debug("vault request", "method", method, "url", url)
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read vault response: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return &fs.PathError{Op: strings.ToLower(method), Path: url, Err: fs.ErrNotExist}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		verr := &vaultError{Status: resp.StatusCode}
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(data, &errResp) == nil {
+			verr.Errors = errResp.Errors
+		}
+		return verr
+	}
+
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("failed to parse vault response: %w", err)
+		}
+	}
+	return nil
+}
+
+type vaultDataResponse struct {
+	Data struct {
+		Data     map[string]json.RawMessage `json:"data"`
+		Metadata struct {
+			CustomMetadata map[string]string `json:"custom_metadata"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+type vaultMetadataResponse struct {
+	Data struct {
+		CustomMetadata map[string]string `json:"custom_metadata"`
+	} `json:"data"`
+}
+
+// Limits of KV v2 custom metadata
+const (
+	vaultMaxCustomKeys     = 64
+	vaultMaxCustomKeyLen   = 128
+	vaultMaxCustomValueLen = 512
+)
+
+type vaultListResponse struct {
+	Data struct {
+		Keys []string `json:"keys"`
+	} `json:"data"`
+}
+
+// List returns the names of all loadouts under the configured prefix
+func (v *VaultBackend) List() ([]string, error) {
+	var resp vaultListResponse
+	url := v.cfg.Address + "/v1/" + path.Join(v.cfg.Mount, "metadata", v.cfg.Prefix)
+	err := v.do("LIST", url, nil, &resp)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing vault loadouts: %w", err)
+	}
+
+	loadouts := []string{}
+	for _, key := range resp.Data.Keys {
+		// Skip nested folders
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		loadouts = append(loadouts, key)
+	}
+	sort.Strings(loadouts)
+	return loadouts, nil
+}
+
+// Read returns a loadout from its KV v2 secret and custom metadata
+func (v *VaultBackend) Read(name string) (*loadout.Loadout, error) {
+	var resp vaultDataResponse
+	if err := v.do(http.MethodGet, v.url("data", name), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	// Vault returns a null data payload for deleted versions
+	if resp.Data.Data == nil {
+		return nil, &fs.PathError{Op: "get", Path: v.url("data", name), Err: fs.ErrNotExist}
+	}
+
+	lo := &loadout.Loadout{
+		Name:     name,
+		Metadata: metadataFromVault(resp.Data.Metadata.CustomMetadata),
+		Entries:  map[string]string{},
+		Specs:    specsFromVault(resp.Data.Metadata.CustomMetadata),
+	}
+	for key, raw := range resp.Data.Data {
+		// Values written by other Vault clients may be numbers, booleans or
+		// objects, which are kept as their JSON text (1000000, not 1e+06)
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			if text := strings.TrimSpace(string(raw)); text != "null" {
+				value = text
+			}
+		}
+		lo.Entries[key] = value
+	}
+	return lo, nil
+}
+
+// ReadRaw returns the loadout rendered as YAML
+// Vault has no file representation, so this is the decoded loadout
+func (v *VaultBackend) ReadRaw(name string) ([]byte, error) {
+	lo, err := v.Read(name)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(lo)
+}
+
+// Write stores the loadout entries as secret data and its metadata as custom
+// metadata. Custom metadata not written by envtab is kept. The metadata is
+// checked against the custom metadata limits before anything is written.
+func (v *VaultBackend) Write(name string, lo *loadout.Loadout, fileEncrypted bool) error {
+	if fileEncrypted {
+		return fmt.Errorf("file-level encryption is not supported by the vault backend; use value encryption instead")
+	}
+
+	custom, err := v.customMetadata(name, lo)
+	if err != nil {
+		return err
+	}
+
+	entries := lo.Entries
+	if entries == nil {
+		entries = map[string]string{}
+	}
+	if err := v.do(http.MethodPost, v.url("data", name), map[string]interface{}{"data": entries}, nil); err != nil {
+		return fmt.Errorf("failed to write vault secret: %w", err)
+	}
+
+	body := map[string]interface{}{"custom_metadata": custom}
+	if err := v.do(http.MethodPost, v.url("metadata", name), body, nil); err != nil {
+		return fmt.Errorf("vault secret entries were written, but not its metadata: %w", err)
+	}
+	return nil
+}
+
+// customMetadata returns the custom metadata to write for lo: its loadout and
+// entry metadata along with the keys of other Vault clients in the current
+// custom metadata. Returns an error if it exceeds the custom metadata limits.
+func (v *VaultBackend) customMetadata(name string, lo *loadout.Loadout) (map[string]string, error) {
+	var resp vaultMetadataResponse
+	if err := v.do(http.MethodGet, v.url("metadata", name), nil, &resp); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read vault secret metadata: %w", err)
+	}
+	custom := map[string]string{}
+	for key, value := range resp.Data.CustomMetadata {
+		if !isEnvtabCustomKey(key) {
+			custom[key] = value
+		}
+	}
+
+	for key, value := range metadataToVault(lo.Metadata) {
+		custom[key] = value
+	}
+	specs, err := specsToVault(lo.Specs)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range specs {
+		custom[key] = value
+	}
+
+	if len(custom) > vaultMaxCustomKeys {
+		return nil, fmt.Errorf("loadout metadata needs %d vault custom metadata keys, more than the limit of %d; remove entry metadata or tags", len(custom), vaultMaxCustomKeys)
+	}
+	for key, value := range custom {
+		if len(key) > vaultMaxCustomKeyLen {
+			return nil, fmt.Errorf("vault custom metadata key %s is longer than %d bytes", key, vaultMaxCustomKeyLen)
+		}
+		if len(value) > vaultMaxCustomValueLen {
+			return nil, fmt.Errorf("vault custom metadata %s is %d bytes, more than the limit of %d; shorten it", key, len(value), vaultMaxCustomValueLen)
+		}
+	}
+	return custom, nil
+}
+
+// Rename copies the loadout to the new name and removes the old secret
+func (v *VaultBackend) Rename(oldName, newName string) error {
+	lo, err := v.Read(oldName)
+	if err != nil {
+		return err
+	}
+	if err := v.Write(newName, lo, false); err != nil {
+		return err
+	}
+	return v.Remove(oldName)
+}
+
+// Remove permanently deletes all versions of the loadout secret
+func (v *VaultBackend) Remove(name string) error {
+	if !v.Exists(name) {
+		return &fs.PathError{Op: "remove", Path: v.url("metadata", name), Err: fs.ErrNotExist}
+	}
+	return v.do(http.MethodDelete, v.url("metadata", name), nil, nil)
+}
+
+// Exists checks if a secret exists for the loadout
+func (v *VaultBackend) Exists(name string) bool {
+	err := v.do(http.MethodGet, v.url("metadata", name), nil, nil)
+	if err != nil && !os.IsNotExist(err) {
+		slog.Debug("failure checking vault loadout", "loadout", name, "error", err)
+	}
+	return err == nil
+}
+
+// IsFileEncrypted always returns false as Vault encrypts secrets at rest itself
+func (v *VaultBackend) IsFileEncrypted(name string) bool {
+	return false
+}
+
+// vaultMetadataKeys are the custom metadata keys holding loadout metadata
+var vaultMetadataKeys = []string{"createdAt", "loadedAt", "updatedAt", "login", "tags", "description", "includes", "priority", "after"}
+
+// isEnvtabCustomKey reports whether a custom metadata key is written by envtab
+func isEnvtabCustomKey(key string) bool {
+	return slices.Contains(vaultMetadataKeys, key) || strings.HasPrefix(key, vaultSpecPrefix)
+}
+
+// metadataToVault converts loadout metadata to KV v2 custom metadata (string
+// values only). Empty fields are left out to stay within the key limit.
+func metadataToVault(m loadout.LoadoutMetadata) map[string]string {
+	custom := map[string]string{
+		"createdAt":   m.CreatedAt,
+		"loadedAt":    m.LoadedAt,
+		"updatedAt":   m.UpdatedAt,
+		"tags":        strings.Join(m.Tags, ","),
+		"description": m.Description,
+		"includes":    strings.Join(m.Includes, ","),
+		"after":       strings.Join(m.After, ","),
+	}
+	if m.Login {
+		custom["login"] = strconv.FormatBool(m.Login)
+	}
+	if m.Priority != 0 {
+		custom["priority"] = strconv.Itoa(m.Priority)
+	}
+	for key, value := range custom {
+		if value == "" {
+			delete(custom, key)
+		}
+	}
+	return custom
+}
+
+// metadataFromVault converts KV v2 custom metadata back to loadout metadata
+func metadataFromVault(custom map[string]string) loadout.LoadoutMetadata {
+	m := loadout.LoadoutMetadata{
+		CreatedAt:   custom["createdAt"],
+		LoadedAt:    custom["loadedAt"],
+		UpdatedAt:   custom["updatedAt"],
+		Description: custom["description"],
+		Tags:        []string{},
+	}
+	m.Login, _ = strconv.ParseBool(custom["login"])
+	if tags := custom["tags"]; tags != "" {
+		m.Tags = strings.Split(tags, ",")
+	}
+	if includes := custom["includes"]; includes != "" {
+		m.Includes = strings.Split(includes, ",")
+	}
+	m.Priority, _ = strconv.Atoi(custom["priority"])
+	if after := custom["after"]; after != "" {
+		m.After = strings.Split(after, ",")
+	}
+	return m
+}
+
+// vaultSpecPrefix prefixes the custom metadata keys holding entry metadata
+const vaultSpecPrefix = "entry."
+
+// specsToVault converts entry metadata to KV v2 custom metadata, one JSON
+// encoded value per entry
+func specsToVault(specs map[string]loadout.EntrySpec) (map[string]string, error) {
+	custom := map[string]string{}
+	for key, spec := range specs {
+		data, err := json.Marshal(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode metadata for entry %s: %w", key, err)
+		}
+		custom[vaultSpecPrefix+key] = string(data)
+	}
+	return custom, nil
+}
+
+// specsFromVault converts KV v2 custom metadata back to entry metadata,
+// skipping values that cannot be decoded
+func specsFromVault(custom map[string]string) map[string]loadout.EntrySpec {
+	var specs map[string]loadout.EntrySpec
+	for name, value := range custom {
+		key, ok := strings.CutPrefix(name, vaultSpecPrefix)
+		if !ok {
+			continue
+		}
+		var spec loadout.EntrySpec
+		if err := json.Unmarshal([]byte(value), &spec); err != nil {
+			slog.Warn("ignoring invalid entry metadata", "key", key, "error", err)
+			continue
+		}
+		if specs == nil {
+			specs = map[string]loadout.EntrySpec{}
+		}
+		specs[key] = spec
+	}
+	return specs
+}
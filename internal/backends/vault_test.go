@@ -0,0 +1,339 @@
+package backends
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gmherb/envtab/internal/loadout"
+)
+
+const testVaultToken = "test-token"
+
+// fakeVault is a minimal in-memory stand-in for the Vault KV v2 HTTP API
+type fakeVault struct {
+	mu       sync.Mutex
+	data     map[string]map[string]interface{}
+	metadata map[string]map[string]string
+	// writes counts the requests writing secret data or metadata
+	writes int
+}
+
+func newFakeVault(t *testing.T) (*httptest.Server, *fakeVault) {
+	fv := &fakeVault{
+		data:     map[string]map[string]interface{}{},
+		metadata: map[string]map[string]string{},
+	}
+	server := httptest.NewServer(fv)
+	t.Cleanup(server.Close)
+	return server, fv
+}
+
+func (fv *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != testVaultToken {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+
+	// Paths look like /v1/secret/{data|metadata}/envtab/NAME
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/v1/secret/"), "/", 2)
+	if len(parts) != 2 {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	kind, secretPath := parts[0], parts[1]
+
+	switch {
+	case kind == "metadata" && (r.Method == "LIST" || r.URL.Query().Get("list") == "true"):
+		keys := []string{}
+		for p := range fv.data {
+			if name, ok := strings.CutPrefix(p, secretPath+"/"); ok {
+				keys = append(keys, name)
+			}
+		}
+		if len(keys) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+
+	case kind == "data" && r.Method == http.MethodGet:
+		data, ok := fv.data[secretPath]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{
+				"data":     data,
+				"metadata": map[string]interface{}{"custom_metadata": fv.metadata[secretPath]},
+			},
+		})
+
+	case kind == "data" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		var body struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fv.data[secretPath] = body.Data
+		fv.writes++
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"version": 1}})
+
+	case kind == "metadata" && r.Method == http.MethodGet:
+		if _, ok := fv.data[secretPath]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": map[string]interface{}{"custom_metadata": fv.metadata[secretPath]},
+		})
+
+	case kind == "metadata" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		var body struct {
+			CustomMetadata map[string]string `json:"custom_metadata"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fv.metadata[secretPath] = body.CustomMetadata
+		fv.writes++
+		w.WriteHeader(http.StatusNoContent)
+
+	case kind == "metadata" && r.Method == http.MethodDelete:
+		delete(fv.data, secretPath)
+		delete(fv.metadata, secretPath)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestVaultBackend(t *testing.T) (*VaultBackend, *fakeVault) {
+	server, fv := newFakeVault(t)
+	b, err := NewVaultBackend(VaultConfig{
+		Address: server.URL,
+		Token:   testVaultToken,
+		Mount:   "secret",
+		Prefix:  "envtab",
+	})
+	if err != nil {
+		t.Fatalf("NewVaultBackend() error = %v", err)
+	}
+	return b, fv
+}
+
+func TestVaultBackend_WriteRead(t *testing.T) {
+	b, _ := newTestVaultBackend(t)
+
+	lo := loadout.InitLoadout()
+	lo.Entries["DB_HOST"] = "db.example.com"
+	lo.Entries["DB_PASSWORD"] = "SOPS:encrypted"
+	lo.Metadata.Tags = []string{"prod", "db"}
+	lo.Metadata.Description = "production database"
+	lo.Metadata.Login = true
+	lo.Metadata.Includes = []string{"base", "db-common"}
+	lo.Metadata.Priority = 10
+	lo.Metadata.After = []string{"aws"}
+	lo.Specs = map[string]loadout.EntrySpec{
+		"DB_PASSWORD": {Description: "database password", Required: true, Sensitive: true},
+	}
+
+	if err := b.Write("prod-db", lo, false); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	readLo, err := b.Read("prod-db")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if readLo.Entries["DB_HOST"] != "db.example.com" {
+		t.Errorf("Read() DB_HOST = %q, want db.example.com", readLo.Entries["DB_HOST"])
+	}
+	if readLo.Entries["DB_PASSWORD"] != "SOPS:encrypted" {
+		t.Errorf("Read() DB_PASSWORD = %q, want SOPS:encrypted", readLo.Entries["DB_PASSWORD"])
+	}
+	if readLo.Metadata.Description != "production database" {
+		t.Errorf("Read() description = %q, want production database", readLo.Metadata.Description)
+	}
+	if !readLo.Metadata.Login {
+		t.Error("Read() login = false, want true")
+	}
+	if len(readLo.Metadata.Tags) != 2 || readLo.Metadata.Tags[0] != "prod" || readLo.Metadata.Tags[1] != "db" {
+		t.Errorf("Read() tags = %v, want [prod db]", readLo.Metadata.Tags)
+	}
+	if readLo.Metadata.CreatedAt != lo.Metadata.CreatedAt {
+		t.Errorf("Read() createdAt = %q, want %q", readLo.Metadata.CreatedAt, lo.Metadata.CreatedAt)
+	}
+	if len(readLo.Metadata.Includes) != 2 || readLo.Metadata.Includes[0] != "base" || readLo.Metadata.Includes[1] != "db-common" {
+		t.Errorf("Read() includes = %v, want [base db-common]", readLo.Metadata.Includes)
+	}
+	if readLo.Metadata.Priority != 10 || len(readLo.Metadata.After) != 1 || readLo.Metadata.After[0] != "aws" {
+		t.Errorf("Read() priority = %d, after = %v, want 10 [aws]", readLo.Metadata.Priority, readLo.Metadata.After)
+	}
+	if len(readLo.Specs) != 1 || readLo.Spec("DB_PASSWORD") != lo.Spec("DB_PASSWORD") {
+		t.Errorf("Read() specs = %v, want %v", readLo.Specs, lo.Specs)
+	}
+}
+
+func TestVaultBackend_MetadataLimits(t *testing.T) {
+	b, fv := newTestVaultBackend(t)
+
+	// KV v2 custom metadata is limited to 64 keys of 512 byte values
+	lo := loadout.InitLoadout()
+	lo.Specs = map[string]loadout.EntrySpec{}
+	for i := range 100 {
+		key := fmt.Sprintf("KEY_%d", i)
+		lo.Entries[key] = "value"
+		lo.Specs[key] = loadout.EntrySpec{Description: "key"}
+	}
+	if err := b.Write("large", lo, false); err == nil || !strings.Contains(err.Error(), "limit of 64") {
+		t.Errorf("Write() with 100 entry specs error = %v, want the key limit", err)
+	}
+
+	lo = loadout.InitLoadout()
+	lo.Metadata.Description = strings.Repeat("d", 600)
+	if err := b.Write("large", lo, false); err == nil || !strings.Contains(err.Error(), "description") {
+		t.Errorf("Write() with a long description error = %v, want the value limit", err)
+	}
+
+	if fv.writes != 0 || b.Exists("large") {
+		t.Errorf("Write() made %d writes, want nothing written when the metadata does not fit", fv.writes)
+	}
+}
+
+func TestVaultBackend_SharedSecret(t *testing.T) {
+	b, fv := newTestVaultBackend(t)
+
+	// A secret written by another Vault client, with non-string values and
+	// its own custom metadata
+	fv.data["envtab/shared"] = map[string]interface{}{
+		"NAME":    "app",
+		"PORT":    json.Number("1000000"),
+		"ID":      json.Number("9007199254740993"),
+		"DEBUG":   true,
+		"OPTIONS": map[string]interface{}{"a": 1},
+		"EMPTY":   nil,
+	}
+	fv.metadata["envtab/shared"] = map[string]string{"owner": "platform-team"}
+
+	lo, err := b.Read("shared")
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	want := map[string]string{"NAME": "app", "PORT": "1000000", "ID": "9007199254740993", "DEBUG": "true", "OPTIONS": `{"a":1}`, "EMPTY": ""}
+	for key, value := range want {
+		if lo.Entries[key] != value {
+			t.Errorf("Read() %s = %q, want %q", key, lo.Entries[key], value)
+		}
+	}
+
+	lo.Metadata.Tags = []string{"shared"}
+	if err := b.Write("shared", lo, false); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if len(fv.data["envtab/shared"]) != len(want) {
+		t.Errorf("Write() secret data = %v, want only the entries", fv.data["envtab/shared"])
+	}
+	if fv.metadata["envtab/shared"]["owner"] != "platform-team" || fv.metadata["envtab/shared"]["tags"] != "shared" {
+		t.Errorf("Write() custom metadata = %v, want the tags and the other client's keys", fv.metadata["envtab/shared"])
+	}
+}
+
+func TestVaultBackend_NotExist(t *testing.T) {
+	b, _ := newTestVaultBackend(t)
+
+	if _, err := b.Read("missing"); !os.IsNotExist(err) {
+		t.Errorf("Read() error = %v, want not exist", err)
+	}
+	if b.Exists("missing") {
+		t.Error("Exists() = true for missing loadout")
+	}
+	if err := b.Remove("missing"); !os.IsNotExist(err) {
+		t.Errorf("Remove() error = %v, want not exist", err)
+	}
+
+	names, err := b.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(names) != 0 {
+		t.Errorf("List() = %v, want empty", names)
+	}
+}
+
+func TestVaultBackend_ListRenameRemove(t *testing.T) {
+	b, _ := newTestVaultBackend(t)
+
+	for _, name := range []string{"staging", "prod"} {
+		lo := loadout.InitLoadout()
+		lo.Entries["ENV"] = name
+		if err := b.Write(name, lo, false); err != nil {
+			t.Fatalf("Write(%s) error = %v", name, err)
+		}
+	}
+
+	names, err := b.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if strings.Join(names, ",") != "prod,staging" {
+		t.Errorf("List() = %v, want [prod staging]", names)
+	}
+
+	if err := b.Rename("staging", "stage"); err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if b.Exists("staging") {
+		t.Error("Rename() left old loadout behind")
+	}
+	lo, err := b.Read("stage")
+	if err != nil {
+		t.Fatalf("Read() after rename error = %v", err)
+	}
+	if lo.Entries["ENV"] != "staging" {
+		t.Errorf("Rename() entry ENV = %q, want staging", lo.Entries["ENV"])
+	}
+
+	if err := b.Remove("prod"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if b.Exists("prod") {
+		t.Error("Remove() did not remove loadout")
+	}
+}
+
+func TestVaultBackend_FileEncryptionUnsupported(t *testing.T) {
+	b, _ := newTestVaultBackend(t)
+
+	if err := b.Write("secret", loadout.InitLoadout(), true); err == nil {
+		t.Error("Write() with fileEncrypted should return error")
+	}
+	if b.IsFileEncrypted("secret") {
+		t.Error("IsFileEncrypted() should always be false")
+	}
+}
+
+func TestVaultBackend_PermissionDenied(t *testing.T) {
+	server, _ := newFakeVault(t)
+	b, err := NewVaultBackend(VaultConfig{Address: server.URL, Token: "wrong", Prefix: "envtab"})
+	if err != nil {
+		t.Fatalf("NewVaultBackend() error = %v", err)
+	}
+
+	_, err = b.Read("prod")
+	if err == nil || os.IsNotExist(err) {
+		t.Fatalf("Read() error = %v, want permission error", err)
+	}
+	if !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Read() error = %v, want vault error message", err)
+	}
+}
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
+
+	yaml "gopkg.in/yaml.v2"
 )
 
 const (
@@ -114,3 +117,37 @@ func GetTmpPath() string {
 
 	return tmpPath
 }
+
+// GetAgentSocketPath returns the path of the envtab agent socket
+// Priority: 1. ENVTAB_AGENT_SOCK env var, 2. $XDG_RUNTIME_DIR/envtab/agent.sock,
+// 3. $XDG_CACHE_HOME/envtab/agent.sock (with defaults)
+func GetAgentSocketPath() string {
+	if sock := os.Getenv("ENVTAB_AGENT_SOCK"); sock != "" {
+		return sock
+	}
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		return filepath.Join(runtimeDir, envtabDir, "agent.sock")
+	}
+	return filepath.Join(getXDGDir("XDG_CACHE_HOME", ".cache"), envtabDir, "agent.sock")
+}
+
+// projectConfig holds the keys of a project config read by envtab itself
+// rather than through viper
+type projectConfig struct {
+	// Loadouts are activated by the shell hook inside the project
+	Loadouts []string `yaml:"loadouts"`
+}
+
+// ProjectLoadouts returns the loadouts a project config declares under the
+// loadouts key
+func ProjectLoadouts(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pc projectConfig
+	if err := yaml.Unmarshal(data, &pc); err != nil {
+		return nil, fmt.Errorf("failed to parse project config %s: %w", path, err)
+	}
+	return pc.Loadouts, nil
+}
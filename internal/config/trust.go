@@ -0,0 +1,152 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/gmherb/envtab/internal/utils"
+)
+
+// TrustState is whether a project config has been approved
+type TrustState int
+
+const (
+	// Untrusted project configs have never been allowed or denied
+	Untrusted TrustState = iota
+	// Allowed project configs were allowed with their current content
+	Allowed
+	// Changed project configs were allowed, but their content changed since
+	Changed
+	// Denied project configs were explicitly denied
+	Denied
+)
+
+func (s TrustState) String() string {
+	switch s {
+	case Allowed:
+		return "allowed"
+	case Changed:
+		return "changed"
+	case Denied:
+		return "denied"
+	default:
+		return "untrusted"
+	}
+}
+
+// deniedHash marks a denied project config in the trust database
+const deniedHash = "denied"
+
+// GetTrustPath returns the path of the trust database in the data directory.
+// It maps the absolute path of each approved project config to the SHA-256
+// hash of its content, or to "denied".
+func GetTrustPath() string {
+	return filepath.Join(GetEnvtabPath(), "trust.json")
+}
+
+// hashFile returns the hex encoded SHA-256 hash of the file's content
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func readTrust() (map[string]string, error) {
+	trust := map[string]string{}
+	data, err := os.ReadFile(GetTrustPath())
+	if os.IsNotExist(err) {
+		return trust, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read trust database: %w", err)
+	}
+	if err := json.Unmarshal(data, &trust); err != nil {
+		return nil, fmt.Errorf("failed to parse trust database %s: %w", GetTrustPath(), err)
+	}
+	return trust, nil
+}
+
+func writeTrust(trust map[string]string) error {
+	data, err := json.MarshalIndent(trust, "", "  ")
+	if err != nil {
+		return err
+	}
+	InitEnvtab("")
+	if err := utils.WriteFileAtomic(GetTrustPath(), append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write trust database: %w", err)
+	}
+	return nil
+}
+
+// AllowProjectConfig approves the current content of the project config at path
+func AllowProjectConfig(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	hash, err := hashFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read project config: %w", err)
+	}
+
+	trust, err := readTrust()
+	if err != nil {
+		return err
+	}
+	slog.Debug("allowing project config", "path", path, "hash", hash)
+	trust[path] = hash
+	return writeTrust(trust)
+}
+
+// DenyProjectConfig denies the project config at path, whatever its content
+func DenyProjectConfig(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	trust, err := readTrust()
+	if err != nil {
+		return err
+	}
+	slog.Debug("denying project config", "path", path)
+	trust[path] = deniedHash
+	return writeTrust(trust)
+}
+
+// CheckProjectConfig returns whether the project config at path is approved
+// with its current content
+func CheckProjectConfig(path string) (TrustState, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return Untrusted, err
+	}
+
+	trust, err := readTrust()
+	if err != nil {
+		return Untrusted, err
+	}
+	approved, ok := trust[path]
+	switch {
+	case !ok:
+		return Untrusted, nil
+	case approved == deniedHash:
+		return Denied, nil
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return Untrusted, fmt.Errorf("failed to read project config: %w", err)
+	}
+	if hash != approved {
+		return Changed, nil
+	}
+	return Allowed, nil
+}
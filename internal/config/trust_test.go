@@ -0,0 +1,87 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckProjectConfig(t *testing.T) {
+	t.Setenv("ENVTAB_DIR", t.TempDir())
+	project := filepath.Join(t.TempDir(), ".envtab.yaml")
+	if err := os.WriteFile(project, []byte("loadouts:\n  - a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(want TrustState) {
+		t.Helper()
+		got, err := CheckProjectConfig(project)
+		if err != nil {
+			t.Fatalf("CheckProjectConfig() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("CheckProjectConfig() = %s, want %s", got, want)
+		}
+	}
+
+	check(Untrusted)
+
+	if err := AllowProjectConfig(project); err != nil {
+		t.Fatalf("AllowProjectConfig() error = %v", err)
+	}
+	check(Allowed)
+
+	// Changing the content revokes the approval until it is allowed again
+	if err := os.WriteFile(project, []byte("loadouts:\n  - b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check(Changed)
+	if err := AllowProjectConfig(project); err != nil {
+		t.Fatalf("AllowProjectConfig() error = %v", err)
+	}
+	check(Allowed)
+
+	if err := DenyProjectConfig(project); err != nil {
+		t.Fatalf("DenyProjectConfig() error = %v", err)
+	}
+	check(Denied)
+
+	if err := AllowProjectConfig(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("AllowProjectConfig() of a missing file should fail")
+	}
+}
+
+func TestProjectLoadouts(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		wantErr bool
+	}{
+		{"loadouts", "loadouts:\n  - a\n  - b\n", []string{"a", "b"}, false},
+		{"other settings only", "log:\n  level: debug\n", nil, false},
+		{"invalid", "loadouts: [a\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name+".yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ProjectLoadouts(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProjectLoadouts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ProjectLoadouts() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ProjectLoadouts() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
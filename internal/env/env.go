@@ -1,7 +1,10 @@
 package env
 
 import (
+	"log/slog"
 	"os"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/gmherb/envtab/internal/loadout"
@@ -57,36 +60,37 @@ func (e *Env) CompareRawValue(key string, value string) bool {
 	return sops.SOPSDisplayValue(e.Get(key), false) == value
 }
 
+// CompareSOPSEncryptedValue reports whether the entry for key with the
+// possibly encrypted value is active, see IsEntryActive
 func (e *Env) CompareSOPSEncryptedValue(key string, value string) bool {
+	return e.IsEntryActive(key, value)
+}
+
+// IsEntryActive checks if a loadout entry is currently active in the environment
+// It compares the entry's value (decrypted if encrypted) with what's in the environment
+func (e *Env) IsEntryActive(key string, value string) bool {
 	match := false
 
+	// Decrypt value if it's encrypted
 	displayValue := sops.SOPSDisplayValue(value, true)
 
 	// Expand environment variables in the value
 	// Only expand if not encrypted (encrypted values will have "SOPS:" prefix)
+	sep, isList := loadout.ListSeparator(key)
 	if !strings.HasPrefix(displayValue, "SOPS:") {
-		displayValue = loadout.ExpandVariables(displayValue)
-	}
-
-	// Handle PATH specially - check if the expanded value is contained in current PATH
-	if key == "PATH" {
-		currentPath := e.Get("PATH")
-		if currentPath != "" {
-			// For PATH, check if all segments in displayValue are in currentPath
-			pathSegments := strings.Split(displayValue, ":")
-			allInPath := true
-			for _, segment := range pathSegments {
-				if segment != "" && !strings.Contains(currentPath, segment) {
-					allInPath = false
-					break
-				}
-			}
-			if allInPath && len(pathSegments) > 0 {
-				match = true
-			}
+		if isList {
+			displayValue = loadout.ExpandVariables(displayValue, key)
+		} else {
+			displayValue = loadout.ExpandVariables(displayValue)
 		}
+	}
+
+	// List variables such as PATH are active when their segments are in the
+	// current list
+	if isList {
+		match = e.ListContains(key, sep, displayValue)
 	} else {
-		// For non-PATH variables, do exact match
+		// For other variables, do exact match
 		for k, v := range e.Env {
 			if k == key && v == displayValue {
 				match = true
@@ -97,45 +101,187 @@ func (e *Env) CompareSOPSEncryptedValue(key string, value string) bool {
 	return match
 }
 
-// IsEntryActive checks if a loadout entry is currently active in the environment
-// It compares the entry's value (decrypted if encrypted) with what's in the environment
-func (e *Env) IsEntryActive(key string, value string) bool {
-	match := false
+// IsLoadoutEntryActive checks if the entry for key of lo is active, using the
+// entry's default when its value is empty and honoring its export mode
+func (e *Env) IsLoadoutEntryActive(lo *loadout.Loadout, key string) bool {
+	spec := lo.Spec(key)
+	value := lo.Entries[key]
+	if value == "" {
+		value = spec.Default
+	}
+
+	sep, isList := loadout.ListSeparator(key)
+	if !isList || spec.Mode == "" || spec.Mode == loadout.ModeReplace {
+		return e.IsEntryActive(key, value)
+	}
 
-	// Decrypt value if it's encrypted
 	displayValue := sops.SOPSDisplayValue(value, true)
+	if strings.HasPrefix(displayValue, "SOPS:") {
+		return false
+	}
+	added, removed := loadout.ListSegments(key, sep, loadout.ExpandVariables(displayValue, key))
+	if spec.Mode == loadout.ModeRemove {
+		added, removed = nil, append(removed, added...)
+	}
+	return e.containsSegments(key, sep, added, removed)
+}
 
-	// Expand environment variables in the value
-	// Only expand if not encrypted (encrypted values will have "SOPS:" prefix)
-	if !strings.HasPrefix(displayValue, "SOPS:") {
-		displayValue = loadout.ExpandVariables(displayValue)
-	}
-
-	// Handle PATH specially - check if the expanded value is contained in current PATH
-	if key == "PATH" {
-		currentPath := e.Get("PATH")
-		if currentPath != "" {
-			// For PATH, check if all segments in displayValue are in currentPath
-			pathSegments := strings.Split(displayValue, ":")
-			allInPath := true
-			for _, segment := range pathSegments {
-				if segment != "" && !strings.Contains(currentPath, segment) {
-					allInPath = false
-					break
+// UnloadResult holds the environment changes required to unload a loadout
+type UnloadResult struct {
+	// Unset lists the keys to unset, in sorted order
+	Unset []string
+	// Updated maps list variables such as PATH to their value with the
+	// loadout's segments removed
+	Updated map[string]string
+}
+
+// Unload computes the changes needed to undo a loadout in the environment.
+// Only entries that are currently active are unset. For list variables such
+// as PATH, only the segments contributed by the loadout are removed; the rest
+// of the list is kept. When AddedSegmentsVar records the segments envtab added
+// to a list, only those are removed, so segments that were in the list before
+// the loadout was exported are kept.
+// The environment, including AddedSegmentsVar, is updated so consecutive
+// unloads see the result.
+func (e *Env) Unload(lo *loadout.Loadout) UnloadResult {
+	result := UnloadResult{Unset: []string{}, Updated: map[string]string{}}
+	added := addedSegments(e.Env)
+	// Decrypt the SOPS values in one batch
+	decrypted, failed := sops.SOPSDecryptValues(lo.Entries)
+
+	keys := make([]string, 0, len(lo.Entries))
+	for key := range lo.Entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	separators := loadout.ListSeparators()
+	for _, key := range keys {
+		spec := lo.Spec(key)
+		value := lo.Entries[key]
+		if plaintext, ok := decrypted[key]; ok {
+			value = plaintext
+		}
+		if value == "" {
+			value = spec.Default
+		}
+		if value == "" {
+			continue
+		}
+
+		// List variables are compared against the environment being unloaded
+		// rather than the process environment, removing whichever contributed
+		// segments are present. A list left empty is unset.
+		if sep, ok := separators[key]; ok {
+			// Removed segments cannot be restored
+			if spec.Mode == loadout.ModeRemove {
+				continue
+			}
+			if err := failed[key]; err != nil {
+				slog.Error("failed to decrypt value", "key", key, "error", err)
+				continue
+			}
+			current, set := e.Env[key]
+			contributed := contributedSegments(key, sep, value)
+			if recorded, ok := added[key]; ok {
+				for segment := range contributed {
+					if !slices.Contains(recorded, segment) {
+						delete(contributed, segment)
+					}
 				}
+				added[key] = slices.DeleteFunc(recorded, func(segment string) bool { return contributed[segment] })
 			}
-			if allInPath && len(pathSegments) > 0 {
-				match = true
+			newValue := removeSegments(sep, current, contributed)
+			switch {
+			case !set || newValue == current:
+			case newValue == "":
+				delete(e.Env, key)
+				result.Unset = append(result.Unset, key)
+			default:
+				e.Env[key] = newValue
+				result.Updated[key] = newValue
 			}
+			continue
+		}
+
+		if !e.IsLoadoutEntryActive(lo, key) {
+			continue
 		}
+
+		delete(e.Env, key)
+		result.Unset = append(result.Unset, key)
+	}
+
+	if value := formatAddedSegments(added); value != "" {
+		e.Env[AddedSegmentsVar] = value
 	} else {
-		// For non-PATH variables, do exact match
-		for k, v := range e.Env {
-			if k == key && v == displayValue {
-				match = true
-				break
-			}
+		delete(e.Env, AddedSegmentsVar)
+	}
+	return result
+}
+
+// ListContains reports whether the list variable key contains every segment
+// a list entry value adds and none of the segments it removes. References to
+// the variable itself in value are ignored.
+func (e *Env) ListContains(key string, sep string, value string) bool {
+	added, removed := loadout.ListSegments(key, sep, value)
+	return e.containsSegments(key, sep, added, removed)
+}
+
+// containsSegments reports whether the list variable key contains all of
+// added and none of removed
+func (e *Env) containsSegments(key string, sep string, added []string, removed []string) bool {
+	current := e.Get(key)
+	if current == "" {
+		return false
+	}
+
+	segments := map[string]bool{}
+	for _, segment := range strings.Split(current, sep) {
+		segments[segment] = true
+	}
+
+	for _, segment := range added {
+		if !segments[segment] {
+			return false
 		}
 	}
-	return match
+	for _, segment := range removed {
+		if segments[segment] {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveListSegments removes the segments contributed by a list entry value
+// from current. References to the variable itself in the value are not
+// considered contributions; other variables are expanded before comparing.
+// Segments the entry removed are not restored.
+func RemoveListSegments(key string, sep string, current string, value string) string {
+	return removeSegments(sep, current, contributedSegments(key, sep, value))
+}
+
+// contributedSegments returns the segments a list entry value adds, with
+// variables other than the list itself expanded
+func contributedSegments(key string, sep string, value string) map[string]bool {
+	added, _ := loadout.ListSegments(key, sep, loadout.ExpandVariables(value, key))
+	contributed := make(map[string]bool)
+	for _, segment := range added {
+		contributed[segment] = true
+	}
+	return contributed
+}
+
+// removeSegments removes the contributed segments and empty segments from
+// the list current
+func removeSegments(sep string, current string, contributed map[string]bool) string {
+	kept := []string{}
+	for _, segment := range strings.Split(current, sep) {
+		if segment == "" || contributed[segment] {
+			continue
+		}
+		kept = append(kept, segment)
+	}
+	return strings.Join(kept, sep)
 }
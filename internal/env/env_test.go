@@ -2,7 +2,10 @@
 package env
 
 import (
+	"context"
 	"testing"
+
+	"github.com/gmherb/envtab/internal/loadout"
 )
 
 func TestParseKeyValue(t *testing.T) {
@@ -138,3 +141,181 @@ func TestCompareSOPSEncryptedValue(t *testing.T) {
 		t.Error("CompareSOPSEncryptedValue() should return false for non-existent key")
 	}
 }
+
+func TestRemoveListSegments(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		sep     string
+		current string
+		value   string
+		want    string
+	}{
+		{"appended segment", "PATH", ":", "/usr/bin:/bin:/other/bin", "$PATH:/other/bin", "/usr/bin:/bin"},
+		{"prepended segments", "PATH", ":", "/a:/b:/usr/bin", "/a:/b:$PATH", "/usr/bin"},
+		{"segment not in path", "PATH", ":", "/usr/bin:/bin", "$PATH:/missing", "/usr/bin:/bin"},
+		{"no $PATH reference", "PATH", ":", "/usr/bin:/new", "/new", "/usr/bin"},
+		{"empty segments ignored", "PATH", ":", "/usr/bin::/new:", "::/new:", "/usr/bin"},
+		{"similar segment kept", "PATH", ":", "/opt/bin:/opt/bin2", "$PATH:/opt/bin", "/opt/bin2"},
+		{"braced reference", "PYTHONPATH", ":", "/site:/lib/py", "/lib/py:${PYTHONPATH}", "/site"},
+		{"removed segment not restored", "PATH", ":", "/usr/bin:/new", "-/usr/games:/new:$PATH", "/usr/bin"},
+		{"custom separator", "PLUGINS", ",", "core,extra,mine", "$PLUGINS,mine", "core,extra"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RemoveListSegments(tt.key, tt.sep, tt.current, tt.value)
+			if got != tt.want {
+				t.Errorf("RemoveListSegments() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListContains(t *testing.T) {
+	e := NewEnv()
+	e.Set("PATH=/usr/bin:/opt/bin2")
+	e.Set("PYTHONPATH=/site:/lib/py")
+
+	tests := []struct {
+		name  string
+		key   string
+		value string
+		want  bool
+	}{
+		{"all segments present", "PYTHONPATH", "/lib/py:$PYTHONPATH", true},
+		{"segment missing", "PYTHONPATH", "$PYTHONPATH:/other", false},
+		{"substring is not a segment", "PATH", "$PATH:/opt/bin", false},
+		{"removed segment absent", "PATH", "$PATH:-/usr/games", true},
+		{"removed segment present", "PATH", "-/usr/bin", false},
+		{"unset variable", "LD_LIBRARY_PATH", "/opt/lib", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.ListContains(tt.key, ":", tt.value); got != tt.want {
+				t.Errorf("ListContains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnload(t *testing.T) {
+	e := NewEnv()
+	e.Set("ACTIVE_KEY=active")
+	e.Set("STALE_KEY=other")
+	e.Set("PATH=/usr/bin:/bin:/loadout/bin")
+	e.Set("PYTHONPATH=/loadout/lib")
+
+	lo := loadout.InitLoadout()
+	lo.Entries["ACTIVE_KEY"] = "active"
+	lo.Entries["STALE_KEY"] = "value"
+	lo.Entries["MISSING_KEY"] = "value"
+	lo.Entries["EMPTY_KEY"] = ""
+	lo.Entries["PATH"] = "$PATH:/loadout/bin"
+	lo.Entries["PYTHONPATH"] = "/loadout/lib:$PYTHONPATH"
+
+	result := e.Unload(lo)
+
+	// A list left empty is unset
+	if len(result.Unset) != 2 || result.Unset[0] != "ACTIVE_KEY" || result.Unset[1] != "PYTHONPATH" {
+		t.Errorf("Unload() unset = %v, want [ACTIVE_KEY PYTHONPATH]", result.Unset)
+	}
+	if result.Updated["PATH"] != "/usr/bin:/bin" {
+		t.Errorf("Unload() PATH = %q, want /usr/bin:/bin", result.Updated["PATH"])
+	}
+
+	// Environment is updated for consecutive unloads
+	if e.Get("ACTIVE_KEY") != "" {
+		t.Error("Unload() should remove unset keys from the environment")
+	}
+	if e.Get("STALE_KEY") != "other" {
+		t.Error("Unload() should not touch inactive keys")
+	}
+	if e.Get("PATH") != "/usr/bin:/bin" {
+		t.Errorf("Unload() environment PATH = %q, want /usr/bin:/bin", e.Get("PATH"))
+	}
+
+	// Unloading again is a no-op
+	result = e.Unload(lo)
+	if len(result.Unset) != 0 || len(result.Updated) != 0 {
+		t.Errorf("second Unload() = %+v, want no changes", result)
+	}
+}
+
+func TestUnloadAddedSegments(t *testing.T) {
+	base := map[string]string{"PATH": "/usr/local/bin:/usr/bin"}
+
+	lo := loadout.InitLoadout()
+	lo.Entries["PATH"] = "/usr/local/bin:/opt/tool/bin:$PATH"
+	resolved, _, err := lo.Resolve(context.Background(), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, _ := resolved.Get("PATH")
+	recorded := RecordAddedSegments(base, resolved.Vars)
+	if recorded != `{"PATH":["/opt/tool/bin"]}` {
+		t.Errorf("RecordAddedSegments() = %s, want only the segment not already in PATH", recorded)
+	}
+
+	// /usr/local/bin was in PATH before the loadout was exported, so it is kept
+	e := NewEnv()
+	e.Env["PATH"] = path.Value
+	e.Env[AddedSegmentsVar] = recorded
+	result := e.Unload(lo)
+	if result.Updated["PATH"] != "/usr/local/bin:/usr/bin" {
+		t.Errorf("Unload() PATH = %q, want /usr/local/bin:/usr/bin", result.Updated["PATH"])
+	}
+	if value, ok := e.Env[AddedSegmentsVar]; ok {
+		t.Errorf("Unload() left %s = %s, want it unset once no segments are recorded", AddedSegmentsVar, value)
+	}
+
+	// Segments recorded for other loadouts are kept
+	recorded = RecordAddedSegments(map[string]string{"PATH": "/usr/bin", AddedSegmentsVar: `{"PATH":["/other/bin"]}`}, resolved.Vars)
+	if recorded != `{"PATH":["/other/bin","/usr/local/bin","/opt/tool/bin"]}` {
+		t.Errorf("RecordAddedSegments() = %s, want the earlier segments kept", recorded)
+	}
+}
+
+func TestIsLoadoutEntryActive(t *testing.T) {
+	e := NewEnv()
+	e.Set("PATH=/opt/bin:/usr/bin")
+	e.Set("REGION=us-east-1")
+
+	lo := loadout.InitLoadout()
+	lo.Entries["REGION"] = ""
+	lo.Entries["PATH"] = "/opt/bin"
+	lo.Entries["MANPATH"] = "/opt/man"
+	lo.Specs = map[string]loadout.EntrySpec{
+		"REGION":  {Default: "us-east-1"},
+		"PATH":    {Mode: loadout.ModePrepend},
+		"MANPATH": {Mode: loadout.ModeRemove},
+	}
+
+	for _, key := range []string{"REGION", "PATH"} {
+		if !e.IsLoadoutEntryActive(lo, key) {
+			t.Errorf("IsLoadoutEntryActive(%s) = false, want true", key)
+		}
+	}
+	// MANPATH is unset, so there is no list to have removed segments from
+	if e.IsLoadoutEntryActive(lo, "MANPATH") {
+		t.Error("IsLoadoutEntryActive(MANPATH) = true, want false")
+	}
+
+	e.Set("MANPATH=/usr/share/man")
+	if !e.IsLoadoutEntryActive(lo, "MANPATH") {
+		t.Error("IsLoadoutEntryActive(MANPATH) = false, want true once /opt/man is absent")
+	}
+
+	// Removed segments are not restored by unload
+	result := e.Unload(lo)
+	if _, ok := result.Updated["MANPATH"]; ok {
+		t.Errorf("Unload() updated MANPATH = %q, want unchanged", result.Updated["MANPATH"])
+	}
+	if result.Updated["PATH"] != "/usr/bin" {
+		t.Errorf("Unload() PATH = %q, want /usr/bin", result.Updated["PATH"])
+	}
+	if len(result.Unset) != 1 || result.Unset[0] != "REGION" {
+		t.Errorf("Unload() unset = %v, want [REGION]", result.Unset)
+	}
+}
@@ -0,0 +1,69 @@
+package env
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/loadout"
+)
+
+// AddedSegmentsVar records the segments envtab added to list variables such
+// as PATH that were not already in the list, as a JSON object mapping each
+// variable to its added segments. Unload only removes recorded segments, so
+// a segment that was in PATH before a loadout was exported is kept.
+const AddedSegmentsVar = "ENVTAB_ADDED_SEGMENTS"
+
+// addedSegments returns the segments recorded in AddedSegmentsVar of env
+func addedSegments(env map[string]string) map[string][]string {
+	added := map[string][]string{}
+	if value := env[AddedSegmentsVar]; value != "" {
+		if err := json.Unmarshal([]byte(value), &added); err != nil {
+			slog.Warn("ignoring invalid "+AddedSegmentsVar, "error", err)
+			return map[string][]string{}
+		}
+	}
+	return added
+}
+
+// formatAddedSegments returns the AddedSegmentsVar value for added, or an
+// empty string if no segments are recorded
+func formatAddedSegments(added map[string][]string) string {
+	for key, segments := range added {
+		if len(segments) == 0 {
+			delete(added, key)
+		}
+	}
+	if len(added) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(added)
+	if err != nil {
+		slog.Warn("failure encoding "+AddedSegmentsVar, "error", err)
+		return ""
+	}
+	return string(data)
+}
+
+// RecordAddedSegments returns the AddedSegmentsVar value after applying the
+// resolved variables to base: the segments recorded in base, along with the
+// segments of the resolved list variables that are not in base. Returns an
+// empty string if no segments are recorded.
+func RecordAddedSegments(base map[string]string, vars []loadout.Variable) string {
+	added := addedSegments(base)
+	separators := loadout.ListSeparators()
+	for _, v := range vars {
+		sep, ok := separators[v.Key]
+		if !ok {
+			continue
+		}
+		before := strings.Split(base[v.Key], sep)
+		for _, segment := range strings.Split(v.Value, sep) {
+			if segment != "" && !slices.Contains(before, segment) && !slices.Contains(added[v.Key], segment) {
+				added[v.Key] = append(added[v.Key], segment)
+			}
+		}
+	}
+	return formatAddedSegments(added)
+}
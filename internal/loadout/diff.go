@@ -0,0 +1,125 @@
+package loadout
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ChangeKind is how a key differs between two loadouts
+type ChangeKind string
+
+const (
+	// ChangeAdded keys are only set in the new loadout
+	ChangeAdded ChangeKind = "added"
+	// ChangeRemoved keys are only set in the old loadout
+	ChangeRemoved ChangeKind = "removed"
+	// ChangeChanged keys are set to different values in both loadouts
+	ChangeChanged ChangeKind = "changed"
+)
+
+// Change is a difference between two loadouts
+type Change struct {
+	Kind ChangeKind
+	// Key is an entry key, an entry's metadata field (KEY.description) or a
+	// loadout metadata field (metadata.tags)
+	Key string
+	// Entry is the entry key the change belongs to, empty for loadout metadata
+	Entry string
+	Old   string
+	New   string
+}
+
+// IsMetadata reports whether the change is to loadout metadata
+func (c Change) IsMetadata() bool {
+	return c.Entry == ""
+}
+
+// IsTimestamp reports whether the change is to one of the loadout timestamps
+func (c Change) IsTimestamp() bool {
+	switch c.Key {
+	case "metadata.createdAt", "metadata.loadedAt", "metadata.updatedAt":
+		return true
+	}
+	return false
+}
+
+// Diff returns the changes from old to new: the loadout metadata fields in
+// the order they are stored, then entries sorted by key, each followed by the
+// changes to its metadata. Lists are compared in order. Zero values (false,
+// 0, empty lists) are treated as unset, like they are stored.
+func Diff(old Loadout, new Loadout) []Change {
+	changes := []Change{}
+	add := func(key, entry, o, n string, inOld, inNew bool) {
+		switch {
+		case inOld && inNew && o == n, !inOld && !inNew:
+			return
+		case !inOld:
+			changes = append(changes, Change{Kind: ChangeAdded, Key: key, Entry: entry, New: n})
+		case !inNew:
+			changes = append(changes, Change{Kind: ChangeRemoved, Key: key, Entry: entry, Old: o})
+		default:
+			changes = append(changes, Change{Kind: ChangeChanged, Key: key, Entry: entry, Old: o, New: n})
+		}
+	}
+	field := func(key, entry, o, n string) {
+		add(key, entry, o, n, o != "", n != "")
+	}
+
+	om, nm := old.Metadata, new.Metadata
+	field("metadata.createdAt", "", om.CreatedAt, nm.CreatedAt)
+	field("metadata.loadedAt", "", om.LoadedAt, nm.LoadedAt)
+	field("metadata.updatedAt", "", om.UpdatedAt, nm.UpdatedAt)
+	field("metadata.login", "", formatBool(om.Login), formatBool(nm.Login))
+	field("metadata.tags", "", strings.Join(om.Tags, ","), strings.Join(nm.Tags, ","))
+	field("metadata.description", "", om.Description, nm.Description)
+	field("metadata.includes", "", strings.Join(om.Includes, ","), strings.Join(nm.Includes, ","))
+	field("metadata.priority", "", formatInt(om.Priority), formatInt(nm.Priority))
+	field("metadata.after", "", strings.Join(om.After, ","), strings.Join(nm.After, ","))
+
+	keys := []string{}
+	for key := range old.Entries {
+		keys = append(keys, key)
+	}
+	for key := range new.Entries {
+		if _, ok := old.Entries[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		o, inOld := old.Entries[key]
+		n, inNew := new.Entries[key]
+		add(key, key, o, n, inOld, inNew)
+
+		oSpec, nSpec := old.Spec(key), new.Spec(key)
+		field(key+".description", key, oSpec.Description, nSpec.Description)
+		field(key+".required", key, formatBool(oSpec.Required), formatBool(nSpec.Required))
+		field(key+".default", key, oSpec.Default, nSpec.Default)
+		field(key+".sensitive", key, formatBool(oSpec.Sensitive), formatBool(nSpec.Sensitive))
+		field(key+".mode", key, oSpec.Mode, nSpec.Mode)
+	}
+	return changes
+}
+
+// CompareLoadouts reports whether the loadouts differ, including timestamps
+func CompareLoadouts(old Loadout, new Loadout) bool {
+	return len(Diff(old, new)) > 0
+}
+
+// formatBool returns "true", or an empty string for false
+func formatBool(b bool) string {
+	if b {
+		return "true"
+	}
+	return ""
+}
+
+// formatInt returns i, or an empty string for 0
+func formatInt(i int) string {
+	if i == 0 {
+		return ""
+	}
+	return strconv.Itoa(i)
+}
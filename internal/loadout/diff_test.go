@@ -0,0 +1,93 @@
+package loadout
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		old  Loadout
+		new  Loadout
+		want []Change
+	}{
+		{
+			name: "identical",
+			old:  Loadout{Entries: map[string]string{"A": "1"}},
+			new:  Loadout{Entries: map[string]string{"A": "1"}},
+			want: []Change{},
+		},
+		{
+			name: "entries added, removed and changed in key order",
+			old:  Loadout{Entries: map[string]string{"C": "3", "A": "1", "B": "2"}},
+			new:  Loadout{Entries: map[string]string{"A": "1", "B": "20", "D": "4"}},
+			want: []Change{
+				{Kind: ChangeChanged, Key: "B", Entry: "B", Old: "2", New: "20"},
+				{Kind: ChangeRemoved, Key: "C", Entry: "C", Old: "3"},
+				{Kind: ChangeAdded, Key: "D", Entry: "D", New: "4"},
+			},
+		},
+		{
+			name: "empty value is set",
+			old:  Loadout{Entries: map[string]string{}},
+			new:  Loadout{Entries: map[string]string{"A": ""}},
+			want: []Change{{Kind: ChangeAdded, Key: "A", Entry: "A"}},
+		},
+		{
+			name: "metadata before entries",
+			old: Loadout{
+				Metadata: LoadoutMetadata{UpdatedAt: "t1", Tags: []string{"a"}, Priority: 5},
+				Entries:  map[string]string{"A": "1"},
+			},
+			new: Loadout{
+				Metadata: LoadoutMetadata{UpdatedAt: "t2", Tags: []string{"a", "b"}, Login: true},
+				Entries:  map[string]string{"A": "2"},
+			},
+			want: []Change{
+				{Kind: ChangeChanged, Key: "metadata.updatedAt", Old: "t1", New: "t2"},
+				{Kind: ChangeAdded, Key: "metadata.login", New: "true"},
+				{Kind: ChangeChanged, Key: "metadata.tags", Old: "a", New: "a,b"},
+				{Kind: ChangeRemoved, Key: "metadata.priority", Old: "5"},
+				{Kind: ChangeChanged, Key: "A", Entry: "A", Old: "1", New: "2"},
+			},
+		},
+		{
+			name: "entry metadata follows its entry",
+			old: Loadout{
+				Entries: map[string]string{"A": "1", "B": "2"},
+				Specs:   map[string]EntrySpec{"A": {Description: "old", Sensitive: true}},
+			},
+			new: Loadout{
+				Entries: map[string]string{"A": "1", "B": "2"},
+				Specs:   map[string]EntrySpec{"A": {Description: "new"}, "B": {Required: true}},
+			},
+			want: []Change{
+				{Kind: ChangeChanged, Key: "A.description", Entry: "A", Old: "old", New: "new"},
+				{Kind: ChangeRemoved, Key: "A.sensitive", Entry: "A", Old: "true"},
+				{Kind: ChangeAdded, Key: "B.required", Entry: "B", New: "true"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Diff(tt.old, tt.new)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %+v, want %+v", got, tt.want)
+			}
+			if CompareLoadouts(tt.old, tt.new) != (len(tt.want) > 0) {
+				t.Errorf("CompareLoadouts() = %v, want %v", !(len(tt.want) > 0), len(tt.want) > 0)
+			}
+		})
+	}
+}
+
+func TestChangeKinds(t *testing.T) {
+	if !(Change{Key: "metadata.updatedAt"}).IsTimestamp() || (Change{Key: "metadata.tags"}).IsTimestamp() {
+		t.Error("IsTimestamp() should only match timestamps")
+	}
+	if !(Change{Key: "metadata.tags"}).IsMetadata() || (Change{Key: "A", Entry: "A"}).IsMetadata() {
+		t.Error("IsMetadata() should only match loadout metadata")
+	}
+}
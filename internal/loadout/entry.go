@@ -0,0 +1,176 @@
+package loadout
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Entry export modes
+const (
+	// ModeReplace sets the variable to the value, replacing lists instead of merging
+	ModeReplace = "replace"
+	// ModePrepend adds the value's segments to the front of a list variable
+	ModePrepend = "prepend"
+	// ModeAppend adds the value's segments to the end of a list variable
+	ModeAppend = "append"
+	// ModeRemove removes the value's segments from a list variable
+	ModeRemove = "remove"
+)
+
+// Modes lists the supported entry export modes
+var Modes = []string{ModeReplace, ModePrepend, ModeAppend, ModeRemove}
+
+// EntrySpec is the optional metadata of a loadout entry. Entries with
+// metadata are stored as a mapping with the value under `value`; entries
+// without are stored as plain strings.
+type EntrySpec struct {
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Required entries fail export when they resolve to an empty value
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+	// Default is exported when the value is empty or expands to empty
+	Default string `json:"default,omitempty" yaml:"default,omitempty"`
+	// Sensitive values are masked by show unless decrypted
+	Sensitive bool `json:"sensitive,omitempty" yaml:"sensitive,omitempty"`
+	// Mode is one of Modes; empty infers the mode from the value
+	Mode string `json:"mode,omitempty" yaml:"mode,omitempty"`
+}
+
+// IsZero reports whether the spec holds no metadata
+func (s EntrySpec) IsZero() bool {
+	return s == EntrySpec{}
+}
+
+// Validate checks the spec's mode is supported for key
+func (s EntrySpec) Validate(key string) error {
+	switch s.Mode {
+	case "", ModeReplace:
+		return nil
+	case ModePrepend, ModeAppend, ModeRemove:
+		if _, ok := ListSeparator(key); !ok {
+			return fmt.Errorf("mode %q requires a list variable such as PATH", s.Mode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported mode %q (supported: %s)", s.Mode, strings.Join(Modes, ", "))
+	}
+}
+
+// Spec returns the metadata of the entry for key
+func (l *Loadout) Spec(key string) EntrySpec {
+	return l.Specs[key]
+}
+
+// UpdateSpec sets the metadata of the entry for key, removing it if spec is empty
+func (l *Loadout) UpdateSpec(key string, spec EntrySpec) error {
+	if spec.IsZero() {
+		delete(l.Specs, key)
+	} else {
+		if l.Specs == nil {
+			l.Specs = map[string]EntrySpec{}
+		}
+		l.Specs[key] = spec
+	}
+	l.UpdateUpdatedAt()
+	return nil
+}
+
+// entryDocument is an entry as stored: a plain value or a mapping with metadata
+type entryDocument struct {
+	Value     string `json:"value,omitempty" yaml:"value,omitempty"`
+	EntrySpec `yaml:",inline"`
+}
+
+func (e entryDocument) MarshalYAML() (interface{}, error) {
+	if e.EntrySpec.IsZero() {
+		return e.Value, nil
+	}
+	type plain entryDocument
+	return plain(e), nil
+}
+
+func (e *entryDocument) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err == nil {
+		*e = entryDocument{Value: value}
+		return nil
+	}
+	type plain entryDocument
+	return unmarshal((*plain)(e))
+}
+
+func (e entryDocument) MarshalJSON() ([]byte, error) {
+	if e.EntrySpec.IsZero() {
+		return json.Marshal(e.Value)
+	}
+	type plain entryDocument
+	return json.Marshal(plain(e))
+}
+
+func (e *entryDocument) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*e = entryDocument{Value: value}
+		return nil
+	}
+	type plain entryDocument
+	return json.Unmarshal(data, (*plain)(e))
+}
+
+// loadoutDocument is a loadout as stored, with entries carrying their metadata
+type loadoutDocument struct {
+	Metadata LoadoutMetadata          `json:"metadata" yaml:"metadata"`
+	Entries  map[string]entryDocument `json:"entries" yaml:"entries"`
+}
+
+func (l Loadout) document() loadoutDocument {
+	doc := loadoutDocument{Metadata: l.Metadata, Entries: make(map[string]entryDocument, len(l.Entries))}
+	for key, value := range l.Entries {
+		doc.Entries[key] = entryDocument{Value: value, EntrySpec: l.Specs[key]}
+	}
+	return doc
+}
+
+func (l *Loadout) fromDocument(doc loadoutDocument) {
+	l.Metadata = doc.Metadata
+	l.Entries = nil
+	l.Specs = nil
+	if doc.Entries != nil {
+		l.Entries = make(map[string]string, len(doc.Entries))
+	}
+	for key, entry := range doc.Entries {
+		l.Entries[key] = entry.Value
+		if !entry.EntrySpec.IsZero() {
+			if l.Specs == nil {
+				l.Specs = map[string]EntrySpec{}
+			}
+			l.Specs[key] = entry.EntrySpec
+		}
+	}
+}
+
+func (l Loadout) MarshalYAML() (interface{}, error) {
+	return l.document(), nil
+}
+
+func (l *Loadout) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var doc loadoutDocument
+	if err := unmarshal(&doc); err != nil {
+		return err
+	}
+	l.fromDocument(doc)
+	return nil
+}
+
+func (l Loadout) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.document())
+}
+
+func (l *Loadout) UnmarshalJSON(data []byte) error {
+	var doc loadoutDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	l.fromDocument(doc)
+	return nil
+}
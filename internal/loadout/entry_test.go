@@ -0,0 +1,134 @@
+package loadout
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+const entryMetadataYAML = `metadata:
+  createdAt: "2025-01-01T00:00:00Z"
+  loadedAt: "2025-01-01T00:00:00Z"
+  updatedAt: "2025-01-01T00:00:00Z"
+  login: false
+  tags: []
+  description: ""
+entries:
+  DB_HOST: localhost
+  DB_PASSWORD:
+    value: hunter2
+    description: Database password
+    required: true
+    sensitive: true
+  DB_PORT: 5432
+  PYTHONPATH:
+    value: /opt/lib
+    mode: prepend
+  REGION:
+    default: us-east-1
+`
+
+func TestLoadoutYAMLEntryMetadata(t *testing.T) {
+	var lo Loadout
+	if err := yaml.Unmarshal([]byte(entryMetadataYAML), &lo); err != nil {
+		t.Fatalf("yaml.Unmarshal() error = %v", err)
+	}
+
+	wantEntries := map[string]string{
+		"DB_HOST":     "localhost",
+		"DB_PASSWORD": "hunter2",
+		"DB_PORT":     "5432",
+		"PYTHONPATH":  "/opt/lib",
+		"REGION":      "",
+	}
+	for key, want := range wantEntries {
+		if got, ok := lo.Entries[key]; !ok || got != want {
+			t.Errorf("Entries[%s] = %q, want %q", key, got, want)
+		}
+	}
+
+	wantSpecs := map[string]EntrySpec{
+		"DB_PASSWORD": {Description: "Database password", Required: true, Sensitive: true},
+		"PYTHONPATH":  {Mode: ModePrepend},
+		"REGION":      {Default: "us-east-1"},
+	}
+	if len(lo.Specs) != len(wantSpecs) {
+		t.Errorf("Specs = %v, want %v", lo.Specs, wantSpecs)
+	}
+	for key, want := range wantSpecs {
+		if got := lo.Spec(key); got != want {
+			t.Errorf("Spec(%s) = %+v, want %+v", key, got, want)
+		}
+	}
+
+	// Entries without metadata are written back as plain strings
+	data, err := yaml.Marshal(&lo)
+	if err != nil {
+		t.Fatalf("yaml.Marshal() error = %v", err)
+	}
+	want := strings.Replace(entryMetadataYAML, "DB_PORT: 5432", `DB_PORT: "5432"`, 1)
+	if string(data) != want {
+		t.Errorf("yaml.Marshal() =\n%s\nwant\n%s", data, want)
+	}
+}
+
+func TestLoadoutJSONEntryMetadata(t *testing.T) {
+	lo := InitLoadout()
+	lo.Entries["PLAIN"] = "value"
+	lo.Entries["SECRET"] = "hunter2"
+	lo.Specs = map[string]EntrySpec{"SECRET": {Sensitive: true}}
+
+	data, err := json.Marshal(lo)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if !strings.Contains(string(data), `"entries":{"PLAIN":"value","SECRET":{"value":"hunter2","sensitive":true}}`) {
+		t.Errorf("json.Marshal() = %s", data)
+	}
+
+	var got Loadout
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if CompareLoadouts(*lo, got) {
+		t.Errorf("json round trip = %+v, want %+v", got, *lo)
+	}
+}
+
+func TestEntrySpecValidate(t *testing.T) {
+	tests := []struct {
+		key     string
+		mode    string
+		wantErr bool
+	}{
+		{"HOME", "", false},
+		{"HOME", ModeReplace, false},
+		{"PATH", ModeReplace, false},
+		{"PATH", ModePrepend, false},
+		{"LD_LIBRARY_PATH", ModeAppend, false},
+		{"MANPATH", ModeRemove, false},
+		{"HOME", ModePrepend, true},
+		{"PATH", "merge", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key+"/"+tt.mode, func(t *testing.T) {
+			err := EntrySpec{Mode: tt.mode}.Validate(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRemoveEntryRemovesSpec(t *testing.T) {
+	lo := InitLoadout()
+	lo.UpdateEntry("KEY", "value")
+	lo.UpdateSpec("KEY", EntrySpec{Description: "a key"})
+	lo.RemoveEntry("KEY")
+	if _, ok := lo.Specs["KEY"]; ok {
+		t.Error("RemoveEntry() should remove the entry's metadata")
+	}
+}
@@ -0,0 +1,219 @@
+package loadout
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Expand expands shell-style parameter references in value:
+//
+//	$NAME, ${NAME}      the value of NAME
+//	${NAME:-word}       word if NAME is unset or empty
+//	${NAME-word}        word if NAME is unset
+//	${NAME:+word}       word if NAME is set and not empty, otherwise empty
+//	${NAME+word}        word if NAME is set, otherwise empty
+//	${NAME:?message}    error with message if NAME is unset or empty
+//	${NAME?message}     error with message if NAME is unset
+//	$$                  a literal $
+//
+// Words are expanded themselves, so defaults may reference other variables.
+// A $ that does not start a reference is kept as is. lookup returns the value
+// of a variable and whether it is set.
+func Expand(value string, lookup func(string) (string, bool)) (string, error) {
+	x := &expander{lookup: lookup}
+	return x.expand(value)
+}
+
+// References returns the unique variable names referenced in value, including
+// those only referenced from default or alternate words
+func References(value string) []string {
+	refs := []string{}
+	seen := map[string]bool{}
+	x := &expander{collect: func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			refs = append(refs, name)
+		}
+	}}
+	if _, err := x.expand(value); err != nil {
+		slog.Debug("failure collecting references", "error", err)
+	}
+	return refs
+}
+
+// ExpandVariables expands variable references in value from the process
+// environment. References to the variables in excludeVar are kept as is
+// (useful for cases like PATH where $PATH needs special handling).
+// If value cannot be expanded (e.g. a ${VAR:?} requirement is not met),
+// it is returned unchanged.
+func ExpandVariables(value string, excludeVar ...string) string {
+	x := &expander{lookup: os.LookupEnv, keep: map[string]bool{}}
+	for _, v := range excludeVar {
+		x.keep[v] = true
+	}
+	expanded, err := x.expand(value)
+	if err != nil {
+		slog.Debug("failure expanding variables", "error", err)
+		return value
+	}
+	return expanded
+}
+
+// expander implements parameter expansion
+type expander struct {
+	lookup func(string) (string, bool)
+	// keep lists variables whose references are left unexpanded
+	keep map[string]bool
+	// collect, if set, is called for every reference instead of expanding it
+	collect func(string)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || (c >= '0' && c <= '9')
+}
+
+func (x *expander) expand(s string) (string, error) {
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		if s[i] != '$' || i+1 >= len(s) {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		switch next := s[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i += 2
+		case next == '{':
+			end, err := closingBrace(s, i+2)
+			if err != nil {
+				return "", err
+			}
+			out, err := x.braced(s[i+2:end], s[i:end+1])
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(out)
+			i = end + 1
+		case isNameStart(next):
+			j := i + 1
+			for j < len(s) && isNameChar(s[j]) {
+				j++
+			}
+			b.WriteString(x.variable(s[i+1:j], s[i:j]))
+			i = j
+		default:
+			b.WriteByte('$')
+			i++
+		}
+	}
+
+	return b.String(), nil
+}
+
+// closingBrace returns the index of the } closing a ${ whose body starts at start
+func closingBrace(s string, start int) (int, error) {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '$':
+			i++
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unterminated ${ in %q", s)
+}
+
+// variable returns the value of a plain $NAME or ${NAME} reference
+func (x *expander) variable(name string, original string) string {
+	if x.keep[name] {
+		return original
+	}
+	if x.collect != nil {
+		x.collect(name)
+		return ""
+	}
+	value, _ := x.lookup(name)
+	return value
+}
+
+// braced expands the body of a ${...} reference
+func (x *expander) braced(body string, original string) (string, error) {
+	n := 0
+	for n < len(body) && isNameChar(body[n]) {
+		n++
+	}
+	name, rest := body[:n], body[n:]
+	if name == "" || !isNameStart(name[0]) {
+		return "", fmt.Errorf("bad substitution: %s", original)
+	}
+	if rest == "" {
+		return x.variable(name, original), nil
+	}
+
+	var op string
+	for _, candidate := range []string{":-", ":+", ":?", "-", "+", "?"} {
+		if strings.HasPrefix(rest, candidate) {
+			op = candidate
+			break
+		}
+	}
+	if op == "" {
+		return "", fmt.Errorf("bad substitution: %s", original)
+	}
+	word := rest[len(op):]
+
+	if x.keep[name] {
+		return original, nil
+	}
+	if x.collect != nil {
+		x.collect(name)
+		return x.expand(word)
+	}
+
+	value, set := x.lookup(name)
+	missing := !set
+	if strings.HasPrefix(op, ":") {
+		missing = !set || value == ""
+	}
+
+	switch strings.TrimPrefix(op, ":") {
+	case "-":
+		if missing {
+			return x.expand(word)
+		}
+		return value, nil
+	case "+":
+		if missing {
+			return "", nil
+		}
+		return x.expand(word)
+	default: // "?"
+		if !missing {
+			return value, nil
+		}
+		message, err := x.expand(word)
+		if err != nil {
+			return "", err
+		}
+		if message == "" {
+			message = "parameter null or not set"
+		}
+		return "", fmt.Errorf("%s: %s", name, message)
+	}
+}
@@ -0,0 +1,124 @@
+package loadout
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	vars := map[string]string{
+		"HOME":    "/home/test",
+		"HOMEDIR": "/srv/home",
+		"EMPTY":   "",
+		"REGION":  "eu-west-1",
+	}
+	lookup := func(name string) (string, bool) {
+		value, ok := vars[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"plain", "$HOME/bin", "/home/test/bin", false},
+		{"braces", "${HOME}bin", "/home/testbin", false},
+		{"prefix collision", "$HOME:$HOMEDIR", "/home/test:/srv/home", false},
+		{"prefix collision reversed", "$HOMEDIR:$HOME", "/srv/home:/home/test", false},
+		{"unset", "a${UNSET}b", "ab", false},
+		{"default unset", "${AWS_REGION:-us-east-1}", "us-east-1", false},
+		{"default set", "${REGION:-us-east-1}", "eu-west-1", false},
+		{"default empty", "${EMPTY:-fallback}", "fallback", false},
+		{"default without colon keeps empty", "${EMPTY-fallback}", "", false},
+		{"default without colon unset", "${UNSET-fallback}", "fallback", false},
+		{"nested default", "${UNSET:-$HOME/default}", "/home/test/default", false},
+		{"nested braced default", "${UNSET:-${OTHER:-deep}}", "deep", false},
+		{"alternate set", "${REGION:+--region=$REGION}", "--region=eu-west-1", false},
+		{"alternate unset", "${UNSET:+--region}", "", false},
+		{"alternate empty", "${EMPTY:+x}", "", false},
+		{"alternate without colon empty", "${EMPTY+x}", "x", false},
+		{"required set", "${HOME:?HOME is required}", "/home/test", false},
+		{"required unset", "${UNSET:?UNSET is required}", "", true},
+		{"required empty", "${EMPTY:?}", "", true},
+		{"required without colon empty", "${EMPTY?}", "", false},
+		{"escaped dollar", "pa$$word", "pa$word", false},
+		{"escaped reference", "$$HOME", "$HOME", false},
+		{"trailing dollar", "cost$", "cost$", false},
+		{"dollar before digit", "$1 and $ sign", "$1 and $ sign", false},
+		{"unterminated", "${HOME", "", true},
+		{"bad name", "${1X}", "", true},
+		{"unsupported operator", "${HOME#/}", "", true},
+		{"default with braces", "${UNSET:-{a,b}}", "{a,b}", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.input, lookup)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expand(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("Expand(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandRequiredMessage(t *testing.T) {
+	_, err := Expand("${TOKEN:?set TOKEN first}", func(string) (string, bool) { return "", false })
+	if err == nil || err.Error() != "TOKEN: set TOKEN first" {
+		t.Errorf("Expand() error = %v, want TOKEN: set TOKEN first", err)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"plain", []string{}},
+		{"$A/$B/$A", []string{"A", "B"}},
+		{"${A:-$B}", []string{"A", "B"}},
+		{"${A:+${B:-$C}}", []string{"A", "B", "C"}},
+		{"${A:?missing $B}", []string{"A", "B"}},
+		{"$$A", []string{}},
+		{"$HOMEDIR", []string{"HOMEDIR"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := References(tt.input); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("References(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	t.Setenv("ENVTAB_TEST_DIR", "/opt/test")
+	os.Unsetenv("ENVTAB_TEST_UNSET")
+
+	tests := []struct {
+		name    string
+		input   string
+		exclude []string
+		want    string
+	}{
+		{"expands environment", "$ENVTAB_TEST_DIR/bin", nil, "/opt/test/bin"},
+		{"default", "${ENVTAB_TEST_UNSET:-none}", nil, "none"},
+		{"excluded reference kept", "$PATH:$ENVTAB_TEST_DIR/bin", []string{"PATH"}, "$PATH:/opt/test/bin"},
+		{"excluded braced reference kept", "${PATH}:${ENVTAB_TEST_DIR}", []string{"PATH"}, "${PATH}:/opt/test"},
+		{"failed requirement returns value", "${ENVTAB_TEST_UNSET:?}", nil, "${ENVTAB_TEST_UNSET:?}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandVariables(tt.input, tt.exclude...); got != tt.want {
+				t.Errorf("ExpandVariables(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package loadout
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ExpandIncludes returns the loadouts included by lo, depth first in the order
+// listed, followed by lo itself. A loadout included more than once appears at
+// its first position only. read returns a loadout by name, with Name set.
+// Returns an error if an include cannot be read or includes form a cycle.
+func ExpandIncludes(lo *Loadout, read func(string) (*Loadout, error)) ([]*Loadout, error) {
+	expanded := []*Loadout{}
+	seen := map[string]bool{}
+	if err := expandIncludes(lo, read, []string{lo.Name}, seen, &expanded); err != nil {
+		return nil, err
+	}
+	return expanded, nil
+}
+
+// ExpandAllIncludes returns the loadouts each preceded by the loadouts it
+// includes, with every loadout appearing once
+func ExpandAllIncludes(loadouts []*Loadout, read func(string) (*Loadout, error)) ([]*Loadout, error) {
+	expanded := []*Loadout{}
+	seen := map[string]bool{}
+	for _, lo := range loadouts {
+		withIncludes, err := ExpandIncludes(lo, read)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range withIncludes {
+			if !seen[l.Name] {
+				seen[l.Name] = true
+				expanded = append(expanded, l)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+func expandIncludes(lo *Loadout, read func(string) (*Loadout, error), chain []string, seen map[string]bool, expanded *[]*Loadout) error {
+	for _, name := range lo.Metadata.Includes {
+		for _, ancestor := range chain {
+			if ancestor == name {
+				return fmt.Errorf("include cycle between loadouts: %s -> %s", strings.Join(chain, " -> "), name)
+			}
+		}
+		if seen[name] {
+			continue
+		}
+
+		slog.Debug("reading included loadout", "loadout", lo.Name, "include", name)
+		included, err := read(name)
+		if err != nil {
+			return fmt.Errorf("failed to read loadout %s included by %s: %w", name, lo.Name, err)
+		}
+		included.Name = name
+
+		if err := expandIncludes(included, read, append(chain[:len(chain):len(chain)], name), seen, expanded); err != nil {
+			return err
+		}
+	}
+
+	if !seen[lo.Name] {
+		seen[lo.Name] = true
+		*expanded = append(*expanded, lo)
+	}
+	return nil
+}
+
+// Flatten returns a copy of lo with the entries of the loadouts it includes
+// merged in, entries of lo overriding those it includes. The copy keeps the
+// metadata of lo without its includes.
+func Flatten(lo *Loadout, read func(string) (*Loadout, error)) (*Loadout, error) {
+	expanded, err := ExpandIncludes(lo, read)
+	if err != nil {
+		return nil, err
+	}
+
+	flat := &Loadout{Name: lo.Name, Metadata: lo.Metadata, Entries: map[string]string{}}
+	flat.Metadata.Includes = nil
+	for _, l := range expanded {
+		for key, value := range l.Entries {
+			flat.Entries[key] = value
+			delete(flat.Specs, key)
+			if spec, ok := l.Specs[key]; ok {
+				if flat.Specs == nil {
+					flat.Specs = map[string]EntrySpec{}
+				}
+				flat.Specs[key] = spec
+			}
+		}
+	}
+	return flat, nil
+}
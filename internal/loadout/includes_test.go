@@ -0,0 +1,142 @@
+package loadout
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testReader returns a reader for loadouts defined by their includes and entries
+func testReader(loadouts map[string]*Loadout) func(string) (*Loadout, error) {
+	return func(name string) (*Loadout, error) {
+		lo, ok := loadouts[name]
+		if !ok {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		return lo, nil
+	}
+}
+
+func testIncludesLoadout(name string, includes []string, entries map[string]string) *Loadout {
+	lo := InitLoadout()
+	lo.Name = name
+	lo.Metadata.Includes = includes
+	lo.Entries = entries
+	return lo
+}
+
+func TestExpandIncludes(t *testing.T) {
+	loadouts := map[string]*Loadout{
+		"base":    testIncludesLoadout("base", nil, nil),
+		"prod":    testIncludesLoadout("prod", []string{"base"}, nil),
+		"db":      testIncludesLoadout("db", []string{"base"}, nil),
+		"prod-eu": testIncludesLoadout("prod-eu", []string{"prod", "db"}, nil),
+		"self":    testIncludesLoadout("self", []string{"self"}, nil),
+		"a":       testIncludesLoadout("a", []string{"b"}, nil),
+		"b":       testIncludesLoadout("b", []string{"c"}, nil),
+		"c":       testIncludesLoadout("c", []string{"a"}, nil),
+		"broken":  testIncludesLoadout("broken", []string{"missing"}, nil),
+	}
+
+	tests := []struct {
+		name    string
+		want    []string
+		wantErr string
+	}{
+		{"base", []string{"base"}, ""},
+		{"prod", []string{"base", "prod"}, ""},
+		{"prod-eu", []string{"base", "prod", "db", "prod-eu"}, ""},
+		{"self", nil, "include cycle between loadouts: self -> self"},
+		{"a", nil, "include cycle between loadouts: a -> b -> c -> a"},
+		{"broken", nil, "failed to read loadout missing included by broken"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expanded, err := ExpandIncludes(loadouts[tt.name], testReader(loadouts))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ExpandIncludes() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExpandIncludes() error = %v", err)
+			}
+			names := []string{}
+			for _, lo := range expanded {
+				names = append(names, lo.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("ExpandIncludes() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	base := testIncludesLoadout("prod-base", nil, map[string]string{
+		"DB_HOST": "db.internal",
+		"REGION":  "us-east-1",
+		"SECRET":  "SOPS:abc",
+	})
+	base.Specs = map[string]EntrySpec{
+		"REGION": {Description: "deploy region"},
+		"SECRET": {Sensitive: true},
+	}
+	eu := testIncludesLoadout("prod-eu", []string{"prod-base"}, map[string]string{
+		"REGION": "eu-west-1",
+	})
+	eu.Metadata.Description = "EU production"
+
+	flat, err := Flatten(eu, testReader(map[string]*Loadout{"prod-base": base}))
+	if err != nil {
+		t.Fatalf("Flatten() error = %v", err)
+	}
+
+	want := map[string]string{"DB_HOST": "db.internal", "REGION": "eu-west-1", "SECRET": "SOPS:abc"}
+	if !reflect.DeepEqual(flat.Entries, want) {
+		t.Errorf("Flatten() entries = %v, want %v", flat.Entries, want)
+	}
+	// Overridden entries drop the metadata of the entry they override
+	if _, ok := flat.Specs["REGION"]; ok {
+		t.Errorf("Flatten() REGION spec = %+v, want none", flat.Specs["REGION"])
+	}
+	if !flat.Spec("SECRET").Sensitive {
+		t.Error("Flatten() should keep the metadata of included entries")
+	}
+	if flat.Metadata.Description != "EU production" || flat.Metadata.Includes != nil {
+		t.Errorf("Flatten() metadata = %+v, want own metadata without includes", flat.Metadata)
+	}
+	// The loadout itself is not modified
+	if len(eu.Entries) != 1 || len(eu.Metadata.Includes) != 1 {
+		t.Errorf("Flatten() modified the loadout: %+v", eu)
+	}
+}
+
+func TestResolveAllWithIncludes(t *testing.T) {
+	base := testIncludesLoadout("base", nil, map[string]string{"PATH": "$PATH:/base/bin", "REGION": "us-east-1"})
+	eu := testIncludesLoadout("eu", []string{"base"}, map[string]string{"PATH": "$PATH:/eu/bin", "REGION": "eu-west-1"})
+
+	expanded, err := ExpandIncludes(eu, testReader(map[string]*Loadout{"base": base}))
+	if err != nil {
+		t.Fatalf("ExpandIncludes() error = %v", err)
+	}
+	resolved, _, err := ResolveAll(t.Context(), expanded, map[string]string{"PATH": "/usr/bin"})
+	if err != nil {
+		t.Fatalf("ResolveAll() error = %v", err)
+	}
+
+	m := resolved.Map()
+	if m["REGION"] != "eu-west-1" {
+		t.Errorf("REGION = %q, want eu-west-1", m["REGION"])
+	}
+	// A reference to the entry's own key extends the included value
+	if m["PATH"] != "/usr/bin:/base/bin:/eu/bin" {
+		t.Errorf("PATH = %q, want /usr/bin:/base/bin:/eu/bin", m["PATH"])
+	}
+	if v, _ := resolved.Get("REGION"); v.Source != "eu" {
+		t.Errorf("REGION source = %q, want eu", v.Source)
+	}
+}
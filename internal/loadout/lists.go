@@ -0,0 +1,132 @@
+package loadout
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultListVariables are the variables treated as lists of paths joined by
+// the OS path list separator
+var DefaultListVariables = []string{
+	"PATH",
+	"MANPATH",
+	"PYTHONPATH",
+	"LD_LIBRARY_PATH",
+	"PKG_CONFIG_PATH",
+	"GOPATH",
+	"CDPATH",
+	"XDG_DATA_DIRS",
+	"XDG_CONFIG_DIRS",
+}
+
+// RemovePrefix marks a list segment that is removed from the list rather
+// than added to it (e.g. PATH: -/usr/games)
+const RemovePrefix = "-"
+
+// ListVariable is a variable holding a list of values joined by Separator
+type ListVariable struct {
+	Name      string
+	Separator string
+}
+
+// ListVariables returns the default list variables along with those
+// configured under path_lists. Configured variables override the separator
+// of a default; an empty separator means the OS path list separator.
+func ListVariables() []ListVariable {
+	vars := []ListVariable{}
+	index := map[string]int{}
+	add := func(v ListVariable) {
+		if v.Separator == "" {
+			v.Separator = string(os.PathListSeparator)
+		}
+		if i, ok := index[v.Name]; ok {
+			vars[i] = v
+			return
+		}
+		index[v.Name] = len(vars)
+		vars = append(vars, v)
+	}
+
+	for _, name := range DefaultListVariables {
+		add(ListVariable{Name: name})
+	}
+
+	var configured []ListVariable
+	if err := viper.UnmarshalKey("path_lists", &configured); err != nil {
+		slog.Warn("ignoring invalid path_lists configuration", "error", err)
+	}
+	for _, v := range configured {
+		if v.Name != "" {
+			add(v)
+		}
+	}
+	return vars
+}
+
+// ListSeparators returns the separators of the list variables by name. Use it
+// rather than ListSeparator when looking up many keys, as the configuration
+// is only read once.
+func ListSeparators() map[string]string {
+	separators := map[string]string{}
+	for _, v := range ListVariables() {
+		separators[v.Name] = v.Separator
+	}
+	return separators
+}
+
+// ListSeparator returns the separator of key and whether key is a list variable
+func ListSeparator(key string) (string, bool) {
+	sep, ok := ListSeparators()[key]
+	return sep, ok
+}
+
+// ListSegments splits an expanded list entry value into the segments it adds
+// and the segments it removes, skipping empty segments and references to the
+// variable itself
+func ListSegments(key string, sep string, value string) (added []string, removed []string) {
+	for _, segment := range strings.Split(value, sep) {
+		switch {
+		case segment == "" || segment == "$"+key || segment == "${"+key+"}":
+			continue
+		case strings.HasPrefix(segment, RemovePrefix) && len(segment) > len(RemovePrefix):
+			removed = append(removed, strings.TrimPrefix(segment, RemovePrefix))
+		default:
+			added = append(added, segment)
+		}
+	}
+	return added, removed
+}
+
+// SplitList splits a list variable value into its unique, non-empty segments
+func SplitList(value string, sep string) []string {
+	segments := []string{}
+	seen := map[string]bool{}
+	for _, segment := range strings.Split(value, sep) {
+		if segment == "" || seen[segment] {
+			continue
+		}
+		seen[segment] = true
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// ListMarker stands in for the value a list variable has when a rendered
+// script is sourced. Resolving against ScriptBase keeps it as a segment so
+// ScriptRenderer can reference the variable instead of its current value.
+const ListMarker = "\x00"
+
+// ScriptBase returns a copy of base with every list variable set to ListMarker
+func ScriptBase(base map[string]string) map[string]string {
+	m := make(map[string]string, len(base))
+	for k, v := range base {
+		m[k] = v
+	}
+	for _, v := range ListVariables() {
+		m[v.Name] = ListMarker
+	}
+	return m
+}
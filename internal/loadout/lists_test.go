@@ -0,0 +1,70 @@
+package loadout
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestListSeparator(t *testing.T) {
+	viper.Set("path_lists", []map[string]string{
+		{"name": "PLUGINS", "separator": ","},
+		{"name": "GEM_PATH"},
+		{"name": "CDPATH", "separator": ";"},
+	})
+	t.Cleanup(func() { viper.Set("path_lists", nil) })
+
+	tests := []struct {
+		key     string
+		wantSep string
+		wantOK  bool
+	}{
+		{"PATH", ":", true},
+		{"PYTHONPATH", ":", true},
+		{"LD_LIBRARY_PATH", ":", true},
+		{"PLUGINS", ",", true},
+		{"GEM_PATH", ":", true},
+		{"CDPATH", ";", true},
+		{"HOME", "", false},
+		{"path", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			sep, ok := ListSeparator(tt.key)
+			if sep != tt.wantSep || ok != tt.wantOK {
+				t.Errorf("ListSeparator(%q) = %q, %v, want %q, %v", tt.key, sep, ok, tt.wantSep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestListSegments(t *testing.T) {
+	tests := []struct {
+		value       string
+		wantAdded   []string
+		wantRemoved []string
+	}{
+		{"/a:$PATH:/b", []string{"/a", "/b"}, nil},
+		{"${PATH}::/a:", []string{"/a"}, nil},
+		{"-/usr/games:$PATH", nil, []string{"/usr/games"}},
+		{"-", []string{"-"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			added, removed := ListSegments("PATH", ":", tt.value)
+			if !reflect.DeepEqual(added, tt.wantAdded) || !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("ListSegments() = %v, %v, want %v, %v", added, removed, tt.wantAdded, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	got := SplitList(":/a::/b:/a:", ":")
+	if want := []string{"/a", "/b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitList() = %v, want %v", got, want)
+	}
+}
@@ -1,10 +1,12 @@
 package loadout
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log/slog"
-	"os"
-	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/gmherb/envtab/internal/sops"
@@ -20,14 +22,26 @@ type LoadoutMetadata struct {
 	Login       bool     `json:"login" yaml:"login"`
 	Tags        []string `json:"tags" yaml:"tags"`
 	Description string   `json:"description" yaml:"description"`
+	// Includes names the loadouts whose entries this loadout extends
+	Includes []string `json:"includes,omitempty" yaml:"includes,omitempty"`
+	// Priority orders loadouts exported together, lowest first
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
+	// After names loadouts this loadout is exported after when exported together
+	After []string `json:"after,omitempty" yaml:"after,omitempty"`
 }
 
 type Loadout struct {
+	// Name is set by the backend the loadout was read from and is not stored
+	Name     string            `json:"-" yaml:"-"`
 	Metadata LoadoutMetadata   `json:"metadata" yaml:"metadata"`
 	Entries  map[string]string `json:"entries" yaml:"entries"`
+	// Specs holds the metadata of entries that have any, stored alongside
+	// their values in the entries section
+	Specs map[string]EntrySpec `json:"-" yaml:"-"`
 }
 
-// ValidateLoadout checks if a loadout has duplicate keys in the entries
+// ValidateLoadout checks if a loadout has duplicate keys in the entries and
+// that entry metadata is valid
 // Returns an error if duplicates are found, listing the duplicate keys
 func ValidateLoadout(loadout *Loadout) error {
 	if loadout == nil {
@@ -48,6 +62,13 @@ func ValidateLoadout(loadout *Loadout) error {
 		}
 	}
 
+	// Check entry metadata such as the export mode
+	for key, spec := range loadout.Specs {
+		if err := spec.Validate(key); err != nil {
+			return fmt.Errorf("invalid metadata for entry '%s': %w", key, err)
+		}
+	}
+
 	return nil
 }
 
@@ -58,6 +79,7 @@ func ValidateLoadoutYAML(yamlContent []byte) error {
 	lines := strings.Split(string(yamlContent), "\n")
 	inEntries := false
 	indentLevel := 0
+	entryIndent := -1
 	seenKeys := make(map[string]int)
 
 	for i, line := range lines {
@@ -83,6 +105,15 @@ func ValidateLoadoutYAML(yamlContent []byte) error {
 				break
 			}
 
+			// Only keys at the first level are entries; deeper lines hold
+			// entry metadata such as value and description
+			if entryIndent < 0 {
+				entryIndent = currentIndent
+			}
+			if currentIndent != entryIndent {
+				continue
+			}
+
 			// Check if this is a key-value pair in entries
 			if strings.Contains(trimmed, ":") {
 				parts := strings.SplitN(trimmed, ":", 2)
@@ -100,118 +131,6 @@ func ValidateLoadoutYAML(yamlContent []byte) error {
 	return nil
 }
 
-// ExpandVariables expands environment variable references in a value string
-// It replaces $VARNAME patterns with the actual environment variable values
-// The excludeVar parameter can be used to exclude a specific variable from expansion
-// (useful for cases like PATH where $PATH needs special handling)
-// Returns the expanded value string
-func ExpandVariables(value string, excludeVar ...string) string {
-	reVariable := regexp.MustCompile(`\$(\w+)`)
-	excludeMap := make(map[string]bool)
-	for _, v := range excludeVar {
-		excludeMap[v] = true
-	}
-
-	// Find all variable references and replace them
-	for _, varName := range reVariable.FindAllStringSubmatch(value, -1) {
-		varNameStr := varName[1]
-		if excludeMap[varNameStr] {
-			continue
-		}
-		varValue := os.Getenv(varNameStr)
-		value = strings.ReplaceAll(value, "$"+varNameStr, varValue)
-		slog.Debug("expanded variable", "variable", varNameStr, "expandedValue", varValue, "result", value)
-	}
-
-	return value
-}
-
-func (l Loadout) Export() {
-
-	pathMap := make(map[string]bool)
-	order := []string{}
-
-	for _, p := range strings.Split(os.Getenv("PATH"), string(os.PathListSeparator)) {
-		if _, exists := pathMap[p]; !exists {
-			order = append(order, p)
-		}
-		pathMap[p] = true
-	}
-
-	re := regexp.MustCompile(`\$PATH`)
-	reSOPS := regexp.MustCompile(`^SOPS:`)
-
-	for key, value := range l.Entries {
-
-		if value == "" {
-			continue
-		} else {
-			if reSOPS.MatchString(value) {
-				decrypted, err := sops.SOPSDecryptValue(value)
-				if err != nil {
-					errStr := err.Error()
-					if strings.Contains(strings.ToLower(errStr), "sops command not found") {
-						slog.Debug("skipping encrypted entry - SOPS not available", "key", key)
-						continue
-					}
-					if utils.Contains(err.Error(), "keys may have been rotated") {
-						slog.Warn("cannot decrypt - encryption keys may have been rotated", "key", key, "error", err)
-					} else {
-						slog.Error("failure decrypting SOPS value", "key", key, "error", err)
-					}
-					continue
-				}
-				value = decrypted
-			}
-		}
-
-		if key == "PATH" {
-			// Expand all variables except $PATH (which needs special handling with accumulated PATH)
-			value = ExpandVariables(value, "PATH")
-
-			// Replace $PATH with the current accumulated PATH value
-			if re.MatchString(value) {
-				slog.Debug("found potential new PATH(s)", "path", value)
-				currentPath := strings.Join(order, string(os.PathListSeparator))
-				value = re.ReplaceAllString(value, currentPath)
-			}
-			newPath := value
-			newPath = strings.Trim(newPath, ":")
-			for strings.Contains(newPath, "::") {
-				newPath = strings.ReplaceAll(newPath, "::", ":")
-			}
-
-			slog.Debug("found potential new PATH(s)", "path", newPath)
-
-			for _, np := range strings.Split(newPath, string(os.PathListSeparator)) {
-				if np != "" {
-					if _, exists := pathMap[np]; !exists {
-
-						slog.Debug("adding new path to PATH map", "path", np)
-						order = append(order, np)
-						pathMap[np] = true
-					}
-				}
-			}
-
-			paths := make([]string, 0, len(pathMap)) // preallocate for efficiency
-			paths = append(paths, order...)
-
-			os.Setenv("PATH", strings.Join(paths, string(os.PathListSeparator)))
-			fmt.Printf("export PATH=%s\n", os.Getenv("PATH"))
-		} else {
-			// Expand all variables in the value
-			value = ExpandVariables(value)
-			if value != "" {
-				fmt.Printf("export %s=%s\n", key, value)
-			} else {
-				slog.Debug("skipping empty value after variable expansion", "key", key, "value", value)
-			}
-		}
-	}
-	l.UpdateLoadedAt()
-}
-
 func (l *Loadout) UpdateEntry(key string, value string) error {
 	slog.Debug("UpdateEntry called", "key", key)
 	l.Entries[key] = value
@@ -222,6 +141,7 @@ func (l *Loadout) UpdateEntry(key string, value string) error {
 func (l *Loadout) RemoveEntry(key string) error {
 	slog.Debug("RemoveEntry called", "key", key)
 	delete(l.Entries, key)
+	delete(l.Specs, key)
 	l.UpdateUpdatedAt()
 	return nil
 }
@@ -252,6 +172,67 @@ func (l *Loadout) RemoveTags(tagsToRemove []string) error {
 	return nil
 }
 
+func (l *Loadout) UpdateIncludes(names []string) error {
+	slog.Debug("UpdateIncludes called", "includes", names)
+	for _, name := range names {
+		if !slices.Contains(l.Metadata.Includes, name) {
+			l.Metadata.Includes = append(l.Metadata.Includes, name)
+		}
+	}
+	l.UpdateUpdatedAt()
+	return nil
+}
+
+func (l *Loadout) RemoveIncludes(names []string) error {
+	slog.Debug("RemoveIncludes called", "includes", names)
+	kept := []string{}
+	for _, name := range l.Metadata.Includes {
+		if !slices.Contains(names, name) {
+			kept = append(kept, name)
+		}
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	l.Metadata.Includes = kept
+	l.UpdateUpdatedAt()
+	return nil
+}
+
+func (l *Loadout) UpdatePriority(priority int) error {
+	slog.Debug("UpdatePriority called", "priority", priority)
+	l.Metadata.Priority = priority
+	l.UpdateUpdatedAt()
+	return nil
+}
+
+func (l *Loadout) UpdateAfter(names []string) error {
+	slog.Debug("UpdateAfter called", "after", names)
+	for _, name := range names {
+		if !slices.Contains(l.Metadata.After, name) {
+			l.Metadata.After = append(l.Metadata.After, name)
+		}
+	}
+	l.UpdateUpdatedAt()
+	return nil
+}
+
+func (l *Loadout) RemoveAfter(names []string) error {
+	slog.Debug("RemoveAfter called", "after", names)
+	kept := []string{}
+	for _, name := range l.Metadata.After {
+		if !slices.Contains(names, name) {
+			kept = append(kept, name)
+		}
+	}
+	if len(kept) == 0 {
+		kept = nil
+	}
+	l.Metadata.After = kept
+	l.UpdateUpdatedAt()
+	return nil
+}
+
 func (l *Loadout) UpdateDescription(description string) error {
 	slog.Debug("UpdateDescription called", "description", description)
 	l.Metadata.Description = description
@@ -282,19 +263,16 @@ func (l *Loadout) UpdateLoadedAt() error {
 // Returns a map of keys that were encrypted (for re-encryption on save)
 func (l *Loadout) DecryptSOPSValues() (map[string]bool, error) {
 	encryptedKeys := make(map[string]bool)
-	for key, value := range l.Entries {
-		if strings.HasPrefix(value, "SOPS:") {
-			decrypted, err := sops.SOPSDecryptValue(value)
-			if err != nil {
-				// If decryption fails, keep the encrypted value and mark it
-				// This allows editing other values even if some can't be decrypted
-				slog.Warn("cannot decrypt - keeping encrypted value", "key", key, "error", err)
-				encryptedKeys[key] = true
-				continue
-			}
-			l.Entries[key] = decrypted
-			encryptedKeys[key] = true
-		}
+	decrypted, failed := sops.SOPSDecryptValues(l.Entries)
+	for key, err := range failed {
+		// If decryption fails, keep the encrypted value and mark it
+		// This allows editing other values even if some can't be decrypted
+		slog.Warn("cannot decrypt - keeping encrypted value", "key", key, "error", err)
+		encryptedKeys[key] = true
+	}
+	for key, value := range decrypted {
+		l.Entries[key] = value
+		encryptedKeys[key] = true
 	}
 	return encryptedKeys, nil
 }
@@ -319,6 +297,29 @@ func (l *Loadout) ReencryptSOPSValues(encryptedKeys map[string]bool) error {
 	return nil
 }
 
+// RotateSOPSValues re-encrypts every SOPS-encrypted value against the current
+// sops creation rules. Values that cannot be decrypted or encrypted are left
+// unchanged and returned with their error. If dryRun is set, values are only
+// decrypted to check they can be re-encrypted. Returns the sorted keys of the
+// values that were (or would be) re-encrypted.
+func (l *Loadout) RotateSOPSValues(dryRun bool) ([]string, map[string]error) {
+	rotated := []string{}
+	values, failed := sops.SOPSDecryptValues(l.Entries)
+	for key, decrypted := range values {
+		if !dryRun {
+			encrypted, err := sops.SOPSEncryptValue(decrypted)
+			if err != nil {
+				failed[key] = err
+				continue
+			}
+			l.Entries[key] = encrypted
+		}
+		rotated = append(rotated, key)
+	}
+	slices.Sort(rotated)
+	return rotated, failed
+}
+
 func (l *Loadout) PrintLoadout() error {
 
 	data, err := yaml.Marshal(l)
@@ -349,37 +350,21 @@ func InitLoadout() *Loadout {
 	return loadout
 }
 
-func CompareLoadouts(old Loadout, new Loadout) bool {
-	if old.Metadata.CreatedAt != new.Metadata.CreatedAt {
-		return true
-	}
-	if old.Metadata.LoadedAt != new.Metadata.LoadedAt {
-		return true
-	}
-	if old.Metadata.UpdatedAt != new.Metadata.UpdatedAt {
-		return true
-	}
-	if old.Metadata.Login != new.Metadata.Login {
-		return true
-	}
-	if len(old.Metadata.Tags) != len(new.Metadata.Tags) {
-		return true
-	}
-	for i, tag := range old.Metadata.Tags {
-		if tag != new.Metadata.Tags[i] {
-			return true
-		}
-	}
-	if old.Metadata.Description != new.Metadata.Description {
-		return true
-	}
-	if len(old.Entries) != len(new.Entries) {
-		return true
-	}
-	for key, value := range old.Entries {
-		if value != new.Entries[key] {
-			return true
+// Fingerprint returns a hash of the names, entries and metadata of the
+// loadouts in order, ignoring timestamps. It changes whenever exporting the
+// loadouts could produce different output.
+func Fingerprint(loadouts []*Loadout) string {
+	h := sha256.New()
+	for _, lo := range loadouts {
+		doc := lo.document()
+		doc.Metadata.CreatedAt = ""
+		doc.Metadata.LoadedAt = ""
+		doc.Metadata.UpdatedAt = ""
+		data, err := json.Marshal(doc)
+		if err != nil {
+			slog.Debug("failure marshaling loadout for fingerprint", "loadout", lo.Name, "error", err)
 		}
+		fmt.Fprintf(h, "%s\n%s\n", lo.Name, data)
 	}
-	return false
+	return hex.EncodeToString(h.Sum(nil))
 }
@@ -1,11 +1,6 @@
 package loadout
 
 import (
-	"bytes"
-	"io"
-	"os"
-	"regexp"
-	"strings"
 	"testing"
 	"time"
 
@@ -54,6 +49,30 @@ func TestValidateLoadout(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "list mode on list variable",
+			loadout: &Loadout{
+				Entries: map[string]string{"PYTHONPATH": "/opt/lib"},
+				Specs:   map[string]EntrySpec{"PYTHONPATH": {Mode: ModePrepend}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "list mode on other variable",
+			loadout: &Loadout{
+				Entries: map[string]string{"HOME": "/home/test"},
+				Specs:   map[string]EntrySpec{"HOME": {Mode: ModeAppend}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsupported mode",
+			loadout: &Loadout{
+				Entries: map[string]string{"KEY1": "value1"},
+				Specs:   map[string]EntrySpec{"KEY1": {Mode: "merge"}},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -130,6 +149,29 @@ entries:
     nested: value`,
 			wantErr: false,
 		},
+		{
+			name: "YAML with entry metadata",
+			yaml: `metadata:
+  createdAt: "2023-01-01T00:00:00Z"
+entries:
+  KEY1:
+    value: value1
+    description: first
+  KEY2:
+    value: value2
+    description: second`,
+			wantErr: false,
+		},
+		{
+			name: "YAML with duplicate keys after entry metadata",
+			yaml: `metadata:
+  createdAt: "2023-01-01T00:00:00Z"
+entries:
+  KEY1:
+    value: value1
+  KEY1: value2`,
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -514,6 +556,18 @@ func TestCompareLoadouts(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name: "different entry metadata",
+			old: Loadout{
+				Entries: map[string]string{"KEY1": "value1"},
+				Specs:   map[string]EntrySpec{"KEY1": {Description: "old"}},
+			},
+			new: Loadout{
+				Entries: map[string]string{"KEY1": "value1"},
+				Specs:   map[string]EntrySpec{"KEY1": {Description: "new"}},
+			},
+			want: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -537,290 +591,91 @@ func TestPrintLoadout(t *testing.T) {
 	}
 }
 
-func TestExport(t *testing.T) {
-	// Save original PATH
-	originalPath := os.Getenv("PATH")
-	defer os.Setenv("PATH", originalPath)
-
-	// Set a test PATH
-	testPath := "/test/path1:/test/path2"
-	os.Setenv("PATH", testPath)
-
-	loadout := InitLoadout()
-	loadout.Entries["TEST_VAR"] = "test_value"
-	loadout.Entries["PATH"] = "/new/path:$PATH"
-
-	// Export should not panic
-	loadout.Export()
-
-	// Verify PATH was updated
-	currentPath := os.Getenv("PATH")
-	if !strings.Contains(currentPath, "/new/path") {
-		t.Error("Export() should add new path to PATH")
+func TestContains(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		sub  string
+		want bool
+	}{
+		{"contains substring", "Hello World", "world", true},
+		{"contains substring case insensitive", "Hello World", "WORLD", true},
+		{"does not contain", "Hello World", "foo", false},
+		{"empty string", "", "test", false},
+		{"empty substring", "test", "", true},
 	}
 
-	// Test with empty value (should be skipped)
-	loadout2 := InitLoadout()
-	loadout2.Entries["EMPTY_VAR"] = ""
-	loadout2.Export() // Should not panic
-
-	// Verify LoadedAt was updated
-	if loadout.Metadata.LoadedAt == "" {
-		t.Error("Export() should update LoadedAt")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := utils.Contains(tt.s, tt.sub)
+			if got != tt.want {
+				t.Errorf("Contains() = %v, want %v", got, tt.want)
+			}
+		})
 	}
 }
 
-func TestExportWithSOPSEncryptedPATH(t *testing.T) {
-	// This test verifies the fix from 0.1.4-alpha:
-	// SOPS-encrypted PATH values should be decrypted before PATH expansion
-	// Skip test if SOPS is not available
+func TestFingerprint(t *testing.T) {
+	a := InitLoadout()
+	a.Name = "a"
+	a.Entries["KEY"] = "value"
+	b := InitLoadout()
+	b.Name = "b"
 
-	// Save original PATH
-	originalPath := os.Getenv("PATH")
-	defer os.Setenv("PATH", originalPath)
+	fingerprint := Fingerprint([]*Loadout{a, b})
 
-	// Set a test PATH
-	testPath := "/test/path1:/test/path2"
-	os.Setenv("PATH", testPath)
+	a.Metadata.LoadedAt = "2030-01-01T00:00:00Z"
+	a.Metadata.UpdatedAt = "2030-01-01T00:00:00Z"
+	if got := Fingerprint([]*Loadout{a, b}); got != fingerprint {
+		t.Error("Fingerprint() should ignore timestamps")
+	}
 
-	// Create a SOPS-encrypted PATH value that contains $PATH
-	// First, encrypt the value "/new/path:$PATH"
-	plainValue := "/new/path:$PATH"
-	encrypted, err := sops.SOPSEncryptValue(plainValue)
-	if err != nil {
-		t.Skipf("Cannot encrypt value for test (SOPS may not be configured): %v", err)
+	if got := Fingerprint([]*Loadout{b, a}); got == fingerprint {
+		t.Error("Fingerprint() should change with the loadout order")
 	}
 
-	loadout := InitLoadout()
-	loadout.Entries["PATH"] = encrypted
+	a.Specs = map[string]EntrySpec{"KEY": {Required: true}}
+	if got := Fingerprint([]*Loadout{a, b}); got == fingerprint {
+		t.Error("Fingerprint() should change with entry metadata")
+	}
+}
 
-	// Export should decrypt the value first, then expand $PATH
-	loadout.Export()
+func TestRotateSOPSValues(t *testing.T) {
+	lo := InitLoadout()
+	lo.Entries["PLAIN"] = "value"
+	lo.Entries["BROKEN"] = "SOPS:not-encrypted"
 
-	// Verify PATH was updated with both the new path and existing paths
-	currentPath := os.Getenv("PATH")
-	if !strings.Contains(currentPath, "/new/path") {
-		t.Error("Export() should add new path from SOPS-encrypted PATH value")
+	rotated, failed := lo.RotateSOPSValues(false)
+	if len(rotated) != 0 {
+		t.Errorf("RotateSOPSValues() rotated %v, want none", rotated)
 	}
-	if !strings.Contains(currentPath, "/test/path1") {
-		t.Error("Export() should preserve existing paths when expanding $PATH in SOPS-encrypted value")
+	if _, ok := failed["BROKEN"]; !ok || len(failed) != 1 {
+		t.Errorf("RotateSOPSValues() failed = %v, want BROKEN", failed)
 	}
-	if !strings.Contains(currentPath, "/test/path2") {
-		t.Error("Export() should preserve existing paths when expanding $PATH in SOPS-encrypted value")
+	if lo.Entries["BROKEN"] != "SOPS:not-encrypted" || lo.Entries["PLAIN"] != "value" {
+		t.Errorf("RotateSOPSValues() changed entries %v", lo.Entries)
 	}
 
-	// Verify LoadedAt was updated
-	if loadout.Metadata.LoadedAt == "" {
-		t.Error("Export() should update LoadedAt")
+	encrypted, err := sops.SOPSEncryptValue("secret")
+	if err != nil {
+		t.Skipf("Cannot encrypt value for test (SOPS may not be configured): %v", err)
 	}
-}
-
-func TestExportWithEmptyValues(t *testing.T) {
-	// Save original PATH
-	originalPath := os.Getenv("PATH")
-	defer os.Setenv("PATH", originalPath)
+	lo = InitLoadout()
+	lo.Entries["SECRET"] = encrypted
 
-	// Set a test PATH
-	testPath := "/test/path1:/test/path2"
-	os.Setenv("PATH", testPath)
-
-	tests := []struct {
-		name           string
-		entries        map[string]string
-		expectedInPath []string
-		notInPath      []string
-		shouldExport   map[string]bool // key -> should be exported
-	}{
-		{
-			name: "empty PATH entry should be skipped",
-			entries: map[string]string{
-				"PATH": "",
-				"VAR1": "value1",
-			},
-			expectedInPath: []string{"/test/path1", "/test/path2"},
-			notInPath:      []string{},
-			shouldExport: map[string]bool{
-				"VAR1": true,
-				"PATH": false, // Empty PATH should not be exported
-			},
-		},
-		{
-			name: "PATH with empty segments should skip empty parts",
-			entries: map[string]string{
-				"PATH": "/new/path1::/new/path2",
-			},
-			expectedInPath: []string{"/test/path1", "/test/path2", "/new/path1", "/new/path2"},
-			notInPath:      []string{""},
-			shouldExport: map[string]bool{
-				"PATH": true,
-			},
-		},
-		{
-			name: "PATH with leading/trailing colons should be trimmed",
-			entries: map[string]string{
-				"PATH": ":/new/path1:/new/path2:",
-			},
-			expectedInPath: []string{"/test/path1", "/test/path2", "/new/path1", "/new/path2"},
-			notInPath:      []string{""},
-			shouldExport: map[string]bool{
-				"PATH": true,
-			},
-		},
-		{
-			name: "PATH with only empty segments should preserve existing PATH",
-			entries: map[string]string{
-				"PATH": "::",
-			},
-			expectedInPath: []string{"/test/path1", "/test/path2"},
-			notInPath:      []string{""},
-			shouldExport: map[string]bool{
-				"PATH": true,
-			},
-		},
-		{
-			name: "empty non-PATH entries should be skipped",
-			entries: map[string]string{
-				"EMPTY_VAR": "",
-				"VAR1":      "value1",
-				"VAR2":      "value2",
-			},
-			expectedInPath: []string{"/test/path1", "/test/path2"},
-			notInPath:      []string{},
-			shouldExport: map[string]bool{
-				"EMPTY_VAR": false,
-				"VAR1":      true,
-				"VAR2":      true,
-			},
-		},
-		{
-			name: "PATH with $PATH expansion and empty segments",
-			entries: map[string]string{
-				"PATH": "/new/path1::$PATH:/new/path2:",
-			},
-			expectedInPath: []string{"/test/path1", "/test/path2", "/new/path1", "/new/path2"},
-			notInPath:      []string{""},
-			shouldExport: map[string]bool{
-				"PATH": true,
-			},
-		},
+	// A dry run leaves values unchanged
+	if rotated, failed := lo.RotateSOPSValues(true); len(rotated) != 1 || len(failed) != 0 || lo.Entries["SECRET"] != encrypted {
+		t.Errorf("RotateSOPSValues(dryRun) = %v, %v", rotated, failed)
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Reset PATH for each test
-			os.Setenv("PATH", testPath)
-
-			loadout := InitLoadout()
-			for k, v := range tt.entries {
-				loadout.Entries[k] = v
-			}
-
-			// Capture stdout output
-			oldStdout := os.Stdout
-			r, w, err := os.Pipe()
-			if err != nil {
-				t.Fatalf("Failed to create pipe: %v", err)
-			}
-			os.Stdout = w
-
-			// Capture output in a goroutine
-			var capturedOutput bytes.Buffer
-			done := make(chan error)
-			go func() {
-				_, err := io.Copy(&capturedOutput, r)
-				r.Close()
-				done <- err
-			}()
-
-			// Call Export() which will write to stdout
-			loadout.Export()
-
-			// Close write end and restore stdout
-			w.Close()
-			os.Stdout = oldStdout
-
-			// Wait for capture to complete
-			if err := <-done; err != nil {
-				t.Fatalf("Failed to capture output: %v", err)
-			}
-
-			// Parse captured output to extract exported variables
-			exportedVars := make(map[string]bool)
-			output := capturedOutput.String()
-			// Match lines like "export VAR=value" or "export PATH=..."
-			exportRegex := regexp.MustCompile(`^export (\w+)=`)
-			for _, line := range strings.Split(output, "\n") {
-				line = strings.TrimSpace(line)
-				if line == "" {
-					continue
-				}
-				matches := exportRegex.FindStringSubmatch(line)
-				if len(matches) > 1 {
-					varName := matches[1]
-					exportedVars[varName] = true
-				}
-			}
-
-			// Validate shouldExport expectations
-			if tt.shouldExport != nil {
-				for varName, shouldBeExported := range tt.shouldExport {
-					wasExported := exportedVars[varName]
-					if shouldBeExported && !wasExported {
-						t.Errorf("Expected %q to be exported, but it was not. Output:\n%s", varName, output)
-					}
-					if !shouldBeExported && wasExported {
-						t.Errorf("Expected %q NOT to be exported, but it was. Output:\n%s", varName, output)
-					}
-				}
-			}
-
-			// Verify PATH contents
-			currentPath := os.Getenv("PATH")
-			for _, expected := range tt.expectedInPath {
-				if !strings.Contains(currentPath, expected) {
-					t.Errorf("Expected PATH to contain %q, got %q", expected, currentPath)
-				}
-			}
-
-			for _, notExpected := range tt.notInPath {
-				if notExpected != "" && strings.Contains(currentPath, notExpected) {
-					t.Errorf("Expected PATH not to contain empty segment, got %q", currentPath)
-				}
-			}
-
-			// Verify PATH doesn't have double colons
-			if strings.Contains(currentPath, "::") {
-				t.Errorf("PATH should not contain double colons, got %q", currentPath)
-			}
-
-			// Verify LoadedAt was updated
-			if loadout.Metadata.LoadedAt == "" {
-				t.Error("Export() should update LoadedAt")
-			}
-		})
+	rotated, failed = lo.RotateSOPSValues(false)
+	if len(rotated) != 1 || len(failed) != 0 {
+		t.Fatalf("RotateSOPSValues() = %v, %v", rotated, failed)
 	}
-}
-
-func TestContains(t *testing.T) {
-	tests := []struct {
-		name string
-		s    string
-		sub  string
-		want bool
-	}{
-		{"contains substring", "Hello World", "world", true},
-		{"contains substring case insensitive", "Hello World", "WORLD", true},
-		{"does not contain", "Hello World", "foo", false},
-		{"empty string", "", "test", false},
-		{"empty substring", "test", "", true},
+	if lo.Entries["SECRET"] == encrypted {
+		t.Error("RotateSOPSValues() did not re-encrypt SECRET")
 	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			got := utils.Contains(tt.s, tt.sub)
-			if got != tt.want {
-				t.Errorf("Contains() = %v, want %v", got, tt.want)
-			}
-		})
+	if decrypted, err := sops.SOPSDecryptValue(lo.Entries["SECRET"]); err != nil || decrypted != "secret" {
+		t.Errorf("re-encrypted SECRET decrypts to %q, %v", decrypted, err)
 	}
 }
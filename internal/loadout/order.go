@@ -0,0 +1,79 @@
+package loadout
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OrderLoadouts returns the loadouts in export order. A loadout comes after
+// the loadouts named in its after hints that are being exported with it;
+// otherwise loadouts with a lower priority come first, and loadouts with the
+// same priority keep their given order. Returns an error if after hints form
+// a cycle.
+func OrderLoadouts(loadouts []*Loadout) ([]*Loadout, error) {
+	index := map[string]int{}
+	for i, lo := range loadouts {
+		index[lo.Name] = i
+	}
+
+	placed := make([]bool, len(loadouts))
+	ordered := make([]*Loadout, 0, len(loadouts))
+	ready := func(i int) bool {
+		for _, name := range loadouts[i].Metadata.After {
+			if j, ok := index[name]; ok && j != i && !placed[j] {
+				return false
+			}
+		}
+		return true
+	}
+
+	for len(ordered) < len(loadouts) {
+		next := -1
+		for i, lo := range loadouts {
+			if placed[i] || !ready(i) {
+				continue
+			}
+			if next == -1 || lo.Metadata.Priority < loadouts[next].Metadata.Priority {
+				next = i
+			}
+		}
+		if next == -1 {
+			return nil, fmt.Errorf("loadouts cannot be ordered, after hints form a cycle: %s", strings.Join(afterCycle(loadouts, index, placed), " -> "))
+		}
+		placed[next] = true
+		ordered = append(ordered, loadouts[next])
+	}
+	return ordered, nil
+}
+
+// afterCycle follows unmet after hints from the first unplaced loadout until
+// a loadout repeats, returning the names along the cycle
+func afterCycle(loadouts []*Loadout, index map[string]int, placed []bool) []string {
+	current := -1
+	for i := range loadouts {
+		if !placed[i] {
+			current = i
+			break
+		}
+	}
+
+	visited := map[int]int{}
+	chain := []string{}
+	for current != -1 {
+		if start, ok := visited[current]; ok {
+			return append(chain[start:], loadouts[current].Name)
+		}
+		visited[current] = len(chain)
+		chain = append(chain, loadouts[current].Name)
+
+		next := -1
+		for _, name := range loadouts[current].Metadata.After {
+			if j, ok := index[name]; ok && j != current && !placed[j] {
+				next = j
+				break
+			}
+		}
+		current = next
+	}
+	return chain
+}
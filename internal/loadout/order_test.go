@@ -0,0 +1,82 @@
+package loadout
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testOrderLoadout(name string, priority int, after ...string) *Loadout {
+	lo := InitLoadout()
+	lo.Name = name
+	lo.Metadata.Priority = priority
+	lo.Metadata.After = after
+	return lo
+}
+
+func TestOrderLoadouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		loadouts []*Loadout
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "given order without priorities",
+			loadouts: []*Loadout{testOrderLoadout("b", 0), testOrderLoadout("a", 0), testOrderLoadout("c", 0)},
+			want:     []string{"b", "a", "c"},
+		},
+		{
+			name:     "lower priority first",
+			loadouts: []*Loadout{testOrderLoadout("tools", 10), testOrderLoadout("base", -5), testOrderLoadout("aws", 0)},
+			want:     []string{"base", "aws", "tools"},
+		},
+		{
+			name:     "after overrides priority",
+			loadouts: []*Loadout{testOrderLoadout("go", -10, "tools"), testOrderLoadout("tools", 5)},
+			want:     []string{"tools", "go"},
+		},
+		{
+			name:     "after chain",
+			loadouts: []*Loadout{testOrderLoadout("c", 0, "b"), testOrderLoadout("b", 0, "a"), testOrderLoadout("a", 0)},
+			want:     []string{"a", "b", "c"},
+		},
+		{
+			name:     "after ignores loadouts not exported",
+			loadouts: []*Loadout{testOrderLoadout("b", 0, "missing"), testOrderLoadout("a", 1)},
+			want:     []string{"b", "a"},
+		},
+		{
+			name:     "after ignores itself",
+			loadouts: []*Loadout{testOrderLoadout("a", 0, "a")},
+			want:     []string{"a"},
+		},
+		{
+			name:     "cycle",
+			loadouts: []*Loadout{testOrderLoadout("x", 0), testOrderLoadout("a", 0, "b"), testOrderLoadout("b", 0, "a")},
+			wantErr:  "after hints form a cycle: a -> b -> a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered, err := OrderLoadouts(tt.loadouts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("OrderLoadouts() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OrderLoadouts() error = %v", err)
+			}
+			names := []string{}
+			for _, lo := range ordered {
+				names = append(names, lo.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("OrderLoadouts() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package loadout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/shell"
+)
+
+// Output formats supported in addition to the shell dialects
+const (
+	FormatShell  = "shell"
+	FormatJSON   = "json"
+	FormatDotenv = "dotenv"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{FormatShell, FormatJSON, FormatDotenv}
+
+// Renderer writes a resolved environment in a shell dialect or file format
+type Renderer interface {
+	Render(w io.Writer, env ResolvedEnv) error
+}
+
+// NewRenderer returns the renderer for format. The shell format renders
+// export statements in the dialect sh.
+func NewRenderer(format string, sh shell.Shell) (Renderer, error) {
+	switch format {
+	case "", FormatShell:
+		return ShellRenderer{Shell: sh}, nil
+	case FormatJSON:
+		return JSONRenderer{}, nil
+	case FormatDotenv:
+		return DotenvRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q (supported: %s)", format, strings.Join(Formats, ", "))
+	}
+}
+
+// ShellRenderer renders export statements for a shell dialect
+type ShellRenderer struct {
+	Shell shell.Shell
+}
+
+// Render writes one export statement per variable. Variables that cannot be
+// represented in the dialect are skipped and returned as a joined error.
+func (r ShellRenderer) Render(w io.Writer, env ResolvedEnv) error {
+	var errs []error
+	separators := ListSeparators()
+	for _, v := range env.Vars {
+		var statement string
+		var err error
+		if sep, ok := separators[v.Key]; ok {
+			statement, err = r.Shell.ExportWithSeparator(v.Key, sep, v.Value)
+		} else {
+			statement, err = r.Shell.Export(v.Key, v.Value)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := fmt.Fprintln(w, statement); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ScriptRenderer renders export statements for a script sourced later, such
+// as a login script. Environments must be resolved against ScriptBase.
+type ScriptRenderer struct {
+	Shell shell.Shell
+}
+
+// Render writes one export statement per variable. List variables are merged
+// with their value when the script is sourced; list variables that only
+// remove segments are skipped. Variables that cannot be represented in the
+// dialect are skipped and returned as a joined error.
+func (r ScriptRenderer) Render(w io.Writer, env ResolvedEnv) error {
+	var errs []error
+	separators := ListSeparators()
+	for _, v := range env.Vars {
+		var statement string
+		var err error
+
+		sep, isList := separators[v.Key]
+		segments := strings.Split(v.Value, sep)
+		if at := slices.Index(segments, ListMarker); isList && at >= 0 {
+			before, after := segments[:at], segments[at+1:]
+			if len(before) == 0 && len(after) == 0 {
+				continue
+			}
+			statement, err = r.Shell.ExportList(v.Key, sep, before, after)
+		} else if isList {
+			statement, err = r.Shell.ExportWithSeparator(v.Key, sep, v.Value)
+		} else {
+			statement, err = r.Shell.Export(v.Key, v.Value)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := fmt.Fprintln(w, statement); err != nil {
+			return err
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// JSONRenderer renders the variables as a JSON object
+type JSONRenderer struct{}
+
+// Render writes the variables as an indented JSON object
+func (JSONRenderer) Render(w io.Writer, env ResolvedEnv) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(env.Map())
+}
+
+// DotenvRenderer renders the variables as a .env file
+type DotenvRenderer struct{}
+
+// Render writes one KEY="VALUE" line per variable with backslashes, quotes,
+// dollar signs and newlines escaped
+func (DotenvRenderer) Render(w io.Writer, env ResolvedEnv) error {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`, "\r", `\r`)
+	for _, v := range env.Vars {
+		if _, err := fmt.Fprintf(w, "%s=\"%s\"\n", v.Key, r.Replace(v.Value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
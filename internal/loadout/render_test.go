@@ -0,0 +1,130 @@
+package loadout
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gmherb/envtab/internal/shell"
+)
+
+func testResolvedEnv() ResolvedEnv {
+	return ResolvedEnv{Vars: []Variable{
+		{Key: "PATH", Value: "/usr/bin:/opt/bin"},
+		{Key: "GREETING", Value: `say "hi" $USER`},
+	}}
+}
+
+func TestNewRenderer(t *testing.T) {
+	tests := []struct {
+		format  string
+		want    Renderer
+		wantErr bool
+	}{
+		{"", ShellRenderer{Shell: shell.Fish}, false},
+		{FormatShell, ShellRenderer{Shell: shell.Fish}, false},
+		{FormatJSON, JSONRenderer{}, false},
+		{FormatDotenv, DotenvRenderer{}, false},
+		{"yaml", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			got, err := NewRenderer(tt.format, shell.Fish)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewRenderer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NewRenderer() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		renderer Renderer
+		want     string
+	}{
+		{
+			"bash",
+			ShellRenderer{Shell: shell.Bash},
+			"export PATH=/usr/bin:/opt/bin\nexport GREETING='say \"hi\" $USER'\n",
+		},
+		{
+			"fish",
+			ShellRenderer{Shell: shell.Fish},
+			"set -gx PATH /usr/bin /opt/bin\nset -gx GREETING 'say \"hi\" $USER'\n",
+		},
+		{
+			"json",
+			JSONRenderer{},
+			"{\n  \"GREETING\": \"say \\\"hi\\\" $USER\",\n  \"PATH\": \"/usr/bin:/opt/bin\"\n}\n",
+		},
+		{
+			"dotenv",
+			DotenvRenderer{},
+			"PATH=\"/usr/bin:/opt/bin\"\nGREETING=\"say \\\"hi\\\" \\$USER\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.renderer.Render(&buf, testResolvedEnv()); err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Render() = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestShellRendererSkipsUnrepresentable(t *testing.T) {
+	env := ResolvedEnv{Vars: []Variable{
+		{Key: "QUOTED", Value: `a"b`},
+		{Key: "PLAIN", Value: "value"},
+	}}
+
+	var buf bytes.Buffer
+	err := (ShellRenderer{Shell: shell.Cmd}).Render(&buf, env)
+	if err == nil {
+		t.Error("Render() should return error for value cmd cannot represent")
+	}
+	if buf.String() != "set \"PLAIN=value\"\n" {
+		t.Errorf("Render() = %q, want only PLAIN", buf.String())
+	}
+}
+
+func TestScriptRenderer(t *testing.T) {
+	lo := InitLoadout()
+	lo.Name = "base"
+	lo.Entries = map[string]string{
+		"PATH":       "$HOME/bin:$PATH",
+		"MANPATH":    "/opt/man",
+		"PYTHONPATH": "-/old",
+		"GOPATH":     "/go",
+		"GREETING":   "hi $USER",
+	}
+	lo.Specs = map[string]EntrySpec{"GOPATH": {Mode: ModeReplace}}
+
+	base := ScriptBase(map[string]string{"HOME": "/home/me", "USER": "me", "PATH": "/usr/bin"})
+	resolved, _, err := lo.Resolve(t.Context(), base)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := (ScriptRenderer{Shell: shell.Bash}).Render(&buf, resolved); err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	want := "export GOPATH=/go\n" +
+		"export GREETING='hi me'\n" +
+		"export MANPATH=\"${MANPATH:+$MANPATH:}\"/opt/man\n" +
+		"export PATH=/home/me/bin\"${PATH:+:$PATH}\"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,455 @@
+package loadout
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/shell"
+	"github.com/gmherb/envtab/internal/sops"
+)
+
+// Variable is an environment variable resolved from a loadout entry
+type Variable struct {
+	Key   string
+	Value string
+	// Source is the name of the loadout the variable was resolved from
+	Source string
+	// Encrypted is true if the value was decrypted from a SOPS value
+	Encrypted bool
+	// Sensitive is true if the entry is marked sensitive
+	Sensitive bool
+}
+
+// ResolvedEnv is the ordered list of variables resolved from one or more loadouts
+type ResolvedEnv struct {
+	Vars []Variable
+}
+
+// Get returns the resolved variable for key
+func (r ResolvedEnv) Get(key string) (Variable, bool) {
+	for _, v := range r.Vars {
+		if v.Key == key {
+			return v, true
+		}
+	}
+	return Variable{}, false
+}
+
+// Map returns the resolved variables as a key/value map
+func (r ResolvedEnv) Map() map[string]string {
+	m := make(map[string]string, len(r.Vars))
+	for _, v := range r.Vars {
+		m[v.Key] = v.Value
+	}
+	return m
+}
+
+// Apply returns a copy of base with the resolved variables set
+func (r ResolvedEnv) Apply(base map[string]string) map[string]string {
+	m := make(map[string]string, len(base)+len(r.Vars))
+	for k, v := range base {
+		m[k] = v
+	}
+	for _, v := range r.Vars {
+		m[v.Key] = v.Value
+	}
+	return m
+}
+
+// set adds a variable, replacing an earlier variable with the same key in place
+func (r *ResolvedEnv) set(v Variable) {
+	for i := range r.Vars {
+		if r.Vars[i].Key == v.Key {
+			r.Vars[i] = v
+			return
+		}
+	}
+	r.Vars = append(r.Vars, v)
+}
+
+// Warning describes a loadout entry that was skipped while resolving
+type Warning struct {
+	Source  string
+	Key     string
+	Message string
+	Err     error
+}
+
+func (w Warning) String() string {
+	s := fmt.Sprintf("%s: %s: %s", w.Source, w.Key, w.Message)
+	if w.Err != nil {
+		s += ": " + w.Err.Error()
+	}
+	return s
+}
+
+var reSOPS = regexp.MustCompile(`^SOPS:`)
+
+// node is a loadout entry in the dependency graph built by ResolveAll
+type node struct {
+	index     int
+	source    string
+	key       string
+	value     string
+	encrypted bool
+	spec      EntrySpec
+
+	// refs maps each referenced variable to the entry providing it (nil for base)
+	refs map[string]*node
+	// prev is the definition of the same key in an earlier loadout
+	prev *node
+	deps []*node
+
+	resolved string
+	ok       bool
+}
+
+func (n *node) label() string {
+	if n.source == "" {
+		return n.key
+	}
+	return n.source + ":" + n.key
+}
+
+// less orders nodes by loadout position, then key
+func (n *node) less(o *node) bool {
+	if n.index != o.index {
+		return n.index < o.index
+	}
+	return n.key < o.key
+}
+
+// Resolve returns the loadout entries as environment variables, with SOPS
+// values decrypted and variables expanded against the loadout itself and base.
+// List variable entries (see ListVariables) are merged into base's lists.
+// Neither base nor the process environment is modified. Entries that cannot
+// be resolved are skipped and returned as warnings. See ResolveAll for ordering.
+func (l Loadout) Resolve(ctx context.Context, base map[string]string) (ResolvedEnv, []Warning, error) {
+	return ResolveAll(ctx, []*Loadout{&l}, base)
+}
+
+// ResolveAll resolves the entries of the loadouts in dependency order.
+//
+// A reference ($VAR, ${VAR}, ${VAR:-default}, ...) is satisfied by the entry of the same loadout, otherwise
+// by the last loadout defining VAR, otherwise by base. A reference to the
+// entry's own key (e.g. PATH: $PATH:/bin) refers to the previous definition.
+// Later loadouts override earlier ones and list variables such as PATH
+// accumulate. Entries are otherwise ordered by loadout and key. A dependency
+// cycle, a failed ${VAR:?message} requirement or a required entry resolving
+// to an empty value is an error. Entry defaults apply when the value is empty.
+func ResolveAll(ctx context.Context, loadouts []*Loadout, base map[string]string) (ResolvedEnv, []Warning, error) {
+	warnings := []Warning{}
+	nodes := []*node{}
+	defs := map[string][]*node{}
+
+	for i, l := range loadouts {
+		keys := make([]string, 0, len(l.Entries))
+		for key := range l.Entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		// Decrypt the SOPS values of the loadout in one batch
+		decrypted, failed := sops.SOPSDecryptValues(l.Entries)
+
+		for _, key := range keys {
+			value := l.Entries[key]
+			spec := l.Spec(key)
+			// Empty entries are skipped unless a default or requirement applies
+			if value == "" && spec.Default == "" && !spec.Required {
+				continue
+			}
+
+			if err := shell.ValidateKey(key); err != nil {
+				warnings = append(warnings, Warning{Source: l.Name, Key: key, Message: "invalid key", Err: err})
+				continue
+			}
+			if err := spec.Validate(key); err != nil {
+				warnings = append(warnings, Warning{Source: l.Name, Key: key, Message: "invalid entry metadata", Err: err})
+				continue
+			}
+
+			encrypted := false
+			if reSOPS.MatchString(value) {
+				if err := failed[key]; err != nil {
+					errStr := strings.ToLower(err.Error())
+					switch {
+					case strings.Contains(errStr, "sops command not found"):
+						warnings = append(warnings, Warning{Source: l.Name, Key: key, Message: "SOPS not available"})
+					case strings.Contains(errStr, "keys may have been rotated"):
+						warnings = append(warnings, Warning{Source: l.Name, Key: key, Message: "cannot decrypt - encryption keys may have been rotated", Err: err})
+					default:
+						warnings = append(warnings, Warning{Source: l.Name, Key: key, Message: "failure decrypting SOPS value", Err: err})
+					}
+					continue
+				}
+				value = decrypted[key]
+				encrypted = true
+			}
+
+			n := &node{index: i, source: l.Name, key: key, value: value, encrypted: encrypted, spec: spec, refs: map[string]*node{}}
+			if d := defs[key]; len(d) > 0 {
+				n.prev = d[len(d)-1]
+			}
+			defs[key] = append(defs[key], n)
+			nodes = append(nodes, n)
+		}
+	}
+
+	// Link each reference to the entry providing it
+	for _, n := range nodes {
+		for _, ref := range append(References(n.value), References(n.spec.Default)...) {
+			var target *node
+			if ref == n.key {
+				target = n.prev
+			} else if d := defs[ref]; len(d) > 0 {
+				target = d[len(d)-1]
+				for _, candidate := range d {
+					if candidate.index == n.index {
+						target = candidate
+					}
+				}
+			}
+			n.refs[ref] = target
+			if target != nil {
+				n.deps = append(n.deps, target)
+			}
+		}
+		// Earlier definitions are resolved first so later loadouts override them
+		if n.prev != nil {
+			n.deps = append(n.deps, n.prev)
+		}
+	}
+
+	order, err := sortNodes(nodes)
+	if err != nil {
+		return ResolvedEnv{}, warnings, err
+	}
+
+	separators := ListSeparators()
+	resolved := ResolvedEnv{Vars: []Variable{}}
+	for _, n := range order {
+		if err := ctx.Err(); err != nil {
+			return ResolvedEnv{}, warnings, err
+		}
+		if err := resolveNode(n, base, separators); err != nil {
+			return ResolvedEnv{}, warnings, fmt.Errorf("%s: %w", n.label(), err)
+		}
+		if n.ok {
+			resolved.set(Variable{Key: n.key, Value: n.resolved, Source: n.source, Encrypted: n.encrypted, Sensitive: n.spec.Sensitive})
+		}
+	}
+
+	return resolved, warnings, nil
+}
+
+// sortNodes orders nodes so every node comes after its dependencies, breaking
+// ties by loadout position and key. Returns an error describing a cycle if
+// the nodes cannot be ordered.
+func sortNodes(nodes []*node) ([]*node, error) {
+	pending := map[*node]int{}
+	dependents := map[*node][]*node{}
+	for _, n := range nodes {
+		seen := map[*node]bool{}
+		for _, d := range n.deps {
+			if !seen[d] {
+				seen[d] = true
+				pending[n]++
+				dependents[d] = append(dependents[d], n)
+			}
+		}
+	}
+
+	ready := []*node{}
+	for _, n := range nodes {
+		if pending[n] == 0 {
+			ready = append(ready, n)
+		}
+	}
+
+	order := []*node{}
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return ready[i].less(ready[j]) })
+		n := ready[0]
+		ready = ready[1:]
+		order = append(order, n)
+		for _, d := range dependents[n] {
+			pending[d]--
+			if pending[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+
+	if len(order) < len(nodes) {
+		return nil, cycleError(nodes, pending)
+	}
+	return order, nil
+}
+
+// cycleError returns an error naming the entries of a cycle among the nodes
+// that could not be ordered
+func cycleError(nodes []*node, pending map[*node]int) error {
+	var start *node
+	for _, n := range nodes {
+		if pending[n] > 0 && (start == nil || n.less(start)) {
+			start = n
+		}
+	}
+
+	// Follow unresolved dependencies until an entry repeats
+	path := []*node{}
+	visited := map[*node]int{}
+	for n := start; n != nil; {
+		if i, ok := visited[n]; ok {
+			path = append(path[i:], n)
+			break
+		}
+		visited[n] = len(path)
+		path = append(path, n)
+
+		var next *node
+		for _, d := range n.deps {
+			if pending[d] > 0 && (next == nil || d.less(next)) {
+				next = d
+			}
+		}
+		n = next
+	}
+
+	labels := make([]string, 0, len(path))
+	for _, n := range path {
+		labels = append(labels, n.label())
+	}
+	return fmt.Errorf("dependency cycle between entries: %s", strings.Join(labels, " -> "))
+}
+
+// resolveNode expands the node's value using the entries it references,
+// falling back to base for variables no entry provides. separators are the
+// list variables, as returned by ListSeparators.
+func resolveNode(n *node, base map[string]string, separators map[string]string) error {
+	lookup := func(name string) (string, bool) {
+		if target := n.refs[name]; target != nil && target.ok {
+			return target.resolved, true
+		}
+		value, ok := base[name]
+		return value, ok
+	}
+
+	if sep, ok := separators[n.key]; ok {
+		if err := resolveList(n, sep, base, lookup); err != nil {
+			return err
+		}
+	} else {
+		// Expand all variables in the value, falling back to the default
+		value, err := Expand(n.value, lookup)
+		if err != nil {
+			return err
+		}
+		if value == "" && n.spec.Default != "" {
+			if value, err = Expand(n.spec.Default, lookup); err != nil {
+				return err
+			}
+		}
+		if value == "" {
+			slog.Debug("skipping empty value after variable expansion", "key", n.key)
+		} else {
+			n.resolved = value
+			n.ok = true
+		}
+	}
+
+	if n.spec.Required && n.resolved == "" {
+		return fmt.Errorf("required entry resolved to an empty value")
+	}
+	return nil
+}
+
+// resolveList resolves an entry of a list variable such as PATH. Without a
+// mode, a reference to the variable itself places the previous list (the
+// earlier definition or base) within the value, so /opt/bin:$PATH prepends and
+// $PATH:/opt/bin appends; without one the segments are appended. Segments
+// prefixed with RemovePrefix are removed from the list. Duplicates keep their
+// first position. With replace, the previous list is dropped unless the value
+// references it, in which case it is placed the same way. With prepend, append
+// and remove, the mode alone decides where segments go: references to the
+// variable itself are ignored, so $PATH:/opt/bin still prepends /opt/bin with
+// prepend. An empty value uses the entry's default.
+func resolveList(n *node, sep string, base map[string]string, lookup func(string) (string, bool)) error {
+	current := SplitList(base[n.key], sep)
+	if n.prev != nil && n.prev.ok {
+		current = SplitList(n.prev.resolved, sep)
+	}
+
+	// The previous list is expanded to a placeholder so its own segments are
+	// never mistaken for removals
+	placeholder := "\x00" + n.key + "\x00"
+	raw := n.value
+	if raw == "" {
+		raw = n.spec.Default
+	}
+	value, err := Expand(raw, func(name string) (string, bool) {
+		if name == n.key {
+			if len(current) == 0 {
+				_, set := lookup(name)
+				return "", set
+			}
+			return placeholder, true
+		}
+		return lookup(name)
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Debug("found potential new list segment(s)", "key", n.key, "value", value)
+
+	// Only the default and replace modes place the previous list by reference
+	positional := n.spec.Mode == "" || n.spec.Mode == ModeReplace
+
+	list := []string{}
+	removed := map[string]bool{}
+	hasSelf := false
+	for _, segment := range strings.Split(value, sep) {
+		switch {
+		case segment == placeholder && !positional:
+		case segment == placeholder:
+			hasSelf = true
+			list = append(list, current...)
+		case strings.Contains(segment, placeholder):
+			hasSelf = true
+			list = append(list, strings.ReplaceAll(segment, placeholder, strings.Join(current, sep)))
+		case segment == "":
+		case n.spec.Mode == ModeRemove:
+			removed[segment] = true
+		case strings.HasPrefix(segment, RemovePrefix) && len(segment) > len(RemovePrefix):
+			removed[strings.TrimPrefix(segment, RemovePrefix)] = true
+		default:
+			list = append(list, segment)
+		}
+	}
+	switch {
+	case n.spec.Mode == ModePrepend:
+		list = append(list, current...)
+	case positional && (hasSelf || n.spec.Mode == ModeReplace):
+	default:
+		list = append(current, list...)
+	}
+
+	kept := []string{}
+	seen := map[string]bool{}
+	for _, segment := range list {
+		if seen[segment] || removed[segment] {
+			continue
+		}
+		seen[segment] = true
+		kept = append(kept, segment)
+	}
+
+	n.resolved = strings.Join(kept, sep)
+	n.ok = true
+	return nil
+}
@@ -4,190 +4,361 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"os/user"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+
+	"github.com/gmherb/envtab/internal/shell"
+	"github.com/gmherb/envtab/internal/utils"
+)
+
+// Shells lists the dialects login can be enabled for
+var Shells = []shell.Shell{shell.Bash, shell.Zsh, shell.Fish, shell.Tcsh}
+
+// Login modes
+const (
+	// ModeCommand runs envtab login on every login shell
+	ModeCommand = "command substitution"
+	// ModeRaw sources a raw login script generated ahead of time
+	ModeRaw = "raw"
+)
+
+// The envtab block in a login script is fenced by these lines, so it can be
+// found and replaced wherever the envtab binary is installed
+const (
+	blockStart = "# >>> envtab >>>"
+	blockEnd   = "# <<< envtab <<<"
+	blockNote  = "# Managed by envtab login; changes inside this block are overwritten."
 )
 
-var loginScripts = []string{
-	".bash_profile",
-	".bash_login",
-	".profile",
-	".zprofile",
-	".login",
+// backupSuffix is appended to a login script's path to back it up before writing
+const backupSuffix = ".envtab.bak"
+
+// legacyLinePattern matches the login line written before the envtab block
+// (e.g. eval "$(/usr/local/bin/envtab login)"), wherever envtab was installed
+var legacyLinePattern = regexp.MustCompile(`\$\(\S*envtab\S* login\)`)
+
+// Status describes whether and how login is enabled
+type Status struct {
+	Enabled bool
+	Mode    string
+	// LoginScript is the login script envtab is enabled in
+	LoginScript string
+	// Shell is the dialect of the raw login script in raw mode
+	Shell shell.Shell
 }
 
-// getEnvtabLoginLine returns the login line with the absolute path to the binary
-func getEnvtabLoginLine() string {
-	execPath, err := os.Executable()
-	if err != nil {
-		slog.Error("failure getting executable path", "error", err)
-		os.Exit(1)
-	}
-	// os.Executable() may return a relative path on some systems, so ensure it's absolute
-	absPath, err := filepath.Abs(execPath)
-	if err != nil {
-		slog.Error("failure getting absolute path", "error", err)
-		os.Exit(1)
+// checkShell returns an error if login cannot be enabled for sh
+func checkShell(sh shell.Shell) error {
+	if !slices.Contains(Shells, sh) {
+		names := []string{}
+		for _, s := range Shells {
+			names = append(names, string(s))
+		}
+		return fmt.Errorf("login is not supported for %s (supported: %s)", sh, strings.Join(names, ", "))
 	}
-	return fmt.Sprintf("$(%s login)", absPath)
+	return nil
 }
 
-func detectLoginScript() string {
-	shell := os.Getenv("SHELL")
-
-	usr, err := user.Current()
-	if err != nil {
-		slog.Error("failure getting user's home directory", "error", err)
-		os.Exit(1)
-	}
-
-	switch shell {
-	case "/bin/bash":
-		if _, err := os.Stat(usr.HomeDir + "/.bash_profile"); err == nil {
-			return usr.HomeDir + "/.bash_profile"
-		} else if _, err := os.Stat(usr.HomeDir + "/.bash_login"); err == nil {
-			return usr.HomeDir + "/.bash_login"
-		} else {
-			return usr.HomeDir + "/.profile"
-		}
-	case "/bin/zsh":
-		return usr.HomeDir + "/.zprofile"
-	case "/bin/tcsh":
-		return usr.HomeDir + "/.login"
-	case "/bin/csh":
-		return usr.HomeDir + "/.login"
-	default:
-		return usr.HomeDir + "/.profile"
+// fishConfig returns the path of fish's config.fish
+func fishConfig(home string) string {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
 	}
+	return filepath.Join(configHome, "fish", "config.fish")
 }
 
-func EnableLogin() {
-	loginScript := detectLoginScript()
-	slog.Debug("detected login script", "script", loginScript)
-	envtabLogin := getEnvtabLoginLine()
-
-	content, err := os.ReadFile(loginScript)
+// LoginScript returns the login script for sh: the first existing of
+// ~/.bash_profile, ~/.bash_login and ~/.profile for bash, ~/.zprofile for
+// zsh, config.fish for fish and ~/.login for tcsh
+func LoginScript(sh shell.Shell) (string, error) {
+	if err := checkShell(sh); err != nil {
+		return "", err
+	}
+	home, err := os.UserHomeDir()
 	if err != nil {
-		slog.Error("failure reading login script", "script", loginScript, "error", err)
-		os.Exit(1)
+		return "", fmt.Errorf("failed to get home directory: %w", err)
 	}
 
-	if strings.Contains(string(content), envtabLogin) {
-		slog.Debug("login script already contains envtab", "script", loginScript)
-		os.Exit(0)
+	switch sh {
+	case shell.Zsh:
+		return filepath.Join(home, ".zprofile"), nil
+	case shell.Fish:
+		return fishConfig(home), nil
+	case shell.Tcsh:
+		return filepath.Join(home, ".login"), nil
+	default:
+		for _, name := range []string{".bash_profile", ".bash_login"} {
+			if _, err := os.Stat(filepath.Join(home, name)); err == nil {
+				return filepath.Join(home, name), nil
+			}
+		}
+		return filepath.Join(home, ".profile"), nil
 	}
+}
 
-	f, err := os.OpenFile(loginScript, os.O_APPEND|os.O_WRONLY, 0600)
+// loginScripts returns every login script envtab may be enabled in
+func loginScripts() ([]string, error) {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		slog.Error("failure opening login script", "script", loginScript, "error", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
 	}
-	defer f.Close()
-
-	if _, err = f.WriteString("\n" + envtabLogin); err != nil {
-		slog.Error("failure writing to login script", "script", loginScript, "error", err)
-		os.Exit(1)
+	scripts := []string{}
+	for _, name := range []string{".bash_profile", ".bash_login", ".profile", ".zprofile", ".login"} {
+		scripts = append(scripts, filepath.Join(home, name))
 	}
-
+	return append(scripts, fishConfig(home)), nil
 }
 
-func DisableLogin() {
-	usr, err := user.Current()
+// loginLines returns the lines of the envtab block for sh. In raw mode they
+// source the raw login script, otherwise they evaluate envtab login.
+func loginLines(sh shell.Shell, raw bool) ([]string, error) {
+	target := RawScriptPath(sh)
+	if !raw {
+		execPath, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get executable path: %w", err)
+		}
+		// os.Executable() may return a relative path on some systems, so ensure it's absolute
+		if target, err = filepath.Abs(execPath); err != nil {
+			return nil, fmt.Errorf("failed to get absolute path: %w", err)
+		}
+	}
+	quoted, err := sh.Quote(target)
 	if err != nil {
-		slog.Error("failure getting user's home directory", "error", err)
-		os.Exit(1)
+		return nil, fmt.Errorf("failed to quote %s: %w", target, err)
 	}
-	for _, loginScript := range loginScripts {
-		removeEnvtabFromScript(usr.HomeDir + "/" + loginScript)
+
+	switch {
+	case raw && sh == shell.Fish:
+		return []string{fmt.Sprintf("test -f %s; and source %s", quoted, quoted)}, nil
+	case raw && sh == shell.Tcsh:
+		return []string{fmt.Sprintf("if ( -f %s ) source %s", quoted, quoted)}, nil
+	case raw:
+		return []string{fmt.Sprintf("[ -f %s ] && . %s", quoted, quoted)}, nil
+	case sh == shell.Fish:
+		return []string{fmt.Sprintf("%s login --shell fish | source", quoted)}, nil
+	case sh == shell.Tcsh:
+		// tcsh cannot evaluate multi-line command output, so it is sourced from a temporary file
+		return []string{
+			"set envtab_login = \"`mktemp`\"",
+			fmt.Sprintf(`%s login --shell tcsh >! "$envtab_login" && source "$envtab_login"`, quoted),
+			`rm -f "$envtab_login"; unset envtab_login`,
+		}, nil
+	default:
+		// The output is quoted, so it must be evaluated rather than word split
+		return []string{fmt.Sprintf(`eval "$(%s login --shell %s)"`, quoted, sh)}, nil
 	}
 }
 
-func removeEnvtabFromScript(loginScript string) {
-	slog.Debug("removing envtab from login script", "script", loginScript)
-	content, err := os.ReadFile(loginScript)
+// Enable writes the envtab block evaluating envtab login to the login script
+// for sh, replacing a raw login block, and removes the raw login script for sh
+func Enable(sh shell.Shell) error {
+	return enable(sh, false)
+}
 
-	// ignore error if file doesn't exist
-	if os.IsNotExist(err) {
-		slog.Debug("login script does not exist", "script", loginScript)
-		return
-	} else if err != nil {
-		slog.Error("failure reading login script", "script", loginScript, "error", err)
-		os.Exit(1)
-	}
+// EnableRaw writes the envtab block sourcing the raw login script for sh to
+// the login script for sh. The raw login script must have been written with
+// WriteRawScript.
+func EnableRaw(sh shell.Shell) error {
+	return enable(sh, true)
+}
 
-	// Get file info to preserve permissions
-	fileInfo, err := os.Stat(loginScript)
+func enable(sh shell.Shell, raw bool) error {
+	loginScript, err := LoginScript(sh)
 	if err != nil {
-		slog.Error("failure getting file info", "script", loginScript, "error", err)
-		os.Exit(1)
+		return err
 	}
+	slog.Debug("detected login script", "script", loginScript, "shell", sh)
 
-	envtabLoginLine := getEnvtabLoginLine()
-	// ignore if login script doesn't contain `envtabLoginLine`
-	if !strings.Contains(string(content), envtabLoginLine) {
-		slog.Debug("login script does not contain envtab", "script", loginScript)
-		return
+	lines, err := loginLines(sh, raw)
+	if err != nil {
+		return err
 	}
-	slog.Debug("login script contains envtab", "script", loginScript)
-	// iterate over the lines, looking for `envtabLoginLine`
-	lines := strings.Split(string(content), "\n")
-	newlines := []string{}
-	for i, line := range lines {
-		if !strings.Contains(line, envtabLoginLine) {
-			newlines = append(newlines, line)
-			slog.Debug("keeping line from login script", "script", loginScript, "line", i, "content", line)
-		} else {
-			slog.Debug("removing line from login script", "script", loginScript, "line", i)
+	if err := updateScript(loginScript, lines); err != nil {
+		return err
+	}
+
+	if !raw {
+		if _, err := os.Stat(RawScriptPath(sh)); err == nil {
+			slog.Debug("removing raw login script", "script", RawScriptPath(sh))
+			if err := os.Remove(RawScriptPath(sh)); err != nil {
+				return fmt.Errorf("failed to remove raw login script: %w", err)
+			}
 		}
 	}
-	output := strings.Join(newlines, "\n")
+	return nil
+}
 
-	// Overwrite the login script with the updated content, preserving permissions
-	f, err := os.OpenFile(loginScript, os.O_WRONLY|os.O_TRUNC, fileInfo.Mode())
+// Disable removes the envtab block and login lines written before it from all
+// login scripts, and removes the raw login scripts
+func Disable() error {
+	scripts, err := loginScripts()
 	if err != nil {
-		slog.Error("failure opening login script", "script", loginScript, "error", err)
-		os.Exit(1)
+		return err
 	}
-	defer f.Close()
-
-	if _, err = f.WriteString(output); err != nil {
-		slog.Error("failure writing to login script", "script", loginScript, "error", err)
-		os.Exit(1)
+	for _, loginScript := range scripts {
+		if err := updateScript(loginScript, nil); err != nil {
+			return err
+		}
 	}
-
+	return removeRawScripts()
 }
 
-func ShowLoginStatus() {
-	usr, err := user.Current()
+// GetStatus returns whether login is enabled, in which login script and in
+// which mode
+func GetStatus() (Status, error) {
+	scripts, err := loginScripts()
 	if err != nil {
-		slog.Error("failure getting user's home directory", "error", err)
-		os.Exit(1)
+		return Status{}, err
 	}
-	var loginScriptPath string
-	for _, loginScript := range loginScripts {
-		loginScriptPath = usr.HomeDir + "/" + loginScript
 
+	for _, loginScript := range scripts {
 		slog.Debug("checking login script for envtab", "script", loginScript)
-		content, err := os.ReadFile(loginScriptPath)
+		content, err := os.ReadFile(loginScript)
 
 		// ignore error if file doesn't exist
 		if os.IsNotExist(err) {
 			slog.Debug("login script does not exist", "script", loginScript)
 			continue
 		} else if err != nil {
-			slog.Error("failure reading login script", "script", loginScript, "error", err)
-			os.Exit(1)
+			return Status{}, fmt.Errorf("failed to read login script %s: %w", loginScript, err)
+		}
+
+		block, found := findBlock(string(content))
+		if !found {
+			continue
+		}
+		slog.Debug("login script contains envtab", "script", loginScript)
+
+		status := Status{Enabled: true, Mode: ModeCommand, LoginScript: loginScript}
+		if sh, ok := rawShell(block); ok {
+			status.Mode = ModeRaw
+			status.Shell = sh
+		}
+		return status, nil
+	}
+	return Status{}, nil
+}
+
+// findBlock returns the envtab block of a login script, or the login line
+// written before the block, and whether one was found
+func findBlock(content string) (string, bool) {
+	if start := strings.Index(content, blockStart); start >= 0 {
+		block := content[start:]
+		if end := strings.Index(block, blockEnd); end >= 0 {
+			block = block[:end]
 		}
+		return block, true
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if legacyLinePattern.MatchString(line) {
+			return line, true
+		}
+	}
+	return "", false
+}
+
+// replaceBlock returns content with the envtab block set to lines, or removed
+// if lines is nil. An existing block is replaced in place and a new block is
+// appended after a blank line. Login lines written before the block are
+// removed. Returns an error if a block is not terminated.
+func replaceBlock(content string, lines []string) (string, error) {
+	block := ""
+	if lines != nil {
+		block = strings.Join(append(append([]string{blockStart, blockNote}, lines...), blockEnd), "\n") + "\n"
+	}
 
-		envtabLoginLine := getEnvtabLoginLine()
-		// Print enabled if the login script contains `envtabLoginLine`
-		if strings.Contains(string(content), envtabLoginLine) {
-			slog.Debug("login script contains envtab", "script", loginScript)
-			fmt.Printf("enabled\n")
-			return
+	var b strings.Builder
+	inBlock, placed := false, false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case trimmed == blockStart:
+			inBlock = true
+			if lines == nil {
+				// Drop the blank line separating the block from the rest of the script
+				if s := b.String(); strings.HasSuffix(s, "\n\n") {
+					b.Reset()
+					b.WriteString(s[:len(s)-1])
+				}
+			} else if !placed {
+				b.WriteString(block)
+				placed = true
+			}
+		case inBlock:
+			if trimmed == blockEnd {
+				inBlock = false
+			}
+		case legacyLinePattern.MatchString(trimmed):
+			slog.Debug("removing login line written before the envtab block", "line", trimmed)
+		default:
+			b.WriteString(line)
+		}
+	}
+	if inBlock {
+		return "", fmt.Errorf("envtab block is missing its closing line %q", blockEnd)
+	}
 
+	result := b.String()
+	if lines != nil && !placed {
+		if result != "" && !strings.HasSuffix(result, "\n") {
+			result += "\n"
+		}
+		if result != "" {
+			result += "\n"
 		}
+		result += block
+	}
+	return result, nil
+}
+
+// updateScript sets the envtab block of loginScript to lines, or removes it if
+// lines is nil. The login script is backed up before it is changed, and left
+// untouched if it already holds the block.
+func updateScript(loginScript string, lines []string) error {
+	// Write through symlinks so managed dotfiles keep pointing at the real file
+	if resolved, err := filepath.EvalSymlinks(loginScript); err == nil {
+		loginScript = resolved
+	}
+
+	var perm os.FileMode = 0644
+	content, err := os.ReadFile(loginScript)
+	if os.IsNotExist(err) {
+		if lines == nil {
+			return nil
+		}
+		slog.Debug("creating login script", "script", loginScript)
+		if err := os.MkdirAll(filepath.Dir(loginScript), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for login script %s: %w", loginScript, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to read login script %s: %w", loginScript, err)
+	} else if info, err := os.Stat(loginScript); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	updated, err := replaceBlock(string(content), lines)
+	if err != nil {
+		return fmt.Errorf("failed to update login script %s: %w", loginScript, err)
+	}
+	if updated == string(content) {
+		slog.Debug("login script is up to date", "script", loginScript)
+		return nil
+	}
+
+	if content != nil {
+		slog.Debug("backing up login script", "script", loginScript, "backup", loginScript+backupSuffix)
+		if err := utils.WriteFileAtomic(loginScript+backupSuffix, content, perm); err != nil {
+			return fmt.Errorf("failed to back up login script %s: %w", loginScript, err)
+		}
+	}
+
+	slog.Debug("writing login script", "script", loginScript)
+	if err := utils.WriteFileAtomic(loginScript, []byte(updated), perm); err != nil {
+		return fmt.Errorf("failed to write login script %s: %w", loginScript, err)
 	}
-	fmt.Printf("disabled\n")
+	return nil
 }
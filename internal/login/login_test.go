@@ -0,0 +1,179 @@
+package login
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gmherb/envtab/internal/shell"
+)
+
+// setupHome points HOME, XDG_CONFIG_HOME and ENVTAB_DIR at a temporary directory
+func setupHome(t *testing.T) string {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("ENVTAB_DIR", filepath.Join(home, "envtab"))
+	if err := os.MkdirAll(filepath.Join(home, "envtab"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return home
+}
+
+func TestReplaceBlock(t *testing.T) {
+	block := blockStart + "\n" + blockNote + "\nline\n" + blockEnd + "\n"
+
+	tests := []struct {
+		name    string
+		content string
+		lines   []string
+		want    string
+		wantErr bool
+	}{
+		{"empty script", "", []string{"line"}, block, false},
+		{"append after blank line", "export A=1\n", []string{"line"}, "export A=1\n\n" + block, false},
+		{"append without trailing newline", "export A=1", []string{"line"}, "export A=1\n\n" + block, false},
+		{"replace in place", "a\n" + blockStart + "\nold\n" + blockEnd + "\nb\n", []string{"line"}, "a\n" + block + "b\n", false},
+		{"already up to date", "a\n\n" + block, []string{"line"}, "a\n\n" + block, false},
+		{"remove", "a\n\n" + block, nil, "a\n", false},
+		{"remove keeps surrounding lines", "a\n" + block + "b\n", nil, "a\nb\n", false},
+		{"legacy line replaced", "a\neval \"$(/old/path/envtab login)\"\n", []string{"line"}, "a\n\n" + block, false},
+		{"legacy line removed", "a\neval \"$(/usr/local/bin/envtab login)\"\nb\n", nil, "a\nb\n", false},
+		{"unterminated block", "a\n" + blockStart + "\nold\n", []string{"line"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := replaceBlock(tt.content, tt.lines)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("replaceBlock() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("replaceBlock() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginScript(t *testing.T) {
+	home := setupHome(t)
+
+	tests := []struct {
+		shell shell.Shell
+		want  string
+	}{
+		{shell.Bash, filepath.Join(home, ".profile")},
+		{shell.Zsh, filepath.Join(home, ".zprofile")},
+		{shell.Fish, filepath.Join(home, ".config", "fish", "config.fish")},
+		{shell.Tcsh, filepath.Join(home, ".login")},
+	}
+	for _, tt := range tests {
+		got, err := LoginScript(tt.shell)
+		if err != nil {
+			t.Fatalf("LoginScript(%s) error = %v", tt.shell, err)
+		}
+		if got != tt.want {
+			t.Errorf("LoginScript(%s) = %q, want %q", tt.shell, got, tt.want)
+		}
+	}
+
+	// An existing ~/.bash_profile is preferred for bash
+	os.WriteFile(filepath.Join(home, ".bash_profile"), nil, 0644)
+	if got, _ := LoginScript(shell.Bash); got != filepath.Join(home, ".bash_profile") {
+		t.Errorf("LoginScript(bash) = %q, want ~/.bash_profile", got)
+	}
+
+	if _, err := LoginScript(shell.Nu); err == nil {
+		t.Error("LoginScript(nu) should fail")
+	}
+}
+
+func TestEnableDisable(t *testing.T) {
+	home := setupHome(t)
+	profile := filepath.Join(home, ".profile")
+	original := "export EDITOR=vim\n"
+	if err := os.WriteFile(profile, []byte(original), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Enable(shell.Bash); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+	content, _ := os.ReadFile(profile)
+	if !strings.Contains(string(content), blockStart) || !strings.Contains(string(content), "login --shell bash") {
+		t.Fatalf("Enable() wrote %q", content)
+	}
+	if backup, _ := os.ReadFile(profile + backupSuffix); string(backup) != original {
+		t.Errorf("backup = %q, want %q", backup, original)
+	}
+	if info, _ := os.Stat(profile); info.Mode().Perm() != 0640 {
+		t.Errorf("permissions = %v, want 0640", info.Mode().Perm())
+	}
+
+	// Enabling again leaves the script unchanged
+	if err := Enable(shell.Bash); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+	again, _ := os.ReadFile(profile)
+	if string(again) != string(content) {
+		t.Errorf("Enable() is not idempotent: %q", again)
+	}
+
+	status, err := GetStatus()
+	if err != nil {
+		t.Fatalf("GetStatus() error = %v", err)
+	}
+	if !status.Enabled || status.Mode != ModeCommand || status.LoginScript != profile {
+		t.Errorf("GetStatus() = %+v", status)
+	}
+
+	// Switching to raw mode replaces the block
+	if err := WriteRawScript(shell.Bash, "abc", []byte("export A=1\n")); err != nil {
+		t.Fatalf("WriteRawScript() error = %v", err)
+	}
+	if err := EnableRaw(shell.Bash); err != nil {
+		t.Fatalf("EnableRaw() error = %v", err)
+	}
+	content, _ = os.ReadFile(profile)
+	if strings.Count(string(content), blockStart) != 1 || !strings.Contains(string(content), RawScriptPath(shell.Bash)) {
+		t.Errorf("EnableRaw() wrote %q", content)
+	}
+	status, _ = GetStatus()
+	if status.Mode != ModeRaw || status.Shell != shell.Bash {
+		t.Errorf("GetStatus() = %+v, want raw bash", status)
+	}
+	if fingerprint, _ := RawScriptFingerprint(shell.Bash); fingerprint != "abc" {
+		t.Errorf("RawScriptFingerprint() = %q, want abc", fingerprint)
+	}
+
+	if err := Disable(); err != nil {
+		t.Fatalf("Disable() error = %v", err)
+	}
+	content, _ = os.ReadFile(profile)
+	if string(content) != original {
+		t.Errorf("Disable() left %q, want %q", content, original)
+	}
+	if len(RawScripts()) != 0 {
+		t.Errorf("Disable() left raw scripts %v", RawScripts())
+	}
+	if status, _ := GetStatus(); status.Enabled {
+		t.Errorf("GetStatus() = %+v, want disabled", status)
+	}
+}
+
+func TestEnableFish(t *testing.T) {
+	home := setupHome(t)
+
+	// config.fish and its directory are created when missing
+	if err := Enable(shell.Fish); err != nil {
+		t.Fatalf("Enable() error = %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(home, ".config", "fish", "config.fish"))
+	if err != nil {
+		t.Fatalf("reading config.fish: %v", err)
+	}
+	if !strings.Contains(string(content), "login --shell fish | source") {
+		t.Errorf("Enable() wrote %q", content)
+	}
+}
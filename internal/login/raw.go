@@ -0,0 +1,93 @@
+package login
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/gmherb/envtab/internal/config"
+	"github.com/gmherb/envtab/internal/shell"
+	"github.com/gmherb/envtab/internal/utils"
+)
+
+// rawScriptHeader starts every raw login script, followed by the fingerprint
+// of the loadouts it was generated from
+const rawScriptHeader = "# Generated by envtab login --raw. Changes are overwritten.\n# envtab-fingerprint: "
+
+// RawScriptPath returns the path of the raw login script for sh in the data directory
+func RawScriptPath(sh shell.Shell) string {
+	return filepath.Join(config.GetEnvtabPath(), "login."+string(sh))
+}
+
+// RawScripts returns the dialects a raw login script has been generated for
+func RawScripts() []shell.Shell {
+	shells := []shell.Shell{}
+	for _, sh := range Shells {
+		if _, err := os.Stat(RawScriptPath(sh)); err == nil {
+			shells = append(shells, sh)
+		}
+	}
+	return shells
+}
+
+// WriteRawScript writes the raw login script for sh, replacing it atomically.
+// The script holds decrypted values, so it is only readable by the user.
+func WriteRawScript(sh shell.Shell, fingerprint string, body []byte) error {
+	path := RawScriptPath(sh)
+	slog.Debug("writing raw login script", "script", path)
+
+	content := []byte(rawScriptHeader + fingerprint + "\n" + string(body))
+	if err := utils.WriteFileAtomic(path, content, 0600); err != nil {
+		return fmt.Errorf("failed to write raw login script: %w", err)
+	}
+	return nil
+}
+
+// RawScriptFingerprint returns the fingerprint the raw login script for sh was generated with
+func RawScriptFingerprint(sh shell.Shell) (string, error) {
+	f, err := os.Open(RawScriptPath(sh))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	prefix := rawScriptHeader[strings.Index(rawScriptHeader, "\n")+1:]
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fingerprint, ok := strings.CutPrefix(scanner.Text(), prefix); ok {
+			return fingerprint, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("no fingerprint in raw login script %s", RawScriptPath(sh))
+}
+
+// removeRawScripts removes the generated raw login scripts of all dialects but keep
+func removeRawScripts(keep ...shell.Shell) error {
+	for _, sh := range RawScripts() {
+		if slices.Contains(keep, sh) {
+			continue
+		}
+		slog.Debug("removing raw login script", "script", RawScriptPath(sh))
+		if err := os.Remove(RawScriptPath(sh)); err != nil {
+			return fmt.Errorf("failed to remove raw login script: %w", err)
+		}
+	}
+	return nil
+}
+
+// rawShell returns the dialect of the raw login script sourced in content
+func rawShell(content string) (shell.Shell, bool) {
+	for _, sh := range Shells {
+		if strings.Contains(content, RawScriptPath(sh)) {
+			return sh, true
+		}
+	}
+	return "", false
+}
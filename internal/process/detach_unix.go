@@ -0,0 +1,14 @@
+//go:build !windows
+
+package process
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Detach makes cmd run in a new session, so it keeps running after the
+// terminal of envtab is closed
+func Detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
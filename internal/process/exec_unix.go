@@ -0,0 +1,15 @@
+//go:build !windows
+
+package process
+
+import (
+	"syscall"
+)
+
+// Exec replaces the current process with the program at path.
+// The program inherits the process id, so its exit code and any signals
+// it receives are seen directly by the caller of envtab.
+// Exec only returns if the program could not be started.
+func Exec(path string, argv []string, env []string) error {
+	return syscall.Exec(path, argv, env)
+}
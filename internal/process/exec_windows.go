@@ -0,0 +1,40 @@
+//go:build windows
+
+package process
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+)
+
+// Exec runs the program at path and exits with its exit code.
+// Windows has no execve, so the program runs as a child process. Console
+// interrupts are delivered to the whole process group, so envtab ignores
+// them and leaves handling to the child.
+// Exec only returns if the program could not be started.
+func Exec(path string, argv []string, env []string) error {
+	cmd := exec.Command(path, argv[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signal.Ignore(os.Interrupt)
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
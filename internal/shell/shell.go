@@ -0,0 +1,344 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Shell is an output dialect for export/unset statements
+type Shell string
+
+const (
+	Bash       Shell = "bash"
+	Zsh        Shell = "zsh"
+	Fish       Shell = "fish"
+	Tcsh       Shell = "tcsh"
+	Nu         Shell = "nu"
+	PowerShell Shell = "powershell"
+	Cmd        Shell = "cmd"
+)
+
+// Shells lists all supported dialects
+var Shells = []Shell{Bash, Zsh, Fish, Tcsh, Nu, PowerShell, Cmd}
+
+// aliases maps shell executable names to their dialect
+var aliases = map[string]Shell{
+	"bash":       Bash,
+	"sh":         Bash,
+	"dash":       Bash,
+	"ash":        Bash,
+	"ksh":        Bash,
+	"mksh":       Bash,
+	"zsh":        Zsh,
+	"fish":       Fish,
+	"tcsh":       Tcsh,
+	"csh":        Tcsh,
+	"nu":         Nu,
+	"nushell":    Nu,
+	"powershell": PowerShell,
+	"pwsh":       PowerShell,
+	"cmd":        Cmd,
+}
+
+// Names returns the names of all supported dialects
+func Names() []string {
+	names := make([]string, 0, len(Shells))
+	for _, s := range Shells {
+		names = append(names, string(s))
+	}
+	return names
+}
+
+// Parse returns the dialect for a shell name or executable path
+// (e.g. "fish", "/usr/bin/zsh", "pwsh.exe")
+func Parse(name string) (Shell, error) {
+	base := strings.ToLower(filepath.Base(name))
+	base = strings.TrimSuffix(base, ".exe")
+	if s, ok := aliases[base]; ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("unsupported shell %q (supported: %s)", name, strings.Join(Names(), ", "))
+}
+
+// Detect returns the dialect of the user's shell based on $SHELL.
+// Falls back to cmd (or powershell when $PSModulePath is set) on Windows
+// and to bash everywhere else.
+func Detect() Shell {
+	if s, err := Parse(os.Getenv("SHELL")); err == nil {
+		return s
+	}
+	if runtime.GOOS == "windows" {
+		if os.Getenv("PSModulePath") != "" {
+			return PowerShell
+		}
+		return Cmd
+	}
+	return Bash
+}
+
+// keyPattern matches keys that are legal environment variable names in every dialect
+var keyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// safePattern matches values that need no quoting in POSIX shells, fish or tcsh
+var safePattern = regexp.MustCompile(`^[A-Za-z0-9_@+=:,./-]+$`)
+
+// ValidateKey checks that key is a legal environment variable name
+func ValidateKey(key string) error {
+	if !keyPattern.MatchString(key) {
+		return fmt.Errorf("invalid environment variable name %q: must start with a letter or underscore and contain only letters, digits and underscores", key)
+	}
+	return nil
+}
+
+// isPathVariable reports whether a variable is a list in shells that
+// treat PATH-like variables as lists (fish and nu)
+func isPathVariable(key string) bool {
+	return strings.HasSuffix(key, "PATH")
+}
+
+// Quote returns value as a single literal word in the dialect.
+// Values that cannot be represented safely are rejected with an error.
+func (s Shell) Quote(value string) (string, error) {
+	if strings.ContainsRune(value, 0) {
+		return "", fmt.Errorf("value contains a NUL byte")
+	}
+
+	switch s {
+	case Fish:
+		if safePattern.MatchString(value) {
+			return value, nil
+		}
+		// Only backslash and single quote are special inside fish single quotes
+		r := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+		return "'" + r.Replace(value) + "'", nil
+	case Tcsh:
+		if safePattern.MatchString(value) {
+			return value, nil
+		}
+		// History expansion (!) and newlines are still special inside tcsh single quotes
+		r := strings.NewReplacer(`'`, `'\''`, "!", `\!`, "\n", "\\\n")
+		return "'" + r.Replace(value) + "'", nil
+	case Nu:
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+		return `"` + r.Replace(value) + `"`, nil
+	case PowerShell:
+		// PowerShell also treats typographic single quotes as quote characters
+		r := strings.NewReplacer("'", "''", "\u2018", "\u2018\u2018", "\u2019", "\u2019\u2019", "\u201a", "\u201a\u201a", "\u201b", "\u201b\u201b")
+		return "'" + r.Replace(value) + "'", nil
+	case Cmd:
+		// cmd has no escape for quotes or line breaks inside a quoted set.
+		// %% is only read as a literal % in batch files, so cmd output must
+		// be run from a .bat or .cmd file rather than typed or piped into cmd.
+		if strings.ContainsAny(value, "\"\r\n") {
+			return "", fmt.Errorf("value contains a double quote or line break which cannot be represented in cmd")
+		}
+		return strings.ReplaceAll(value, "%", "%%"), nil
+	default:
+		if safePattern.MatchString(value) {
+			return value, nil
+		}
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'", nil
+	}
+}
+
+// quoteList quotes each element of a PATH-like value joined by sep separately
+func (s Shell) quoteList(value, sep string) ([]string, error) {
+	words := []string{}
+	for _, p := range strings.Split(value, sep) {
+		q, err := s.Quote(p)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, q)
+	}
+	return words, nil
+}
+
+// Export returns the statement that sets and exports key to value.
+// Returns an error if key is not a valid variable name or value cannot be quoted.
+func (s Shell) Export(key, value string) (string, error) {
+	return s.ExportWithSeparator(key, string(os.PathListSeparator), value)
+}
+
+// ExportWithSeparator is Export for a variable whose value is a list joined by
+// sep, such as a configured list variable. fish and nu export PATH-like
+// variables as lists, which they join with the path list separator, so other
+// separators are exported as a single string.
+func (s Shell) ExportWithSeparator(key, sep, value string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	nativeList := sep == string(os.PathListSeparator)
+	switch s {
+	case Fish:
+		if isPathVariable(key) && nativeList {
+			words, err := s.quoteList(value, sep)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", key, err)
+			}
+			return fmt.Sprintf("set -gx %s %s", key, strings.Join(words, " ")), nil
+		}
+	case Nu:
+		if key == "PATH" && nativeList {
+			words, err := s.quoteList(value, sep)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", key, err)
+			}
+			return fmt.Sprintf("$env.%s = [%s]", key, strings.Join(words, ", ")), nil
+		}
+	}
+
+	quoted, err := s.Quote(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+
+	switch s {
+	case Fish:
+		return fmt.Sprintf("set -gx %s %s", key, quoted), nil
+	case Tcsh:
+		return fmt.Sprintf("setenv %s %s", key, quoted), nil
+	case Nu:
+		return fmt.Sprintf("$env.%s = %s", key, quoted), nil
+	case PowerShell:
+		return fmt.Sprintf("$Env:%s = %s", key, quoted), nil
+	case Cmd:
+		return fmt.Sprintf(`set "%s=%s"`, key, quoted), nil
+	default:
+		return fmt.Sprintf("export %s=%s", key, quoted), nil
+	}
+}
+
+// ExportList returns the statement that sets and exports the list variable
+// key to the segments in before, its value when the statement is evaluated,
+// then the segments in after, all joined by sep. No separator is added for an
+// unset or empty value. Only bash, zsh, fish and tcsh are supported, and
+// before and after must not both be empty.
+func (s Shell) ExportList(key, sep string, before, after []string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	if len(before) == 0 && len(after) == 0 {
+		return "", fmt.Errorf("%s: no segments to add", key)
+	}
+
+	quoteJoined := func(segments []string) (string, error) {
+		if len(segments) == 0 {
+			return "", nil
+		}
+		q, err := s.Quote(strings.Join(segments, sep))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		return q, nil
+	}
+
+	switch s {
+	case Bash, Zsh:
+		b, err := quoteJoined(before)
+		if err != nil {
+			return "", err
+		}
+		a, err := quoteJoined(after)
+		if err != nil {
+			return "", err
+		}
+		// Separators are placed inside ${KEY:+...} so they are only added
+		// when the variable is set and not empty
+		dq := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`").Replace(sep)
+		switch {
+		case a == "":
+			return fmt.Sprintf(`export %s=%s"${%s:+%s$%s}"`, key, b, key, dq, key), nil
+		case b == "":
+			return fmt.Sprintf(`export %s="${%s:+$%s%s}"%s`, key, key, key, dq, a), nil
+		default:
+			qsep, err := s.Quote(sep)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", key, err)
+			}
+			return fmt.Sprintf(`export %s=%s"${%s:+%s$%s}"%s%s`, key, b, key, dq, key, qsep, a), nil
+		}
+	case Fish:
+		words := []string{}
+		for _, segment := range before {
+			q, err := s.Quote(segment)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", key, err)
+			}
+			words = append(words, q)
+		}
+		words = append(words, "$"+key)
+		for _, segment := range after {
+			q, err := s.Quote(segment)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", key, err)
+			}
+			words = append(words, q)
+		}
+		if isPathVariable(key) {
+			return fmt.Sprintf("set -gx %s %s", key, strings.Join(words, " ")), nil
+		}
+		qsep, err := s.Quote(sep)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		return fmt.Sprintf("set -gx %s (string join %s -- %s)", key, qsep, strings.Join(words, " ")), nil
+	case Tcsh:
+		b, err := quoteJoined(before)
+		if err != nil {
+			return "", err
+		}
+		a, err := quoteJoined(after)
+		if err != nil {
+			return "", err
+		}
+		qsep, err := s.Quote(sep)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+		withCurrent := `"${` + key + `}"`
+		if b != "" {
+			withCurrent = b + qsep + withCurrent
+		}
+		if a != "" {
+			withCurrent = withCurrent + qsep + a
+		}
+		without, err := quoteJoined(append(append([]string{}, before...), after...))
+		if err != nil {
+			return "", err
+		}
+		// csh substitutes variables before evaluating a one line if, so the
+		// reference must be on its own line
+		return fmt.Sprintf("if ( $?%s ) then\n\tsetenv %s %s\nelse\n\tsetenv %s %s\nendif", key, key, withCurrent, key, without), nil
+	default:
+		return "", fmt.Errorf("%s: merging a list with its current value is not supported in %s", key, s)
+	}
+}
+
+// Unset returns the statement that removes key from the environment.
+// Returns an error if key is not a valid variable name.
+func (s Shell) Unset(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+
+	switch s {
+	case Fish:
+		return fmt.Sprintf("set -e %s", key), nil
+	case Tcsh:
+		return fmt.Sprintf("unsetenv %s", key), nil
+	case Nu:
+		return fmt.Sprintf("hide-env %s", key), nil
+	case PowerShell:
+		return fmt.Sprintf("Remove-Item Env:%s -ErrorAction SilentlyContinue", key), nil
+	case Cmd:
+		return fmt.Sprintf(`set "%s="`, key), nil
+	default:
+		return fmt.Sprintf("unset %s", key), nil
+	}
+}
@@ -0,0 +1,330 @@
+package shell
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Shell
+		wantErr bool
+	}{
+		{"bash", "bash", Bash, false},
+		{"bash path", "/bin/bash", Bash, false},
+		{"posix sh", "/bin/sh", Bash, false},
+		{"zsh path", "/usr/local/bin/zsh", Zsh, false},
+		{"fish", "fish", Fish, false},
+		{"csh is tcsh", "/bin/csh", Tcsh, false},
+		{"nushell", "/usr/bin/nu", Nu, false},
+		{"pwsh", "pwsh", PowerShell, false},
+		{"powershell exe", `powershell.exe`, PowerShell, false},
+		{"cmd exe", "CMD.EXE", Cmd, false},
+		{"unknown", "elvish", "", true},
+		{"empty", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	originalShell := os.Getenv("SHELL")
+	defer os.Setenv("SHELL", originalShell)
+
+	os.Setenv("SHELL", "/usr/bin/fish")
+	if got := Detect(); got != Fish {
+		t.Errorf("Detect() = %q, want %q", got, Fish)
+	}
+
+	os.Setenv("SHELL", "/bin/zsh")
+	if got := Detect(); got != Zsh {
+		t.Errorf("Detect() = %q, want %q", got, Zsh)
+	}
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		shell Shell
+		key   string
+		value string
+		want  string
+	}{
+		{Bash, "KEY", "value", "export KEY=value"},
+		{Bash, "KEY", "a b", "export KEY='a b'"},
+		{Bash, "KEY", "it's", `export KEY='it'\''s'`},
+		{Bash, "KEY", "", "export KEY=''"},
+		{Zsh, "KEY", "value", "export KEY=value"},
+		{Fish, "KEY", "value", "set -gx KEY value"},
+		{Fish, "KEY", `it's \ here`, `set -gx KEY 'it\'s \\ here'`},
+		{Fish, "PATH", "/a:/b", "set -gx PATH /a /b"},
+		{Fish, "PATH", "/a:/my dir", "set -gx PATH /a '/my dir'"},
+		{Tcsh, "KEY", "value", "setenv KEY value"},
+		{Tcsh, "KEY", "hi! it's", `setenv KEY 'hi\! it'\''s'`},
+		{Tcsh, "KEY", "a\nb", "setenv KEY 'a\\\nb'"},
+		{Nu, "KEY", "value", `$env.KEY = "value"`},
+		{Nu, "KEY", "say \"hi\"\n", `$env.KEY = "say \"hi\"\n"`},
+		{Nu, "PATH", "/a:/b", `$env.PATH = ["/a", "/b"]`},
+		{PowerShell, "KEY", "value", "$Env:KEY = 'value'"},
+		{PowerShell, "KEY", "it's $x", "$Env:KEY = 'it''s $x'"},
+		{PowerShell, "KEY", "it\u2019s", "$Env:KEY = 'it\u2019\u2019s'"},
+		{Cmd, "KEY", "value", `set "KEY=value"`},
+		{Cmd, "KEY", "a&b|c %PATH%", `set "KEY=a&b|c %%PATH%%"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.shell)+"_"+tt.key, func(t *testing.T) {
+			got, err := tt.shell.Export(tt.key, tt.value)
+			if err != nil {
+				t.Fatalf("Export() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Export() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportWithSeparator(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	tests := []struct {
+		shell Shell
+		key   string
+		sep   string
+		value string
+		want  string
+	}{
+		{Fish, "PATH", sep, "/a" + sep + "/b", "set -gx PATH /a /b"},
+		{Fish, "GEM_PATH", ",", "/a,/b", "set -gx GEM_PATH /a,/b"},
+		{Nu, "PATH", sep, "/a" + sep + "/b", `$env.PATH = ["/a", "/b"]`},
+		{Nu, "PATH", ",", "/a,/b", `$env.PATH = "/a,/b"`},
+		{Bash, "GEM_PATH", ",", "/a,/b", "export GEM_PATH=/a,/b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.shell)+"_"+tt.key+"_"+tt.sep, func(t *testing.T) {
+			got, err := tt.shell.ExportWithSeparator(tt.key, tt.sep, tt.value)
+			if err != nil {
+				t.Fatalf("ExportWithSeparator() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExportWithSeparator() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		shell Shell
+		key   string
+		value string
+	}{
+		{"empty key", Bash, "", "value"},
+		{"key with space", Bash, "MY KEY", "value"},
+		{"key with leading digit", Bash, "1KEY", "value"},
+		{"key with dash", Fish, "MY-KEY", "value"},
+		{"key with injection", Bash, "A=1;rm -rf ~;B", "value"},
+		{"key with subshell", Tcsh, "$(id)", "value"},
+		{"NUL in value", Bash, "KEY", "a\x00b"},
+		{"double quote in cmd", Cmd, "KEY", `a"b`},
+		{"newline in cmd", Cmd, "KEY", "a\nb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := tt.shell.Export(tt.key, tt.value); err == nil {
+				t.Errorf("Export() = %q, want error", got)
+			}
+		})
+	}
+
+	if _, err := Bash.Unset("BAD KEY"); err == nil {
+		t.Error("Unset() with invalid key should return error")
+	}
+}
+
+// adversarialValues are values that break or inject code when exported unquoted
+var adversarialValues = []string{
+	"simple",
+	"",
+	"with space",
+	"jdbc:postgresql://db:5432/app?user=a&password=b",
+	"it's",
+	`"double"`,
+	"$(touch /tmp/envtab-pwned)",
+	"`touch /tmp/envtab-pwned`",
+	"a; touch /tmp/envtab-pwned",
+	"a && touch /tmp/envtab-pwned",
+	"pass#word",
+	"$HOME ${HOME} $$",
+	"line1\nline2",
+	"tab\there",
+	`back\slash\`,
+	"'; touch /tmp/envtab-pwned; echo '",
+	"*",
+	"~",
+	"!event",
+	"-n",
+	"unicode ✓ ü",
+}
+
+func TestExportRoundTripPOSIX(t *testing.T) {
+	for _, name := range []string{"bash", "sh"} {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			t.Logf("%s not installed, skipping", name)
+			continue
+		}
+
+		for _, value := range adversarialValues {
+			statement, err := Bash.Export("ENVTAB_TEST_VALUE", value)
+			if err != nil {
+				t.Fatalf("Export(%q) error = %v", value, err)
+			}
+
+			script := statement + "\nprintf '%s' \"$ENVTAB_TEST_VALUE\""
+			out, err := exec.Command(path, "-c", script).Output()
+			if err != nil {
+				t.Errorf("%s: evaluating %q failed: %v", name, statement, err)
+				continue
+			}
+			if string(out) != value {
+				t.Errorf("%s: round trip of %q = %q", name, value, string(out))
+			}
+		}
+	}
+
+	if _, err := os.Stat("/tmp/envtab-pwned"); err == nil {
+		os.Remove("/tmp/envtab-pwned")
+		t.Error("exported value executed shell code")
+	}
+}
+
+func TestQuoteNoInjection(t *testing.T) {
+	// Every quoted value must start with a quote character unless it is
+	// made only of characters that are safe in the dialect
+	for _, s := range []Shell{Bash, Fish, Tcsh, Nu, PowerShell} {
+		for _, value := range adversarialValues {
+			quoted, err := s.Quote(value)
+			if err != nil {
+				t.Errorf("%s: Quote(%q) error = %v", s, value, err)
+				continue
+			}
+			if !safePattern.MatchString(value) && !strings.HasPrefix(quoted, "'") && !strings.HasPrefix(quoted, `"`) {
+				t.Errorf("%s: Quote(%q) = %q is not quoted", s, value, quoted)
+			}
+		}
+	}
+}
+
+func TestUnset(t *testing.T) {
+	tests := []struct {
+		shell Shell
+		want  string
+	}{
+		{Bash, "unset KEY"},
+		{Zsh, "unset KEY"},
+		{Fish, "set -e KEY"},
+		{Tcsh, "unsetenv KEY"},
+		{Nu, "hide-env KEY"},
+		{PowerShell, "Remove-Item Env:KEY -ErrorAction SilentlyContinue"},
+		{Cmd, `set "KEY="`},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.shell), func(t *testing.T) {
+			if got, _ := tt.shell.Unset("KEY"); got != tt.want {
+				t.Errorf("Unset() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportList(t *testing.T) {
+	tests := []struct {
+		name   string
+		shell  Shell
+		key    string
+		before []string
+		after  []string
+		want   string
+	}{
+		{"bash prepend", Bash, "PATH", []string{"/opt/bin", "/a b"}, nil, `export PATH='/opt/bin:/a b'"${PATH:+:$PATH}"`},
+		{"zsh append", Zsh, "PATH", nil, []string{"/opt/bin"}, `export PATH="${PATH:+$PATH:}"/opt/bin`},
+		{"bash both", Bash, "PATH", []string{"/a"}, []string{"/b"}, `export PATH=/a"${PATH:+:$PATH}":/b`},
+		{"fish path", Fish, "PATH", []string{"/a"}, []string{"/b c"}, `set -gx PATH /a $PATH '/b c'`},
+		{"fish string", Fish, "XDG_DATA_DIRS", []string{"/a"}, nil, `set -gx XDG_DATA_DIRS (string join : -- /a $XDG_DATA_DIRS)`},
+		{"tcsh", Tcsh, "PATH", []string{"/a"}, []string{"/b"}, "if ( $?PATH ) then\n\tsetenv PATH /a:\"${PATH}\":/b\nelse\n\tsetenv PATH /a:/b\nendif"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.shell.ExportList(tt.key, ":", tt.before, tt.after)
+			if err != nil {
+				t.Fatalf("ExportList() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ExportList() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := Nu.ExportList("PATH", ":", []string{"/a"}, nil); err == nil {
+		t.Error("ExportList() should fail for nu")
+	}
+	if _, err := Bash.ExportList("PATH", ":", nil, nil); err == nil {
+		t.Error("ExportList() should fail without segments")
+	}
+}
+
+func TestExportListPOSIX(t *testing.T) {
+	path, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not installed")
+	}
+
+	tests := []struct {
+		current string
+		set     bool
+		want    string
+	}{
+		{"/usr/bin:/bin", true, "/a:/usr/bin:/bin:/b $x"},
+		{"", true, "/a:/b $x"},
+		{"", false, "/a:/b $x"},
+	}
+
+	statement, err := Bash.ExportList("ENVTAB_TEST_LIST", ":", []string{"/a"}, []string{"/b $x"})
+	if err != nil {
+		t.Fatalf("ExportList() error = %v", err)
+	}
+	for _, tt := range tests {
+		script := statement + "\nprintf '%s' \"$ENVTAB_TEST_LIST\""
+		cmd := exec.Command(path, "-c", script)
+		cmd.Env = []string{}
+		if tt.set {
+			cmd.Env = append(cmd.Env, "ENVTAB_TEST_LIST="+tt.current)
+		}
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("evaluating %q failed: %v", statement, err)
+		}
+		if string(out) != tt.want {
+			t.Errorf("ExportList() with %q = %q, want %q", tt.current, string(out), tt.want)
+		}
+	}
+}
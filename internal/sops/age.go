@@ -0,0 +1,434 @@
+package sops
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// sopsFormatVersion is the sops version recorded in values encrypted in
+// process, whose document format they follow
+const sopsFormatVersion = "3.9.0"
+
+// sopsUnencryptedSuffix is the default unencrypted_suffix of sops documents
+const sopsUnencryptedSuffix = "_unencrypted"
+
+// sopsNonceSize is the size of the AES-GCM nonces used by sops
+const sopsNonceSize = 32
+
+// sopsValueAdditionalData authenticates the path of the value in the document
+const sopsValueAdditionalData = "value:"
+
+// reSOPSEncrypted matches values encrypted by sops
+var reSOPSEncrypted = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.+),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// sopsDocument is the YAML document of a SOPS: value
+type sopsDocument struct {
+	Value string       `yaml:"value"`
+	SOPS  sopsMetadata `yaml:"sops"`
+}
+
+// sopsMetadata is the part of the sops metadata read and written in process
+type sopsMetadata struct {
+	KeyGroups         []interface{} `yaml:"key_groups,omitempty"`
+	Age               []ageStanza   `yaml:"age,omitempty"`
+	LastModified      string        `yaml:"lastmodified"`
+	MAC               string        `yaml:"mac"`
+	UnencryptedSuffix string        `yaml:"unencrypted_suffix,omitempty"`
+	Version           string        `yaml:"version"`
+}
+
+// ageStanza is the data key of a sops document encrypted for an age recipient
+type ageStanza struct {
+	Recipient string `yaml:"recipient"`
+	Enc       string `yaml:"enc"`
+}
+
+// ageEncryptor encrypts and decrypts SOPS values with age keys in process,
+// following the document format of the sops binary (see
+// TestAgeEncryptorInterop). Other keys (KMS, PGP, Vault, ...) and key groups
+// are not supported.
+type ageEncryptor struct {
+	once       sync.Once
+	identities []age.Identity
+	err        error
+}
+
+func (a *ageEncryptor) Name() string { return EncryptorNative }
+
+// loadIdentities returns the age identities sops would use, read once from
+// SOPS_AGE_KEY and SOPS_AGE_KEY_FILE or the default sops/age/keys.txt of the
+// user config directory
+func (a *ageEncryptor) loadIdentities() ([]age.Identity, error) {
+	a.once.Do(func() {
+		sources := map[string]io.Reader{}
+		if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+			sources["SOPS_AGE_KEY"] = strings.NewReader(key)
+		}
+
+		keyFile := os.Getenv("SOPS_AGE_KEY_FILE")
+		if keyFile == "" {
+			configDir := os.Getenv("XDG_CONFIG_HOME")
+			if configDir == "" {
+				configDir, _ = os.UserConfigDir()
+			}
+			keyFile = filepath.Join(configDir, "sops", "age", "keys.txt")
+		}
+		if content, err := os.ReadFile(keyFile); err == nil {
+			sources[keyFile] = bytes.NewReader(content)
+		} else if os.Getenv("SOPS_AGE_KEY_FILE") != "" {
+			a.err = fmt.Errorf("failed to read age identities: %w", err)
+			return
+		}
+
+		for source, r := range sources {
+			identities, err := age.ParseIdentities(r)
+			if err != nil {
+				a.err = fmt.Errorf("%w: failed to parse age identities of %s: %v", errUnsupported, source, err)
+				return
+			}
+			a.identities = append(a.identities, identities...)
+		}
+		slog.Debug("loaded age identities", "count", len(a.identities))
+	})
+	return a.identities, a.err
+}
+
+// EncryptValue encrypts value for the age recipients sops would use
+func (a *ageEncryptor) EncryptValue(value string) (string, error) {
+	slog.Debug("encrypting value with age")
+	recipients, err := ageRecipients(getFilenameOverride())
+	if err != nil {
+		return "", err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	doc := sopsDocument{SOPS: sopsMetadata{
+		LastModified:      time.Now().UTC().Format(time.RFC3339),
+		UnencryptedSuffix: sopsUnencryptedSuffix,
+		Version:           sopsFormatVersion,
+	}}
+	if doc.Value, err = encryptAES([]byte(value), dataKey, sopsValueAdditionalData); err != nil {
+		return "", err
+	}
+	if doc.SOPS.MAC, err = encryptAES([]byte(computeMAC([]byte(value))), dataKey, doc.SOPS.LastModified); err != nil {
+		return "", err
+	}
+
+	for _, recipient := range recipients {
+		var buf bytes.Buffer
+		aw := armor.NewWriter(&buf)
+		w, err := age.Encrypt(aw, recipient)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt data key for %s: %w", recipient, err)
+		}
+		if _, err := w.Write(dataKey); err != nil {
+			return "", err
+		}
+		if err := w.Close(); err != nil {
+			return "", err
+		}
+		if err := aw.Close(); err != nil {
+			return "", err
+		}
+		doc.SOPS.Age = append(doc.SOPS.Age, ageStanza{Recipient: recipient.String(), Enc: buf.String()})
+	}
+
+	encrypted, err := yaml.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal value to YAML: %w", err)
+	}
+	slog.Debug("value encrypted successfully")
+	return "SOPS:" + string(encrypted), nil
+}
+
+// DecryptValue decrypts a value encrypted for an age recipient
+func (a *ageEncryptor) DecryptValue(encryptedValue string) (string, error) {
+	slog.Debug("decrypting value with age")
+	encrypted := strings.TrimPrefix(encryptedValue, "SOPS:")
+	if encrypted == "" {
+		return "", fmt.Errorf("value is empty after removing prefix")
+	}
+
+	var doc sopsDocument
+	if err := yaml.Unmarshal([]byte(encrypted), &doc); err != nil || doc.SOPS.MAC == "" {
+		return "", fmt.Errorf("value may not be SOPS-encrypted or is corrupted: no sops metadata found")
+	}
+
+	dataKey, err := a.dataKey(doc.SOPS)
+	if err != nil {
+		return "", err
+	}
+
+	value, err := decryptAES(doc.Value, dataKey, sopsValueAdditionalData)
+	if err != nil {
+		return "", fmt.Errorf("value may not be SOPS-encrypted or is corrupted: %w", err)
+	}
+	lastModified, err := time.Parse(time.RFC3339, doc.SOPS.LastModified)
+	if err != nil {
+		return "", fmt.Errorf("invalid sops lastmodified: %w", err)
+	}
+	mac, err := decryptAES(doc.SOPS.MAC, dataKey, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt sops MAC: %w", err)
+	}
+	if !strings.EqualFold(string(mac), computeMAC(value)) {
+		return "", fmt.Errorf("value may not be SOPS-encrypted or is corrupted: MAC mismatch")
+	}
+
+	slog.Debug("value decrypted successfully")
+	return string(value), nil
+}
+
+// DecryptValues decrypts the values one after the other, loading the age
+// identities only once
+func (a *ageEncryptor) DecryptValues(values map[string]string) (map[string]string, map[string]error) {
+	result := map[string]string{}
+	failed := map[string]error{}
+	for key, value := range values {
+		decrypted, err := a.DecryptValue(value)
+		if err != nil {
+			failed[key] = err
+			continue
+		}
+		result[key] = decrypted
+	}
+	return result, failed
+}
+
+// dataKey decrypts the data key of a document with the age identities
+func (a *ageEncryptor) dataKey(metadata sopsMetadata) ([]byte, error) {
+	if len(metadata.KeyGroups) > 0 {
+		return nil, fmt.Errorf("%w: value uses sops key groups", errUnsupported)
+	}
+	if len(metadata.Age) == 0 {
+		return nil, fmt.Errorf("%w: value is not encrypted for an age recipient", errUnsupported)
+	}
+
+	identities, err := a.loadIdentities()
+	if err != nil {
+		return nil, err
+	}
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("%w: no age identities found", errUnsupported)
+	}
+
+	recipients := []string{}
+	for _, stanza := range metadata.Age {
+		recipients = append(recipients, stanza.Recipient)
+		var r io.Reader = strings.NewReader(strings.TrimSpace(stanza.Enc))
+		if strings.HasPrefix(strings.TrimSpace(stanza.Enc), armor.Header) {
+			r = armor.NewReader(r)
+		}
+		decrypted, err := age.Decrypt(r, identities...)
+		if err != nil {
+			slog.Debug("failure decrypting data key", "recipient", stanza.Recipient, "error", err)
+			continue
+		}
+		dataKey, err := io.ReadAll(decrypted)
+		if err != nil {
+			slog.Debug("failure decrypting data key", "recipient", stanza.Recipient, "error", err)
+			continue
+		}
+		return dataKey, nil
+	}
+	return nil, fmt.Errorf("%w: no age identity matches the recipients %s", errUnsupported, strings.Join(recipients, ", "))
+}
+
+// ageRecipients returns the age recipients sops would encrypt filename for:
+// SOPS_AGE_RECIPIENTS, or the age keys of the first creation rule of the
+// nearest .sops.yaml matching filename
+func ageRecipients(filename string) ([]*age.X25519Recipient, error) {
+	for _, env := range []string{"SOPS_KMS_ARN", "SOPS_PGP_FP", "SOPS_GCP_KMS_IDS", "SOPS_AZURE_KEYVAULT_URLS", "SOPS_VAULT_URIS"} {
+		if os.Getenv(env) != "" {
+			return nil, fmt.Errorf("%w: %s is set", errUnsupported, env)
+		}
+	}
+
+	keys := os.Getenv("SOPS_AGE_RECIPIENTS")
+	if keys == "" {
+		var err error
+		if keys, err = creationRuleAgeKeys(filename); err != nil {
+			return nil, err
+		}
+	}
+
+	recipients := []*age.X25519Recipient{}
+	for _, key := range strings.Split(keys, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		recipient, err := age.ParseX25519Recipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: age recipient %s: %v", errUnsupported, key, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("%w: no age recipients", errUnsupported)
+	}
+	return recipients, nil
+}
+
+// creationRuleAgeKeys returns the comma separated age keys of the first
+// creation rule matching filename, like sops does with --filename-override
+func creationRuleAgeKeys(filename string) (string, error) {
+	configPath := findSOPSConfig()
+	if configPath == "" {
+		return "", fmt.Errorf("%w: no .sops.yaml found", errUnsupported)
+	}
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return "", err
+	}
+	var config struct {
+		CreationRules []map[string]interface{} `yaml:"creation_rules"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return "", fmt.Errorf("failed to parse %s: %w", configPath, err)
+	}
+
+	// sops matches path_regex against the absolute path of the file,
+	// relative to the directory of .sops.yaml when the file is below it
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	path = strings.TrimPrefix(path, filepath.Dir(configPath)+string(filepath.Separator))
+
+	for _, rule := range config.CreationRules {
+		pathRegex, _ := rule["path_regex"].(string)
+		if pathRegex != "" {
+			re, err := regexp.Compile(pathRegex)
+			if err != nil {
+				return "", fmt.Errorf("invalid path_regex %q in %s: %w", pathRegex, configPath, err)
+			}
+			if !re.MatchString(path) {
+				continue
+			}
+		}
+
+		for key := range rule {
+			if key != "path_regex" && key != "age" {
+				return "", fmt.Errorf("%w: creation rule %q uses %s", errUnsupported, pathRegex, key)
+			}
+		}
+		switch keys := rule["age"].(type) {
+		case string:
+			return keys, nil
+		case []interface{}:
+			list := []string{}
+			for _, key := range keys {
+				list = append(list, fmt.Sprint(key))
+			}
+			return strings.Join(list, ","), nil
+		}
+		return "", fmt.Errorf("%w: creation rule %q has no age keys", errUnsupported, pathRegex)
+	}
+	return "", fmt.Errorf("%w: no matching creation rules found in %s", errUnsupported, configPath)
+}
+
+// findSOPSConfig returns the path of the .sops.yaml sops uses, the first
+// found walking up from the current directory, or an empty string
+func findSOPSConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, ".sops.yaml")
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// computeMAC returns the sops MAC of a document holding only value
+func computeMAC(value []byte) string {
+	return fmt.Sprintf("%X", sha512.Sum512(value))
+}
+
+// encryptAES encrypts plaintext with the data key like sops, as
+// ENC[AES256_GCM,...]. Empty values are not encrypted.
+func encryptAES(plaintext []byte, dataKey []byte, additionalData string) (string, error) {
+	if len(plaintext) == 0 {
+		return "", nil
+	}
+	gcm, err := newSOPSCipher(dataKey)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, sopsNonceSize)
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	out := gcm.Seal(nil, iv, plaintext, []byte(additionalData))
+	tagStart := len(out) - gcm.Overhead()
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:str]",
+		base64.StdEncoding.EncodeToString(out[:tagStart]),
+		base64.StdEncoding.EncodeToString(iv),
+		base64.StdEncoding.EncodeToString(out[tagStart:])), nil
+}
+
+// decryptAES decrypts a value encrypted by sops with the data key
+func decryptAES(value string, dataKey []byte, additionalData string) ([]byte, error) {
+	if value == "" {
+		return []byte{}, nil
+	}
+	matches := reSOPSEncrypted.FindStringSubmatch(value)
+	if matches == nil {
+		return nil, fmt.Errorf("value is not encrypted with AES256_GCM")
+	}
+	data, err := base64.StdEncoding.DecodeString(matches[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted data: %w", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(matches[2])
+	if err != nil || len(iv) != sopsNonceSize {
+		return nil, fmt.Errorf("invalid encryption iv")
+	}
+	tag, err := base64.StdEncoding.DecodeString(matches[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption tag: %w", err)
+	}
+
+	gcm, err := newSOPSCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, iv, append(data, tag...), []byte(additionalData))
+}
+
+func newSOPSCipher(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+	return cipher.NewGCMWithNonceSize(block, sopsNonceSize)
+}
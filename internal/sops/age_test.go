@@ -0,0 +1,193 @@
+package sops
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/spf13/viper"
+)
+
+// setupAge creates an age identity for SOPS_AGE_KEY and a .sops.yaml in a
+// new current directory encrypting values for it
+func setupAge(t *testing.T) *age.X25519Identity {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOPS_AGE_KEY", identity.String())
+	t.Setenv("SOPS_AGE_KEY_FILE", "")
+	t.Setenv("SOPS_AGE_RECIPIENTS", "")
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("ENVTAB_AGENT_SOCK", filepath.Join(t.TempDir(), "agent.sock"))
+
+	dir := t.TempDir()
+	config := "creation_rules:\n  - path_regex: " + SOPSFilenameOverride + "\n    age: " + identity.Recipient().String() + "\n"
+	if err := os.WriteFile(filepath.Join(dir, ".sops.yaml"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+	return identity
+}
+
+func TestAgeEncryptor(t *testing.T) {
+	identity := setupAge(t)
+	a := &ageEncryptor{}
+
+	for _, value := range []string{"secret", "", "line1\nline2", `with "quotes": and colons`, "测试值 🎉", "123"} {
+		encrypted, err := a.EncryptValue(value)
+		if err != nil {
+			t.Fatalf("EncryptValue(%q) error = %v", value, err)
+		}
+		if !strings.HasPrefix(encrypted, "SOPS:") || !strings.Contains(encrypted, identity.Recipient().String()) {
+			t.Errorf("EncryptValue(%q) = %q, want a SOPS: value for the recipient", value, encrypted)
+		}
+		if value != "" && strings.Contains(encrypted, value) {
+			t.Errorf("EncryptValue(%q) contains the value in plain text", value)
+		}
+		if decrypted, err := a.DecryptValue(encrypted); err != nil || decrypted != value {
+			t.Errorf("DecryptValue() = %q, %v, want %q", decrypted, err, value)
+		}
+	}
+
+	encrypted, err := a.EncryptValue("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(encrypted, "lastmodified: \"20", "lastmodified: \"19", 1)
+	if _, err := a.DecryptValue(tampered); err == nil {
+		t.Error("DecryptValue() of a tampered value should fail")
+	}
+
+	for _, invalid := range []string{"", "SOPS:", "SOPS:invalid_data", "not_encrypted"} {
+		if _, err := a.DecryptValue(invalid); err == nil || errors.Is(err, errUnsupported) {
+			t.Errorf("DecryptValue(%q) error = %v, want an error", invalid, err)
+		}
+	}
+
+	// Values for other identities are left to the sops binary
+	other := &ageEncryptor{}
+	t.Setenv("SOPS_AGE_KEY", "")
+	if _, err := other.DecryptValue(encrypted); !errors.Is(err, errUnsupported) {
+		t.Errorf("DecryptValue() without identities error = %v, want unsupported", err)
+	}
+}
+
+// TestAgeEncryptorInterop checks values encrypted in process are decrypted
+// by the sops binary and the other way around. CI installs sops, so the test
+// must run there.
+func TestAgeEncryptorInterop(t *testing.T) {
+	if err := checkSOPSAvailable(); err != nil {
+		if os.Getenv("CI") != "" {
+			t.Fatalf("sops is required in CI: %v", err)
+		}
+		t.Skipf("Skipping test: sops not available: %v", err)
+	}
+	setupAge(t)
+	a := &ageEncryptor{}
+	binary := binaryEncryptor{}
+
+	for _, value := range []string{"secret", "", "line1\nline2", `with "quotes": and colons`, "测试值 🎉"} {
+		encrypted, err := a.EncryptValue(value)
+		if err != nil {
+			t.Fatalf("EncryptValue(%q) error = %v", value, err)
+		}
+		if decrypted, err := binary.DecryptValue(encrypted); err != nil || decrypted != value {
+			t.Errorf("sops decrypted %q as %q, %v", value, decrypted, err)
+		}
+
+		encrypted, err = binary.EncryptValue(value)
+		if err != nil {
+			t.Fatalf("sops EncryptValue(%q) error = %v", value, err)
+		}
+		if decrypted, err := a.DecryptValue(encrypted); err != nil || decrypted != value {
+			t.Errorf("DecryptValue() of the sops value %q = %q, %v", value, decrypted, err)
+		}
+	}
+}
+
+func TestCreationRuleAgeKeys(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		want        string
+		unsupported bool
+	}{
+		{"matching rule", "creation_rules:\n  - path_regex: other\n    kms: arn\n  - path_regex: envtab-stdin\n    age: age1a,age1b\n", "age1a,age1b", false},
+		{"catch all rule", "creation_rules:\n  - age: age1a\n", "age1a", false},
+		{"age list", "creation_rules:\n  - age:\n      - age1a\n      - age1b\n", "age1a,age1b", false},
+		{"other keys", "creation_rules:\n  - path_regex: envtab\n    age: age1a\n    pgp: ABCD\n", "", true},
+		{"encrypted regex", "creation_rules:\n  - age: age1a\n    encrypted_regex: ^value$\n", "", true},
+		{"no matching rule", "creation_rules:\n  - path_regex: \\.env$\n    age: age1a\n", "", true},
+		{"relative to config directory", "creation_rules:\n  - path_regex: ^envtab-stdin-override$\n    age: age1a\n  - path_regex: ^project/envtab-stdin-override$\n    age: age1b\n", "age1b", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, ".sops.yaml"), []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			sub := filepath.Join(dir, "project")
+			if err := os.Mkdir(sub, 0700); err != nil {
+				t.Fatal(err)
+			}
+			t.Chdir(sub)
+
+			got, err := creationRuleAgeKeys(SOPSFilenameOverride)
+			if tt.unsupported {
+				if !errors.Is(err, errUnsupported) {
+					t.Errorf("creationRuleAgeKeys() error = %v, want unsupported", err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("creationRuleAgeKeys() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSOPSDecryptValues(t *testing.T) {
+	setupAge(t)
+	saved := native
+	native = &ageEncryptor{}
+	defer func() { native = saved }()
+	viper.Set("sops.encryptor", EncryptorNative)
+	defer viper.Set("sops.encryptor", nil)
+
+	if CurrentEncryptor().Name() != EncryptorNative {
+		t.Fatalf("CurrentEncryptor() = %s, want %s", CurrentEncryptor().Name(), EncryptorNative)
+	}
+
+	a, _ := SOPSEncryptValue("a")
+	b, _ := SOPSEncryptValue("b")
+	values := map[string]string{"A": a, "B": b, "PLAIN": "plain", "BROKEN": "SOPS:broken"}
+
+	result, failed := SOPSDecryptValues(values)
+	if len(result) != 2 || result["A"] != "a" || result["B"] != "b" {
+		t.Errorf("SOPSDecryptValues() = %v, want A=a and B=b", result)
+	}
+	if len(failed) != 1 || failed["BROKEN"] == nil {
+		t.Errorf("SOPSDecryptValues() failed = %v, want BROKEN", failed)
+	}
+
+	// Results are reused without the identities
+	native = &ageEncryptor{}
+	t.Setenv("SOPS_AGE_KEY", "")
+	if decrypted, err := SOPSDecryptValue(a); err != nil || decrypted != "a" {
+		t.Errorf("SOPSDecryptValue() = %q, %v, want the batch result", decrypted, err)
+	}
+
+	// Without the cache, values whose keys are gone fail to decrypt
+	DisableCache()
+	defer cacheDisabled.Store(false)
+	if _, err := SOPSDecryptValue(a); err == nil {
+		t.Error("SOPSDecryptValue() with the cache disabled should fail without the identities")
+	}
+	if result, failed := SOPSDecryptValues(values); len(result) != 0 || len(failed) != 3 {
+		t.Errorf("SOPSDecryptValues() with the cache disabled = %v, %v, want every value failed", result, failed)
+	}
+}
@@ -0,0 +1,290 @@
+package sops
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gmherb/envtab/internal/agent"
+	"github.com/spf13/viper"
+)
+
+// Encryptor encrypts and decrypts SOPS values, the SOPS: prefixed documents
+// stored in loadout entries
+type Encryptor interface {
+	// Name returns the name of the encryptor as set in the `sops.encryptor` config key
+	Name() string
+	// EncryptValue encrypts value against the sops creation rules, returning a SOPS: value
+	EncryptValue(value string) (string, error)
+	// DecryptValue decrypts a SOPS: value
+	DecryptValue(encryptedValue string) (string, error)
+	// DecryptValues decrypts a batch of SOPS: values, returning the decrypted
+	// values and the errors of the values that could not be decrypted, keyed
+	// like values
+	DecryptValues(values map[string]string) (map[string]string, map[string]error)
+}
+
+// Encryptor names of the `sops.encryptor` config key
+const (
+	// EncryptorAuto encrypts in process when possible and falls back to the sops binary
+	EncryptorAuto = "auto"
+	// EncryptorNative only encrypts in process, without the sops binary
+	EncryptorNative = "native"
+	// EncryptorBinary always runs the sops binary
+	EncryptorBinary = "binary"
+)
+
+// errUnsupported is returned by the native encryptor for values and creation
+// rules it cannot handle, such as keys other than age
+var errUnsupported = errors.New("not supported without the sops binary")
+
+// native is shared so age identities are only loaded once per process
+var native = &ageEncryptor{}
+
+// CurrentEncryptor returns the encryptor selected by the `sops.encryptor`
+// config key (or ENVTAB_SOPS_ENCRYPTOR), defaulting to auto: in process, with
+// the sops binary as a fallback
+func CurrentEncryptor() Encryptor {
+	name := os.Getenv("ENVTAB_SOPS_ENCRYPTOR")
+	if viper.IsSet("sops.encryptor") {
+		name = viper.GetString("sops.encryptor")
+	}
+
+	switch name {
+	case EncryptorNative:
+		return native
+	case EncryptorBinary:
+		return binaryEncryptor{}
+	case "", EncryptorAuto:
+	default:
+		slog.Warn("unknown sops encryptor, using auto", "encryptor", name)
+	}
+	return autoEncryptor{native: native, binary: binaryEncryptor{}}
+}
+
+// decryptResult is a cached result of decrypting a value
+type decryptResult struct {
+	value string
+	err   error
+}
+
+// decrypted caches decrypted values by their encrypted value, so a value
+// checked several times (such as by show) is only decrypted once
+var decrypted sync.Map
+
+// cacheDisabled is set by DisableCache
+var cacheDisabled atomic.Bool
+
+// DisableCache makes values and files always be decrypted with the current
+// keys, bypassing the process cache and the envtab agent. Used when rotating
+// keys, where a cached value would hide a key that is no longer available.
+func DisableCache() {
+	cacheDisabled.Store(true)
+}
+
+// SOPSEncryptValue encrypts a single value with the current encryptor
+func SOPSEncryptValue(value string) (string, error) {
+	return CurrentEncryptor().EncryptValue(value)
+}
+
+// SOPSDecryptValue decrypts a value with the current encryptor
+func SOPSDecryptValue(encryptedValue string) (string, error) {
+	if cacheDisabled.Load() {
+		return CurrentEncryptor().DecryptValue(encryptedValue)
+	}
+	if cached, ok := decrypted.Load(encryptedValue); ok {
+		return cached.(decryptResult).value, cached.(decryptResult).err
+	}
+	key := agent.CacheKey([]byte(encryptedValue))
+	if value, ok := agent.Get([]string{key})[key]; ok {
+		decrypted.Store(encryptedValue, decryptResult{value: value})
+		return value, nil
+	}
+
+	value, err := CurrentEncryptor().DecryptValue(encryptedValue)
+	decrypted.Store(encryptedValue, decryptResult{value, err})
+	if err == nil {
+		agent.Put(map[string]string{key: value})
+	}
+	return value, err
+}
+
+// SOPSDecryptValues decrypts the SOPS: values among values in one batch with
+// the current encryptor, such as the entries of a loadout. Values without the
+// SOPS: prefix are skipped. Returns the decrypted values and the errors of
+// the values that could not be decrypted, keyed like values. Later calls to
+// SOPSDecryptValue and SOPSDisplayValue reuse the results, and values are
+// looked up in and added to the envtab agent when it is running, unless
+// DisableCache was called.
+func SOPSDecryptValues(values map[string]string) (map[string]string, map[string]error) {
+	result := map[string]string{}
+	failed := map[string]error{}
+	pending := map[string]string{}
+	for key, value := range values {
+		if !strings.HasPrefix(value, "SOPS:") {
+			continue
+		}
+		if cacheDisabled.Load() {
+			pending[key] = value
+			continue
+		}
+		if cached, ok := decrypted.Load(value); ok {
+			if err := cached.(decryptResult).err; err != nil {
+				failed[key] = err
+			} else {
+				result[key] = cached.(decryptResult).value
+			}
+			continue
+		}
+		pending[key] = value
+	}
+	if len(pending) == 0 {
+		return result, failed
+	}
+	if cacheDisabled.Load() {
+		return CurrentEncryptor().DecryptValues(pending)
+	}
+
+	// Values cached by the envtab agent are not decrypted again
+	cacheKeys := map[string]string{}
+	for key, value := range pending {
+		cacheKeys[key] = agent.CacheKey([]byte(value))
+	}
+	cached := agent.Get(slices.Collect(maps.Values(cacheKeys)))
+	for key, value := range pending {
+		if plaintext, ok := cached[cacheKeys[key]]; ok {
+			result[key] = plaintext
+			decrypted.Store(value, decryptResult{value: plaintext})
+			delete(pending, key)
+		}
+	}
+	if len(pending) == 0 {
+		return result, failed
+	}
+
+	slog.Debug("decrypting SOPS values", "count", len(pending))
+	batch, batchFailed := CurrentEncryptor().DecryptValues(pending)
+	toCache := map[string]string{}
+	for key, value := range batch {
+		result[key] = value
+		decrypted.Store(pending[key], decryptResult{value: value})
+		toCache[cacheKeys[key]] = value
+	}
+	agent.Put(toCache)
+	for key, err := range batchFailed {
+		failed[key] = err
+		decrypted.Store(pending[key], decryptResult{err: err})
+	}
+	return result, failed
+}
+
+// autoEncryptor uses the native encryptor and falls back to the sops binary
+// for values and creation rules the native encryptor does not support
+type autoEncryptor struct {
+	native Encryptor
+	binary Encryptor
+}
+
+func (a autoEncryptor) Name() string { return EncryptorAuto }
+
+// fallback returns whether to retry with the sops binary after err from the
+// native encryptor, or the error to return instead
+func (a autoEncryptor) fallback(err error) (bool, error) {
+	if !errors.Is(err, errUnsupported) {
+		return false, err
+	}
+	if binaryErr := checkSOPSAvailable(); binaryErr != nil {
+		return false, fmt.Errorf("%v, and %w", err, binaryErr)
+	}
+	slog.Debug("falling back to the sops binary", "reason", err)
+	return true, nil
+}
+
+func (a autoEncryptor) EncryptValue(value string) (string, error) {
+	encrypted, err := a.native.EncryptValue(value)
+	if err == nil {
+		return encrypted, nil
+	}
+	if retry, err := a.fallback(err); !retry {
+		return "", err
+	}
+	return a.binary.EncryptValue(value)
+}
+
+func (a autoEncryptor) DecryptValue(encryptedValue string) (string, error) {
+	value, err := a.native.DecryptValue(encryptedValue)
+	if err == nil {
+		return value, nil
+	}
+	if retry, err := a.fallback(err); !retry {
+		return "", err
+	}
+	return a.binary.DecryptValue(encryptedValue)
+}
+
+func (a autoEncryptor) DecryptValues(values map[string]string) (map[string]string, map[string]error) {
+	result, failed := a.native.DecryptValues(values)
+
+	unsupported := map[string]string{}
+	for key, err := range failed {
+		if retry, err := a.fallback(err); retry {
+			unsupported[key] = values[key]
+			delete(failed, key)
+		} else {
+			failed[key] = err
+		}
+	}
+	if len(unsupported) == 0 {
+		return result, failed
+	}
+
+	binaryResult, binaryFailed := a.binary.DecryptValues(unsupported)
+	for key, value := range binaryResult {
+		result[key] = value
+	}
+	for key, err := range binaryFailed {
+		failed[key] = err
+	}
+	return result, failed
+}
+
+// binaryEncryptor runs the sops binary for every value
+type binaryEncryptor struct{}
+
+func (binaryEncryptor) Name() string { return EncryptorBinary }
+
+// DecryptValues runs the sops binary for the values concurrently, one
+// process per CPU at a time
+func (b binaryEncryptor) DecryptValues(values map[string]string) (map[string]string, map[string]error) {
+	result := map[string]string{}
+	failed := map[string]error{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, runtime.NumCPU())
+	for key, value := range values {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			decrypted, err := b.DecryptValue(value)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed[key] = err
+			} else {
+				result[key] = decrypted
+			}
+		}()
+	}
+	wg.Wait()
+	return result, failed
+}
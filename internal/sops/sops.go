@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/gmherb/envtab/internal/agent"
 	"github.com/gmherb/envtab/internal/utils"
 	"github.com/spf13/viper"
 	yaml "gopkg.in/yaml.v2"
@@ -112,11 +113,60 @@ func SOPSEncryptFile(filePath string) ([]byte, error) {
 	return encrypted, nil
 }
 
+// SOPSEncryptContent encrypts content to be written to filePath using sops command-line tool
+// Passes the content via stdin, so the file does not need to exist and its current content is ignored
+// Uses filePath as the filename override to match sops creation rules and the file format
+func SOPSEncryptContent(content []byte, filePath string) ([]byte, error) {
+	slog.Debug("encrypting content with SOPS", "file", filePath)
+	if err := checkSOPSAvailable(); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("sops", buildSOPSArgs("encrypt", "--filename-override", filePath)...)
+	cmd.Stdin = bytes.NewReader(content)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	encrypted, err := cmd.Output()
+	if err != nil {
+		stderrStr := stderr.String()
+		slog.Debug("SOPS encryption failed", "file", filePath, "stderr", stderrStr, "error", err)
+		if stderrStr != "" {
+			return nil, fmt.Errorf("sops encryption failed: %s: %w", strings.TrimSpace(stderrStr), err)
+		}
+		return nil, fmt.Errorf("sops encryption failed: %w", err)
+	}
+
+	slog.Debug("content encrypted successfully", "file", filePath)
+	return encrypted, nil
+}
+
 // SOPSDecryptFile decrypts a file using sops command-line tool
 // Returns the decrypted content as bytes
 // Handles key rotation errors gracefully
 // Uses the file path to match sops creation rules (e.g., for prod vs dev environments)
+// The decrypted content is looked up in and added to the envtab agent when it
+// is running, unless DisableCache was called
 func SOPSDecryptFile(filePath string) ([]byte, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil || cacheDisabled.Load() {
+		return decryptFile(filePath)
+	}
+	key := agent.CacheKey(content)
+	if decrypted, ok := agent.Get([]string{key})[key]; ok {
+		slog.Debug("file decrypted by envtab agent", "file", filePath)
+		return []byte(decrypted), nil
+	}
+
+	decrypted, err := decryptFile(filePath)
+	if err == nil {
+		agent.Put(map[string]string{key: string(decrypted)})
+	}
+	return decrypted, err
+}
+
+// decryptFile decrypts a file with the sops binary
+func decryptFile(filePath string) ([]byte, error) {
 	slog.Debug("decrypting file with SOPS", "file", filePath)
 	if err := checkSOPSAvailable(); err != nil {
 		return nil, err
@@ -209,12 +259,16 @@ func IsSOPSEncrypted(filePath string) bool {
 		slog.Debug("failed to read file for SOPS encryption check", "file", filePath, "error", err)
 		return false
 	}
+	return IsSOPSEncryptedContent(content)
+}
 
+// IsSOPSEncryptedContent checks if file content is encrypted with sops, like IsSOPSEncrypted
+func IsSOPSEncryptedContent(content []byte) bool {
 	var data map[string]interface{}
 	if err := yaml.Unmarshal(content, &data); err != nil {
 		// Try JSON if YAML parsing fails
 		if jsonErr := json.Unmarshal(content, &data); jsonErr != nil {
-			slog.Debug("file is not valid YAML or JSON", "file", filePath)
+			slog.Debug("content is not valid YAML or JSON")
 			return false
 		}
 	}
@@ -222,13 +276,13 @@ func IsSOPSEncrypted(filePath string) bool {
 	_, hasSops := data["sops"]
 	_, hasData := data["data"]
 	isEncrypted := hasSops || hasData
-	slog.Debug("SOPS encryption check result", "file", filePath, "encrypted", isEncrypted, "has_sops", hasSops, "has_data", hasData)
+	slog.Debug("SOPS encryption check result", "encrypted", isEncrypted, "has_sops", hasSops, "has_data", hasData)
 	return isEncrypted
 }
 
-// SOPSEncryptValue encrypts a single value using sops
+// EncryptValue encrypts a single value using the sops binary
 // Passes the value via stdin to avoid creating temporary files
-func SOPSEncryptValue(value string) (string, error) {
+func (binaryEncryptor) EncryptValue(value string) (string, error) {
 	slog.Debug("encrypting value with SOPS")
 	if err := checkSOPSAvailable(); err != nil {
 		return "", err
@@ -263,8 +317,8 @@ func SOPSEncryptValue(value string) (string, error) {
 	return "SOPS:" + string(encrypted), nil
 }
 
-// SOPSDecryptValue decrypts a value using sops
-func SOPSDecryptValue(encryptedValue string) (string, error) {
+// DecryptValue decrypts a value using the sops binary
+func (binaryEncryptor) DecryptValue(encryptedValue string) (string, error) {
 	slog.Debug("decrypting value with SOPS")
 	if err := checkSOPSAvailable(); err != nil {
 		return "", err
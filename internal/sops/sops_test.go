@@ -366,6 +366,41 @@ entries:
 	}
 }
 
+func TestSOPSEncryptContent(t *testing.T) {
+	// Skip if sops is not available
+	if err := checkSOPSAvailable(); err != nil {
+		t.Skipf("Skipping test: sops not available: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+
+	// The content is encrypted for the target path, which does not need to exist
+	testFile := filepath.Join(tmpDir, "test.yaml")
+	testContent := `metadata:
+  createdAt: "2023-01-01"
+entries:
+  KEY1: value1`
+
+	encrypted, err := SOPSEncryptContent([]byte(testContent), testFile)
+	if err != nil {
+		t.Fatalf("SOPSEncryptContent() error = %v", err)
+	}
+	if _, err := os.Stat(testFile); !os.IsNotExist(err) {
+		t.Error("SOPSEncryptContent() should not write the target file")
+	}
+
+	var data map[string]interface{}
+	if err := yaml.Unmarshal(encrypted, &data); err != nil {
+		t.Fatalf("Failed to parse encrypted YAML: %v", err)
+	}
+	if _, hasSops := data["sops"]; !hasSops {
+		t.Error("SOPSEncryptContent() should add sops metadata")
+	}
+	if strings.Contains(string(encrypted), "value1") {
+		t.Error("SOPSEncryptContent() should encrypt the values")
+	}
+}
+
 func TestSOPSDecryptFile(t *testing.T) {
 	// Skip if sops is not available
 	if err := checkSOPSAvailable(); err != nil {